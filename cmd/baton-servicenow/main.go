@@ -5,13 +5,17 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/conductorone/baton-sdk/pkg/cli"
 	configschema "github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/types"
 	"github.com/conductorone/baton-servicenow/pkg/config"
 	"github.com/conductorone/baton-servicenow/pkg/connector"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -20,7 +24,15 @@ var version = "dev"
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := configschema.DefineConfiguration(ctx, "baton-servicenow", getConnector, config.Config)
+	// provisioning is one of the SDK's own flags, so it isn't part of
+	// config.ServiceNow; read it from viper once the command has parsed it.
+	var v *viper.Viper
+	v, cmd, err := configschema.DefineConfiguration(ctx, "baton-servicenow",
+		func(ctx context.Context, snc *config.ServiceNow) (types.ConnectorServer, error) {
+			return getConnector(ctx, snc, v.GetBool("provisioning"))
+		},
+		config.Config,
+	)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -28,6 +40,12 @@ func main() {
 
 	cmd.Version = version
 
+	_, err = cli.AddCommand(cmd, v, &config.Config, sizingCmd(v))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
 	err = cmd.Execute()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -41,9 +59,33 @@ func constructAuth(snc *config.ServiceNow) (string, error) {
 	return fmt.Sprintf("Basic %s", encodedCredentials), nil
 }
 
-func getConnector(ctx context.Context, snc *config.ServiceNow) (types.ConnectorServer, error) {
+func getConnector(ctx context.Context, snc *config.ServiceNow, provisioning bool) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
+	servicenowConnector, err := newServiceNow(ctx, snc, connector.PreflightScope{
+		Provisioning: provisioning,
+		Ticketing:    snc.Ticketing,
+	})
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+
+	opts := make([]connectorbuilder.Opt, 0)
+	if snc.Ticketing {
+		opts = append(opts, connectorbuilder.WithTicketingEnabled())
+	}
+
+	c, err := connectorbuilder.NewConnector(ctx, servicenowConnector, opts...)
+	if err != nil {
+		l.Error("error creating connector", zap.Error(err))
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func newServiceNow(ctx context.Context, snc *config.ServiceNow, preflight connector.PreflightScope) (*connector.ServiceNow, error) {
 	// compose the auth options
 	auth, err := constructAuth(snc)
 	if err != nil {
@@ -62,22 +104,39 @@ func getConnector(ctx context.Context, snc *config.ServiceNow) (types.ConnectorS
 		ticketSchemaFilters["sysparm_category"] = categoryId
 	}
 
-	servicenowConnector, err := connector.New(ctx, auth, snc.Deployment, ticketSchemaFilters, snc.AllowedDomains, snc.CustomUserFields, snc.BaseUrl, snc.Insecure)
+	grantDurations, err := servicenow.ParseGrantDurations(snc.GrantDurations)
 	if err != nil {
-		l.Error("error creating connector", zap.Error(err))
 		return nil, err
 	}
 
-	opts := make([]connectorbuilder.Opt, 0)
-	if snc.Ticketing {
-		opts = append(opts, connectorbuilder.WithTicketingEnabled())
-	}
-
-	c, err := connectorbuilder.NewConnector(ctx, servicenowConnector, opts...)
-	if err != nil {
-		l.Error("error creating connector", zap.Error(err))
-		return nil, err
+	clientOpts := []servicenow.ClientOption{
+		servicenow.WithQueryFilters(servicenow.QueryFilters{
+			User:  snc.UserFilter,
+			Group: snc.GroupFilter,
+			Role:  snc.RoleFilter,
+		}),
+		servicenow.WithRetryPolicy(servicenow.RetryPolicy{
+			MaxRetries: snc.MaxRetries,
+			BaseDelay:  servicenow.DefaultRetryPolicy.BaseDelay,
+			MaxDelay:   time.Duration(snc.MaxRetryDelay) * time.Second,
+		}),
+		servicenow.WithMaxConcurrentRequests(snc.MaxConcurrentRequests),
+		servicenow.WithSysDomain(snc.SysDomain),
+		servicenow.WithProvisionableGroupTypes(snc.ProvisionableGroupTypes),
+		servicenow.WithSubscriptions(snc.SyncSubscriptions),
+		servicenow.WithApplications(snc.SyncApplications),
+		servicenow.WithUserCriteria(snc.SyncUserCriteria),
+		servicenow.WithCMDB(snc.SyncCmdb),
+		servicenow.WithEffectiveRoles(snc.SyncEffectiveRoles),
+		servicenow.WithHRSD(snc.SyncHrsd),
+		servicenow.WithACLs(snc.SyncAcls),
+		servicenow.WithDelegationDuration(time.Duration(snc.DelegationDuration) * 24 * time.Hour),
+		servicenow.WithGrantExpiry(snc.GrantExpiryTable, grantDurations),
 	}
 
-	return c, nil
+	return connector.New(ctx, auth, snc.Deployment, ticketSchemaFilters, snc.AllowedDomains, snc.CustomUserFields, snc.BaseUrl, snc.Insecure,
+		connector.WithPreflight(preflight),
+		connector.WithFixtureRecording(snc.RecordFixtures),
+		connector.WithClientOptions(clientOpts...),
+	)
 }
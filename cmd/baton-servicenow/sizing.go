@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/conductorone/baton-sdk/pkg/cli"
+	"github.com/conductorone/baton-sdk/pkg/field"
+	"github.com/conductorone/baton-servicenow/pkg/config"
+	"github.com/conductorone/baton-servicenow/pkg/connector"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// sizingCmd prints how many rows a sync would list and roughly how many
+// requests that takes, from the Aggregate API's counts, without syncing.
+func sizingCmd(v *viper.Viper) *cobra.Command {
+	return &cobra.Command{
+		Use:   "sizing",
+		Short: "Estimate the rows and requests a sync of this instance involves",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := v.BindPFlags(cmd.Flags()); err != nil {
+				return err
+			}
+
+			snc, err := cli.MakeGenericConfiguration[*config.ServiceNow](v)
+			if err != nil {
+				return err
+			}
+			if err := field.Validate(config.Config, snc); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			servicenowConnector, err := newServiceNow(ctx, snc, connector.PreflightScope{})
+			if err != nil {
+				return err
+			}
+
+			report, _, err := servicenowConnector.Sizing(ctx)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+			fmt.Fprintln(w, "LISTING\tROWS\tPAGE SIZE\tREQUESTS\t")
+			for _, row := range report.Rows {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", row.Listing, row.Rows, row.PageSize, row.Requests)
+			}
+			fmt.Fprintf(w, "total\t\t\t%d\t\n", report.TotalRequests())
+			return w.Flush()
+		},
+	}
+}
@@ -11,9 +11,28 @@ type ServiceNow struct {
 	CategoryId string `mapstructure:"category-id"`
 	AllowedDomains []string `mapstructure:"allowed-domains"`
 	CustomUserFields []string `mapstructure:"custom-user-fields"`
+	UserFilter string `mapstructure:"user-filter"`
+	GroupFilter string `mapstructure:"group-filter"`
+	RoleFilter string `mapstructure:"role-filter"`
+	ProvisionableGroupTypes []string `mapstructure:"provisionable-group-types"`
+	SysDomain string `mapstructure:"sys-domain"`
+	SyncSubscriptions bool `mapstructure:"sync-subscriptions"`
+	SyncApplications bool `mapstructure:"sync-applications"`
+	SyncUserCriteria bool `mapstructure:"sync-user-criteria"`
+	SyncCmdb bool `mapstructure:"sync-cmdb"`
+	SyncEffectiveRoles bool `mapstructure:"sync-effective-roles"`
+	SyncHrsd bool `mapstructure:"sync-hrsd"`
+	SyncAcls bool `mapstructure:"sync-acls"`
+	DelegationDuration int `mapstructure:"delegation-duration"`
+	GrantExpiryTable string `mapstructure:"grant-expiry-table"`
+	GrantDurations []string `mapstructure:"grant-durations"`
+	MaxRetries int `mapstructure:"max-retries"`
+	MaxRetryDelay int `mapstructure:"max-retry-delay"`
+	MaxConcurrentRequests int `mapstructure:"max-concurrent-requests"`
 	Ticketing bool `mapstructure:"ticketing"`
 	BaseUrl string `mapstructure:"base-url"`
 	Insecure bool `mapstructure:"insecure"`
+	RecordFixtures string `mapstructure:"record-fixtures"`
 }
 
 func (c *ServiceNow) findFieldByTag(tagValue string) (any, bool) {
@@ -34,6 +34,90 @@ var (
 		field.WithDescription("Additional custom user fields to sync (must start with u_ prefix, e.g., u_type, u_department)"),
 		field.WithDefaultValue([]string{}),
 	)
+	userFilterField = field.StringField("user-filter",
+		field.WithDisplayName("User filter"),
+		field.WithDescription("ServiceNow encoded query ANDed into the sys_user listing and user memberships (e.g. active=true^web_service_access_only=false)"),
+	)
+	groupFilterField = field.StringField("group-filter",
+		field.WithDisplayName("Group filter"),
+		field.WithDescription("ServiceNow encoded query ANDed into the sys_user_group listing and group role memberships (e.g. type=itil)"),
+	)
+	roleFilterField = field.StringField("role-filter",
+		field.WithDisplayName("Role filter"),
+		field.WithDescription("ServiceNow encoded query ANDed into the sys_user_role listing (e.g. elevated_privilege=false)"),
+	)
+	provisionableGroupTypesField = field.StringSliceField("provisionable-group-types",
+		field.WithDisplayName("Provisionable group types"),
+		field.WithDescription("Group types (sys_user_group_type names, e.g. itil) whose groups members may be added to; groups without a type always can, and the default * allows every type"),
+		field.WithDefaultValue([]string{"*"}),
+	)
+	sysDomainField = field.StringField("sys-domain",
+		field.WithDisplayName("Domain"),
+		field.WithDescription("sys_id of the domain to scope users, groups and memberships to on a domain-separated instance, including its child domains; created users and groups are placed in it"),
+	)
+	syncSubscriptionsField = field.BoolField("sync-subscriptions",
+		field.WithDisplayName("Sync subscriptions"),
+		field.WithDescription("Sync subscriptions (license_details) and their user allocations (license_has_user); the account needs the license_admin role"),
+		field.WithDefaultValue(false),
+	)
+	syncApplicationsField = field.BoolField("sync-applications",
+		field.WithDisplayName("Sync applications"),
+		field.WithDescription("Sync scoped applications (sys_scope) and list each application's roles under it instead of at the top level"),
+		field.WithDefaultValue(false),
+	)
+	syncUserCriteriaField = field.BoolField("sync-user-criteria",
+		field.WithDisplayName("Sync user criteria"),
+		field.WithDescription("Sync user criteria (user_criteria) with the users and groups they list, and the knowledge bases and catalog items they apply to"),
+		field.WithDefaultValue(false),
+	)
+	syncCMDBField = field.BoolField("sync-cmdb",
+		field.WithDisplayName("Sync CMDB"),
+		field.WithDescription("Sync CMDB business applications (cmdb_ci_business_app) and services (cmdb_ci_service) with their owners, managers and support groups"),
+		field.WithDefaultValue(false),
+	)
+	syncHRSDField = field.BoolField("sync-hrsd",
+		field.WithDisplayName("Sync HR Service Delivery"),
+		field.WithDescription("Sync HR Service Delivery roles (sn_hr_*) and the groups that hold them; skipped when HR Service Delivery isn't installed"),
+		field.WithDefaultValue(false),
+	)
+	syncACLsField = field.BoolField("sync-acls",
+		field.WithDisplayName("Sync ACLs"),
+		field.WithDescription("Sync active ACLs (sys_security_acl) with the roles they require (sys_security_acl_role); the account needs security_admin or read ACLs on both tables"),
+		field.WithDefaultValue(false),
+	)
+	syncEffectiveRolesField = field.BoolField("sync-effective-roles",
+		field.WithDisplayName("Sync effective roles"),
+		field.WithDescription("Add each user's effective roles and how they hold them (directly, through a group or a containing role) to their profile; costs a request per user"),
+		field.WithDefaultValue(false),
+	)
+	delegationDurationField = field.IntField("delegation-duration",
+		field.WithDisplayName("Delegation duration"),
+		field.WithDescription("How many days a delegation granted through the user delegate entitlement lasts before it ends"),
+		field.WithDefaultValue(30),
+	)
+	grantExpiryTableField = field.StringField("grant-expiry-table",
+		field.WithDisplayName("Grant expiry table"),
+		field.WithDescription("Custom table (u_ or x_) with u_table, u_user, u_target and u_expires columns that records when group memberships and roles granted to users expire"),
+	)
+	grantDurationsField = field.StringSliceField("grant-durations",
+		field.WithDisplayName("Grant durations"),
+		field.WithDescription("Groups and roles, by name or sys_id, whose grants to users expire, each as name=hours (e.g. \"Database Admins=8\"); revoke_expired_grants removes a grant once its hours are up, and grants of anything unlisted are permanent; needs the grant expiry table"),
+	)
+	maxRetriesField = field.IntField("max-retries",
+		field.WithDisplayName("Max retries"),
+		field.WithDescription("How many times a read or delete is retried after a 429, 5xx or connection failure (0 disables retries)"),
+		field.WithDefaultValue(3),
+	)
+	maxRetryDelayField = field.IntField("max-retry-delay",
+		field.WithDisplayName("Max retry delay"),
+		field.WithDescription("Longest wait in seconds between retries, including waits requested by Retry-After or X-RateLimit-Reset"),
+		field.WithDefaultValue(30),
+	)
+	maxConcurrentRequestsField = field.IntField("max-concurrent-requests",
+		field.WithDisplayName("Max concurrent requests"),
+		field.WithDescription("How many API requests may be in flight to the instance at once while prefetching and fanning out grant listings (1 sends them one at a time)"),
+		field.WithDefaultValue(4),
+	)
 	externalTicketField = field.TicketingField.ExportAs(field.ExportTargetGUI)
 	baseURLField = field.StringField("base-url",
 		field.WithDescription("Override the ServiceNow API URL (for testing)"),
@@ -46,6 +130,11 @@ var (
 		field.WithHidden(true),
 		field.WithExportTarget(field.ExportTargetCLIOnly),
 	)
+	recordFixturesField = field.StringField("record-fixtures",
+		field.WithDescription("Record sanitized API request/response fixtures into this directory (for regression tests)"),
+		field.WithHidden(true),
+		field.WithExportTarget(field.ExportTargetCLIOnly),
+	)
 )
 
 // configurationFields defines the external configuration required for the connector to run.
@@ -57,9 +146,28 @@ var configurationFields = []field.SchemaField{
 	categoryField,
 	allowedDomainsField,
 	customUserFieldsField,
+	userFilterField,
+	groupFilterField,
+	roleFilterField,
+	provisionableGroupTypesField,
+	sysDomainField,
+	syncSubscriptionsField,
+	syncApplicationsField,
+	syncUserCriteriaField,
+	syncCMDBField,
+	syncEffectiveRolesField,
+	syncHRSDField,
+	syncACLsField,
+	delegationDurationField,
+	grantExpiryTableField,
+	grantDurationsField,
+	maxRetriesField,
+	maxRetryDelayField,
+	maxConcurrentRequestsField,
 	externalTicketField,
 	baseURLField,
 	insecureField,
+	recordFixturesField,
 }
 
 var configRelations = []field.SchemaFieldRelationship{
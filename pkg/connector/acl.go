@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+const aclAccess = "access"
+
+// aclResourceType syncs active ACLs, each granting its access entitlement
+// to the members of the roles it requires. An ACL that requires several
+// roles is satisfied by any one of them; its condition and script, when it
+// has them, narrow that further and are only carried in the profile.
+type aclResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+	roles        *aclRoleIndex
+}
+
+func (a *aclResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return a.resourceType
+}
+
+// Create a new connector resource for an ACL, named after what it guards
+// and how, e.g. "incident.number read".
+func aclResource(acl *servicenow.ACL) (*v2.Resource, error) {
+	table, field := acl.TableAndField()
+	profile := map[string]interface{}{
+		"acl_name":        acl.Name,
+		"acl_id":          acl.Id,
+		"table":           table,
+		"operation":       acl.Op(),
+		"type":            acl.Kind(),
+		"condition":       acl.Condition,
+		"advanced":        acl.Advanced,
+		"admin_overrides": acl.AdminOverrides,
+	}
+	if field != "" {
+		profile["field"] = field
+	}
+
+	resource, err := rs.NewResource(
+		fmt.Sprintf("%s %s", acl.Name, acl.Op()),
+		resourceTypeACL,
+		acl.Id,
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(acl.Description),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (a *aclResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeACL.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if pt.Token == "" {
+		a.roles.reset()
+	}
+
+	acls, nextPageToken, annos, err := a.client.GetACLs(ctx, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list ACLs: %w", err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, acl := range acls {
+		aclCopy := acl
+		ar, err := aclResource(&aclCopy)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, ar)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (a *aclResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(
+			resource,
+			aclAccess,
+			ent.WithGrantableTo(resourceTypeRole),
+			ent.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, aclAccess)),
+			ent.WithDescription(fmt.Sprintf("Passes the role check of the %s ACL in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns a grant to each synced role the ACL requires, expanding to
+// the role's members.
+func (a *aclResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	roleIDs, annos, err := a.roles.forACL(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list roles ACLs require: %w", err)
+	}
+
+	var rv []*v2.Grant
+	for _, roleID := range roleIDs {
+		rv = append(rv, grant.NewGrant(
+			resource,
+			aclAccess,
+			&v2.ResourceId{
+				ResourceType: resourceTypeRole.Id,
+				Resource:     roleID,
+			},
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{fmt.Sprintf("role:%s:%s", roleID, roleMembership)},
+				Shallow:        true,
+			}),
+		))
+	}
+
+	return rv, "", annos, nil
+}
+
+func aclBuilder(client *servicenow.Client) *aclResourceType {
+	return &aclResourceType{
+		resourceType: resourceTypeACL,
+		client:       client,
+		roles:        newACLRoleIndex(client),
+	}
+}
+
+// aclRoleIndex holds sys_security_acl_role by ACL, so a sync reads it once
+// rather than once per ACL.
+type aclRoleIndex struct {
+	*tableIndex[string, []string]
+}
+
+func newACLRoleIndex(client *servicenow.Client) *aclRoleIndex {
+	return &aclRoleIndex{newTableIndex(func(ctx context.Context) (map[string][]string, annotations.Annotations, error) {
+		byACL := make(map[string][]string)
+		annos, err := eachRow(ctx, client.GetACLRoles, func(row servicenow.ACLRole) {
+			byACL[row.ACL] = append(byACL[row.ACL], row.Role)
+		})
+		return byACL, annos, err
+	})}
+}
+
+// forACL returns the sys_ids of the synced roles aclID requires.
+func (x *aclRoleIndex) forACL(ctx context.Context, aclID string) ([]string, annotations.Annotations, error) {
+	byACL, annos, err := x.get(ctx)
+	return byACL[aclID], annos, err
+}
@@ -3,6 +3,8 @@ package connector
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
@@ -11,12 +13,14 @@ import (
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/actions"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
 const (
-	ActionEnableUser  = "enable_user"
-	ActionDisableUser = "disable_user"
+	ActionEnableUser        = "enable_user"
+	ActionDisableUser       = "disable_user"
+	ActionUpdateUserProfile = "update_user_profile"
 )
 
 var enableUserAction = &v2.BatonActionSchema{
@@ -65,6 +69,43 @@ var disableUserAction = &v2.BatonActionSchema{
 	},
 }
 
+var updateUserProfileAction = &v2.BatonActionSchema{
+	Name:        ActionUpdateUserProfile,
+	DisplayName: "Update user profile",
+	Description: "Update profile attributes (title, department, manager, phone, configured u_ fields, ...) of a ServiceNow user",
+	Arguments: []*config.Field{
+		{
+			Name:        "resource",
+			DisplayName: "User",
+			Field:       &config.Field_ResourceIdField{},
+			IsRequired:  true,
+		},
+		{
+			Name:        "attributes",
+			DisplayName: "Attributes",
+			Description: "sys_user column names mapped to their new values",
+			Field:       &config.Field_StringMapField{},
+			IsRequired:  true,
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+		{
+			Name:        "resource",
+			DisplayName: "Updated user",
+			Field:       &config.Field_ResourceField{},
+		},
+	},
+	ActionType: []v2.ActionType{
+		v2.ActionType_ACTION_TYPE_ACCOUNT,
+		v2.ActionType_ACTION_TYPE_ACCOUNT_UPDATE_PROFILE,
+	},
+}
+
 func (s *ServiceNow) GlobalActions(ctx context.Context, registry actions.ActionRegistry) error {
 	if err := registry.Register(ctx, enableUserAction, s.enableUser); err != nil {
 		return err
@@ -74,6 +115,12 @@ func (s *ServiceNow) GlobalActions(ctx context.Context, registry actions.ActionR
 		return err
 	}
 
+	if s.client.GrantExpiryTable != "" {
+		if err := registry.Register(ctx, revokeExpiredGrantsAction, s.revokeExpiredGrants); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -168,3 +215,133 @@ func (s *ServiceNow) disableUser(ctx context.Context, args *structpb.Struct) (*s
 	}
 	return response, annos, nil
 }
+
+func (u *userResourceType) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if err := registry.Register(ctx, updateUserProfileAction, u.updateUserProfile); err != nil {
+		return err
+	}
+	return registry.Register(ctx, getEffectiveRolesAction, u.getEffectiveRoles)
+}
+
+func (u *userResourceType) updateUserProfile(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if args == nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: arguments cannot be nil")
+	}
+
+	resourceId, err := actions.RequireResourceIDArg(args, "resource")
+	if err != nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: %w", err)
+	}
+	if resourceId.ResourceType != resourceTypeUser.Id {
+		return nil, nil, fmt.Errorf("baton-servicenow: resource must be a user, got %s", resourceId.ResourceType)
+	}
+
+	attributes, err := stringMapArg(args, "attributes")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	annos, err := u.validateUpdatableUserFields(ctx, attributes)
+	if err != nil {
+		return nil, annos, err
+	}
+
+	l.Info("updating user profile",
+		zap.String("userId", resourceId.Resource),
+		zap.Strings("fields", mapKeys(attributes)),
+	)
+
+	updatedUser, annos, err := u.client.UpdateUser(ctx, resourceId.Resource, attributes)
+	if err != nil {
+		l.Error("failed to update user profile", zap.String("userId", resourceId.Resource), zap.Error(err))
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to update user %s: %w", resourceId.Resource, err)
+	}
+
+	resource, err := userResource(updatedUser)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to create user resource: %w", err)
+	}
+
+	resourceField, err := actions.NewResourceReturnField("resource", resource)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: %w", err)
+	}
+
+	return actions.NewReturnValues(true, resourceField), annos, nil
+}
+
+// validateUpdatableUserFields rejects any attribute that isn't on the
+// allow-list (servicenow.UpdatableUserFields plus the configured custom
+// fields), then checks the rest against sys_dictionary: a configured u_
+// field may not exist on this instance, and a column can be made read-only
+// by an admin. Failing here names the bad field instead of surfacing
+// ServiceNow's silent ignore of unknown columns on PATCH.
+func (u *userResourceType) validateUpdatableUserFields(ctx context.Context, attributes map[string]string) (annotations.Annotations, error) {
+	if len(attributes) == 0 {
+		return nil, fmt.Errorf("baton-servicenow: attributes cannot be empty")
+	}
+
+	fields := mapKeys(attributes)
+	var disallowed []string
+	for _, f := range fields {
+		if !slices.Contains(servicenow.UpdatableUserFields, f) && !slices.Contains(u.client.CustomUserFields, f) {
+			disallowed = append(disallowed, f)
+		}
+	}
+	if len(disallowed) > 0 {
+		return nil, fmt.Errorf("baton-servicenow: fields not allowed to be updated: %s", strings.Join(disallowed, ", "))
+	}
+
+	entries, annos, err := u.client.GetDictionaryEntries(ctx, "sys_user", fields)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to look up sys_user fields: %w", err)
+	}
+
+	writable := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		writable[e.Element] = e.ReadOnly != "true" && e.Active != "false"
+	}
+
+	var invalid []string
+	for _, f := range fields {
+		if !writable[f] {
+			invalid = append(invalid, f)
+		}
+	}
+	if len(invalid) > 0 {
+		return annos, fmt.Errorf("baton-servicenow: fields missing or read-only on sys_user: %s", strings.Join(invalid, ", "))
+	}
+
+	return annos, nil
+}
+
+// stringMapArg reads a string map argument. StringMapField values arrive as
+// a struct of string values.
+func stringMapArg(args *structpb.Struct, key string) (map[string]string, error) {
+	arg, ok := actions.GetStructArg(args, key)
+	if !ok {
+		return nil, fmt.Errorf("baton-servicenow: missing required argument %s", key)
+	}
+
+	rv := make(map[string]string, len(arg.GetFields()))
+	for k, v := range arg.GetFields() {
+		str, ok := v.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, fmt.Errorf("baton-servicenow: %s.%s must be a string", key, k)
+		}
+		rv[k] = str.StringValue
+	}
+	return rv, nil
+}
+
+// mapKeys returns the keys of m, sorted so logs and errors are stable.
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
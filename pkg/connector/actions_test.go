@@ -0,0 +1,42 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+// A field outside the allow-list must be rejected before any request is
+// made -- the update action must never become a way to write user_name,
+// roles or user_password.
+func TestValidateUpdatableUserFields_RejectsFieldsOffTheAllowList(t *testing.T) {
+	client, err := servicenow.NewClient(nil, "", "dev0", nil, nil, []string{"u_cost_code"}, "")
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	u := userBuilder(client)
+
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		wantField  string
+	}{
+		{"identity column", map[string]string{"title": "Engineer", "user_name": "root"}, "user_name"},
+		{"security column", map[string]string{"user_password": "hunter2"}, "user_password"},
+		{"unconfigured custom field", map[string]string{"u_secret": "x"}, "u_secret"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := u.validateUpdatableUserFields(context.Background(), tc.attributes)
+			if err == nil {
+				t.Fatalf("expected %q to be rejected", tc.wantField)
+			}
+			if !strings.Contains(err.Error(), tc.wantField) {
+				t.Errorf("error = %v, want it to name %q", err, tc.wantField)
+			}
+		})
+	}
+}
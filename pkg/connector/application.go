@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+type applicationResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+}
+
+func (a *applicationResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return a.resourceType
+}
+
+// Create a new connector resource for a ServiceNow scoped application. Its
+// roles are listed as its children (see roleResourceType.List).
+func applicationResource(app *servicenow.Application) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"application_name":  app.Name,
+		"application_id":    app.Id,
+		"scope":             app.Scope,
+		"version":           app.Version,
+		"vendor":            app.Vendor,
+		"active":            app.Active,
+		"application_class": app.Class,
+		"created_by":        app.CreatedBy,
+	}
+
+	resource, err := rs.NewAppResource(
+		app.Name,
+		resourceTypeApplication,
+		app.Id,
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(app.ShortDescription),
+		rs.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: resourceTypeRole.Id}),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (a *applicationResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeApplication.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	apps, nextPageToken, annos, err := a.client.GetApplications(ctx, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list applications: %w", err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, app := range apps {
+		appCopy := app
+		ar, err := applicationResource(&appCopy)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, ar)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+// Entitlements returns none: ServiceNow keeps no owner for an application,
+// and access to one is through its roles.
+func (a *applicationResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func (a *applicationResourceType) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	return nil, "", nil, nil
+}
+
+func applicationBuilder(client *servicenow.Client) *applicationResourceType {
+	return &applicationResourceType{
+		resourceType: resourceTypeApplication,
+		client:       client,
+	}
+}
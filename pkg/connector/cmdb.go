@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+const (
+	ciOwner        = "owner"
+	ciManager      = "manager"
+	ciSupportGroup = "support_group"
+)
+
+// configurationItemResourceType syncs one CMDB table, business applications
+// or services, as resources whose owned_by, managed_by and support_group are
+// grants of read-only entitlements. Ownership is changed in the CMDB, not
+// through the connector.
+type configurationItemResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+	table        string
+	noun         string
+}
+
+func (c *configurationItemResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return c.resourceType
+}
+
+// Create a new connector resource for a CMDB CI. The ownership references
+// go in the profile as sys_ids; Grants resolves them.
+func configurationItemResource(resourceType *v2.ResourceType, ci *servicenow.ConfigurationItem) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"ci_name":              ci.Name,
+		"ci_id":                ci.Id,
+		"number":               ci.Number,
+		"ci_class":             ci.Class,
+		"owned_by":             ci.OwnedBy,
+		"managed_by":           ci.ManagedBy,
+		"support_group":        ci.SupportGroup,
+		"operational_status":   ci.OperationalStatus,
+		"install_status":       ci.InstallStatus,
+		"business_criticality": ci.BusinessCriticality,
+		"used_for":             ci.UsedFor,
+		"version":              ci.Version,
+	}
+
+	resource, err := rs.NewAppResource(
+		ci.Name,
+		resourceType,
+		ci.Id,
+		[]rs.AppTraitOption{rs.WithAppProfile(profile)},
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(ci.ShortDescription),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (c *configurationItemResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: c.resourceType.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	cis, nextPageToken, annos, err := c.client.GetConfigurationItems(ctx, c.table, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list %ss: %w", c.noun, err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, ci := range cis {
+		ciCopy := ci
+		cr, err := configurationItemResource(c.resourceType, &ciCopy)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, cr)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (c *configurationItemResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(
+			resource,
+			ciOwner,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, ciOwner)),
+			ent.WithDescription(fmt.Sprintf("Owner (owned_by) of the %s %s in the ServiceNow CMDB", resource.DisplayName, c.noun)),
+		),
+		ent.NewPermissionEntitlement(
+			resource,
+			ciManager,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDisplayName(fmt.Sprintf("%s %s", resource.DisplayName, ciManager)),
+			ent.WithDescription(fmt.Sprintf("Manager (managed_by) of the %s %s in the ServiceNow CMDB", resource.DisplayName, c.noun)),
+		),
+		ent.NewPermissionEntitlement(
+			resource,
+			ciSupportGroup,
+			ent.WithGrantableTo(resourceTypeGroup),
+			ent.WithDisplayName(fmt.Sprintf("%s support group", resource.DisplayName)),
+			ent.WithDescription(fmt.Sprintf("Support group of the %s %s in the ServiceNow CMDB", resource.DisplayName, c.noun)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns the CI's owner, manager and support group, each only when
+// it's a user or group the sync lists. The support group grant expands to
+// the group's members.
+func (c *configurationItemResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	profile := resource.GetProfile()
+	ownedBy, _ := rs.GetProfileStringValue(profile, "owned_by")
+	managedBy, _ := rs.GetProfileStringValue(profile, "managed_by")
+	supportGroup, _ := rs.GetProfileStringValue(profile, "support_group")
+
+	var userIDs []string
+	for _, id := range []string{ownedBy, managedBy} {
+		if id != "" {
+			userIDs = append(userIDs, id)
+		}
+	}
+	syncedUsers, annos, err := c.client.SyncedUserIDs(ctx, userIDs...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up owners of %s %s: %w", c.noun, resource.Id.Resource, err)
+	}
+
+	var groupIDs []string
+	if supportGroup != "" {
+		groupIDs = append(groupIDs, supportGroup)
+	}
+	syncedGroups, groupAnnos, err := c.client.SyncedGroupIDs(ctx, groupIDs...)
+	annos = append(groupAnnos, annos...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up support group of %s %s: %w", c.noun, resource.Id.Resource, err)
+	}
+
+	var rv []*v2.Grant
+	for entitlement, userID := range map[string]string{ciOwner: ownedBy, ciManager: managedBy} {
+		if syncedUsers[userID] {
+			rv = append(rv, grant.NewGrant(
+				resource,
+				entitlement,
+				&v2.ResourceId{
+					ResourceType: resourceTypeUser.Id,
+					Resource:     userID,
+				},
+			))
+		}
+	}
+	if syncedGroups[supportGroup] {
+		rv = append(rv, grant.NewGrant(
+			resource,
+			ciSupportGroup,
+			&v2.ResourceId{
+				ResourceType: resourceTypeGroup.Id,
+				Resource:     supportGroup,
+			},
+			grant.WithAnnotation(&v2.GrantExpandable{
+				EntitlementIds: []string{fmt.Sprintf("group:%s:%s", supportGroup, groupMembership)},
+				Shallow:        true,
+			}),
+		))
+	}
+
+	return rv, "", annos, nil
+}
+
+func businessApplicationBuilder(client *servicenow.Client) *configurationItemResourceType {
+	return &configurationItemResourceType{
+		resourceType: resourceTypeBusinessApplication,
+		client:       client,
+		table:        servicenow.BusinessApplicationsTable,
+		noun:         "business application",
+	}
+}
+
+func businessServiceBuilder(client *servicenow.Client) *configurationItemResourceType {
+	return &configurationItemResourceType{
+		resourceType: resourceTypeBusinessService,
+		client:       client,
+		table:        servicenow.BusinessServicesTable,
+		noun:         "business service",
+	}
+}
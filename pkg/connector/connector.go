@@ -10,6 +10,7 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow/fixture"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 )
 
@@ -20,7 +21,6 @@ var (
 		Traits: []v2.ResourceType_Trait{
 			v2.ResourceType_TRAIT_USER,
 		},
-		Annotations: annotationsForUserResourceType(),
 	}
 	resourceTypeRole = &v2.ResourceType{
 		Id:          "role",
@@ -36,90 +36,158 @@ var (
 			v2.ResourceType_TRAIT_GROUP,
 		},
 	}
+	resourceTypeApplication = &v2.ResourceType{
+		Id:          "application",
+		DisplayName: "Application",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_APP,
+		},
+	}
+	resourceTypeSubscription = &v2.ResourceType{
+		Id:          "subscription",
+		DisplayName: "Subscription",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_LICENSE_PROFILE,
+		},
+	}
+	resourceTypeUserCriteria = &v2.ResourceType{
+		Id:          "user_criteria",
+		DisplayName: "User Criteria",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
+	resourceTypeBusinessApplication = &v2.ResourceType{
+		Id:          "business_application",
+		DisplayName: "Business Application",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_APP,
+		},
+	}
+	resourceTypeBusinessService = &v2.ResourceType{
+		Id:          "business_service",
+		DisplayName: "Business Service",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_APP,
+		},
+	}
+	resourceTypeHRRole = &v2.ResourceType{
+		Id:          "hr_role",
+		DisplayName: "HR Role",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_ROLE,
+		},
+	}
+	resourceTypeHRGroup = &v2.ResourceType{
+		Id:          "hr_group",
+		DisplayName: "HR Group",
+		Traits: []v2.ResourceType_Trait{
+			v2.ResourceType_TRAIT_GROUP,
+		},
+	}
+	resourceTypeACL = &v2.ResourceType{
+		Id:          "acl",
+		DisplayName: "ACL",
+	}
 )
 
 type ServiceNow struct {
-	client *servicenow.Client
+	client    *servicenow.Client
+	preflight PreflightScope
 }
 
 func (s *ServiceNow) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
+	syncers := []connectorbuilder.ResourceSyncer{
 		userBuilder(s.client),
 		roleBuilder(s.client),
 		groupBuilder(s.client),
 	}
+	if s.client.SyncApplications {
+		syncers = append(syncers, applicationBuilder(s.client))
+	}
+	if s.client.SyncSubscriptions {
+		syncers = append(syncers, subscriptionBuilder(s.client))
+	}
+	if s.client.SyncUserCriteria {
+		syncers = append(syncers, userCriteriaBuilder(s.client))
+	}
+	if s.client.SyncCMDB {
+		syncers = append(syncers, businessApplicationBuilder(s.client), businessServiceBuilder(s.client))
+	}
+	if s.client.SyncHRSD {
+		syncers = append(syncers, hrRoleBuilder(s.client), hrGroupBuilder(s.client))
+	}
+	if s.client.SyncACLs {
+		syncers = append(syncers, aclBuilder(s.client))
+	}
+	return syncers
 }
 
 func (s *ServiceNow) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error) {
 	return &v2.ConnectorMetadata{
-		DisplayName: "ServiceNow",
-		Description: "Connector to sync users to ServiceNow",
-		AccountCreationSchema: &v2.ConnectorAccountCreationSchema{
-			FieldMap: map[string]*v2.ConnectorAccountCreationSchema_Field{
-				"username": {
-					DisplayName: "Username",
-					Required:    true,
-					Description: "Username of the user",
-					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
-						StringField: &v2.ConnectorAccountCreationSchema_StringField{},
-					},
-					Placeholder: "John08",
-					Order:       1,
-				},
-				"email": {
-					DisplayName: "Email",
-					Required:    true,
-					Description: "Email address of the user",
-					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
-						StringField: &v2.ConnectorAccountCreationSchema_StringField{},
-					},
-					Placeholder: "user@example.com",
-					Order:       2,
-				},
-				"first_name": {
-					DisplayName: "First Name",
-					Required:    true,
-					Description: "User's first name",
-					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
-						StringField: &v2.ConnectorAccountCreationSchema_StringField{},
-					},
-					Placeholder: "John",
-					Order:       3,
-				},
-				"last_name": {
-					DisplayName: "Last Name",
-					Required:    true,
-					Description: "User's last name",
-					Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
-						StringField: &v2.ConnectorAccountCreationSchema_StringField{},
-					},
-					Placeholder: "Travolta",
-					Order:       4,
-				},
-			},
-		},
+		DisplayName:           "ServiceNow",
+		Description:           "Connector to sync users to ServiceNow",
+		AccountCreationSchema: accountCreationSchema(s.client.CustomUserFields),
 	}, nil
 }
 
-// Validates that we have credentials and an endpoint. Does not validate that the credentials have all of the correct permissions.
+// Validate checks that the account can read every table sync needs for the
+// features turned on and, for the capabilities in the preflight scope, reach
+// what provisioning and ticketing use. A failure returns the whole
+// *PreflightReport, so every missing ACL shows up at once rather than one
+// per run; warnings are only logged.
 func (s *ServiceNow) Validate(ctx context.Context) (annotations.Annotations, error) {
-	pagination := servicenow.KeysetPaginationVars{
-		Limit: 1,
+	report, annos := s.Preflight(ctx)
+	if len(report.Failed()) > 0 {
+		return annos, fmt.Errorf("baton-servicenow: %w", report)
 	}
 
-	_, _, annos, err := s.client.GetUsers(ctx, pagination)
-	if err != nil {
-		return annos, fmt.Errorf("baton-servicenow: current user is not able to list users: %w", err)
+	return annos, nil
+}
+
+// Option configures New.
+type Option func(o *options)
+
+type options struct {
+	preflight  PreflightScope
+	fixtureDir string
+	clientOpts []servicenow.ClientOption
+}
+
+// WithPreflight scopes Validate's access checks to the capabilities turned
+// on; without it, only sync is checked.
+func WithPreflight(scope PreflightScope) Option {
+	return func(o *options) {
+		o.preflight = scope
 	}
+}
 
-	return annos, nil
+// WithFixtureRecording records every API round trip, sanitized, into dir.
+// An empty dir records nothing.
+func WithFixtureRecording(dir string) Option {
+	return func(o *options) {
+		o.fixtureDir = dir
+	}
+}
+
+// WithClientOptions passes opts through to servicenow.NewClient, after any
+// passed before.
+func WithClientOptions(opts ...servicenow.ClientOption) Option {
+	return func(o *options) {
+		o.clientOpts = append(o.clientOpts, opts...)
+	}
 }
 
 // New returns the ServiceNow connector.
 func New(
 	ctx context.Context, auth string, deployment string, ticketSchemaFilters map[string]string,
-	allowedDomains []string, customUserFields []string, baseURL string, insecure bool,
+	allowedDomains []string, customUserFields []string, baseURL string, insecure bool, opts ...Option,
 ) (*ServiceNow, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	uhttpOpts := []uhttp.Option{uhttp.WithLogger(true, ctxzap.Extract(ctx))}
 	if insecure {
 		uhttpOpts = append(uhttpOpts, uhttp.WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true})) //nolint:gosec // G402: intentional for testing with self-signed certs
@@ -128,6 +196,13 @@ func New(
 	if err != nil {
 		return nil, err
 	}
+	if o.fixtureDir != "" {
+		recorder, err := fixture.NewRecorder(httpClient.Transport, o.fixtureDir, customUserFields...)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = recorder
+	}
 
 	// BaseHttpClient is what makes uhttp's DoOptions (notably
 	// WithRatelimitData) available to the client layer.
@@ -136,12 +211,13 @@ func New(
 		return nil, err
 	}
 
-	servicenowClient, err := servicenow.NewClient(baseHttpClient, auth, deployment, ticketSchemaFilters, allowedDomains, customUserFields, baseURL)
+	servicenowClient, err := servicenow.NewClient(baseHttpClient, auth, deployment, ticketSchemaFilters, allowedDomains, customUserFields, baseURL, o.clientOpts...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ServiceNow{
-		client: servicenowClient,
+		client:    servicenowClient,
+		preflight: o.preflight,
 	}, nil
 }
@@ -0,0 +1,1079 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	sdkTicket "github.com/conductorone/baton-sdk/pkg/types/ticket"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow/fake"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type syncResult struct {
+	resources    map[string]*v2.Resource // by resource id
+	entitlements map[string]*v2.Entitlement
+	grants       []string // "entitlement id -> principal type:id"
+}
+
+// newTestConnector returns a connector for the fake instance at baseURL.
+// Retries are off, so a failing request fails the test at once.
+func newTestConnector(t *testing.T, ctx context.Context, baseURL string, allowedDomains []string, opts ...Option) *ServiceNow {
+	t.Helper()
+	s, err := New(ctx, "Basic dGVzdDp0ZXN0", "dev0", nil, allowedDomains, nil, baseURL, false,
+		append([]Option{WithClientOptions(servicenow.WithRetryPolicy(servicenow.RetryPolicy{}))}, opts...)...,
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+// syncAll drives every resource syncer through all of its pages, the way
+// the SDK does during a full sync, listing child resources under each
+// resource that declares them.
+func syncAll(t *testing.T, ctx context.Context, s *ServiceNow) syncResult {
+	t.Helper()
+	result := syncResult{
+		resources:    make(map[string]*v2.Resource),
+		entitlements: make(map[string]*v2.Entitlement),
+	}
+
+	syncers := make(map[string]connectorbuilder.ResourceSyncer)
+	var resources []*v2.Resource
+	for _, syncer := range s.ResourceSyncers(ctx) {
+		syncers[syncer.ResourceType(ctx).Id] = syncer
+		resources = append(resources, listAll(t, ctx, syncer, nil)...)
+	}
+	for i := 0; i < len(resources); i++ {
+		for _, a := range resources[i].Annotations {
+			child := &v2.ChildResourceType{}
+			if a.MessageIs(child) {
+				if err := a.UnmarshalTo(child); err != nil {
+					t.Fatalf("ChildResourceType: %v", err)
+				}
+				resources = append(resources, listAll(t, ctx, syncers[child.ResourceTypeId], resources[i].Id)...)
+			}
+		}
+	}
+
+	for _, resource := range resources {
+		result.resources[resource.Id.Resource] = resource
+		syncer := syncers[resource.Id.ResourceType]
+
+		entitlements, _, _, err := syncer.Entitlements(ctx, resource, &pagination.Token{})
+		if err != nil {
+			t.Fatalf("%s Entitlements: %v", resource.Id.Resource, err)
+		}
+		for _, e := range entitlements {
+			result.entitlements[e.Id] = e
+		}
+
+		token := ""
+		for {
+			grants, next, _, err := syncer.Grants(ctx, resource, &pagination.Token{Token: token})
+			if err != nil {
+				t.Fatalf("%s Grants: %v", resource.Id.Resource, err)
+			}
+			for _, g := range grants {
+				result.grants = append(result.grants, g.Entitlement.Id+" -> "+g.Principal.Id.ResourceType+":"+g.Principal.Id.Resource)
+			}
+			if token = next; token == "" {
+				break
+			}
+		}
+	}
+
+	sort.Strings(result.grants)
+	return result
+}
+
+// listAll lists every page of one syncer's resources under parent.
+func listAll(t *testing.T, ctx context.Context, syncer connectorbuilder.ResourceSyncer, parent *v2.ResourceId) []*v2.Resource {
+	t.Helper()
+	var resources []*v2.Resource
+	token := ""
+	for {
+		page, next, _, err := syncer.List(ctx, parent, &pagination.Token{Token: token})
+		if err != nil {
+			t.Fatalf("%s List: %v", syncer.ResourceType(ctx).Id, err)
+		}
+		resources = append(resources, page...)
+		if token = next; token == "" {
+			return resources
+		}
+	}
+}
+
+func assertGrants(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("grants:\n%v\nwant:\n%v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("grants:\n%v\nwant:\n%v", got, want)
+		}
+	}
+}
+
+// TestSyncThenProvisionAgainstFakeInstance runs the connector end to end
+// against the in-memory instance through the base URL override: validate,
+// sync, provision a membership, revoke it, and file a ticket.
+func TestSyncThenProvisionAgainstFakeInstance(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-admin", "user_name": "admin", "email": "admin@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-bob", "user_name": "bob", "email": "bob@other.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-carol", "user_name": "carol", "email": "carol@example.com", "active": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-admin", "name": "admin", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-internal", "name": "internal", "grantable": "false"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-apollo", "name": "Apollo"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-restricted", "name": "Restricted"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-alice", "group": "g-apollo"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-bob", "group": "g-apollo"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-admin", "role": "r-admin", "inherited": "false"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-itil", "inherited": "false"})
+	instance.Insert("sys_group_has_role", fake.Record{"group": "g-apollo", "role": "r-itil", "inherits": "true"})
+	// The sync account can't see the Restricted group.
+	instance.HideRows("sys_user_group", func(row fake.Record) bool { return row["name"] == "Restricted" })
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"}, WithPreflight(PreflightScope{Provisioning: true, Ticketing: true}))
+
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	synced := syncAll(t, ctx, s)
+	if _, ok := synced.resources["u-bob"]; ok {
+		t.Error("bob is outside the allowed domains and shouldn't be synced")
+	}
+	if _, ok := synced.resources["g-restricted"]; ok {
+		t.Error("the Restricted group is hidden by an ACL and shouldn't be synced")
+	}
+	if _, ok := synced.resources["r-internal"]; ok {
+		t.Error("non-grantable roles shouldn't be synced")
+	}
+	assertGrants(t, synced.grants,
+		"group:g-apollo:member -> user:u-alice",
+		"role:r-admin:member -> user:u-admin",
+		"role:r-itil:member -> group:g-apollo",
+		"role:r-itil:member -> user:u-alice",
+	)
+
+	// Provision carol into Apollo, then take her back out.
+	groups := groupBuilder(s.client)
+	membership := synced.entitlements["group:g-apollo:member"]
+	if _, err := groups.Grant(ctx, synced.resources["u-carol"], membership); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	rows, _ := instance.Rows("sys_user_grmember", "user=u-carol^group=g-apollo")
+	if len(rows) != 1 {
+		t.Fatalf("after Grant, carol has %d Apollo memberships, want 1", len(rows))
+	}
+	assertGrants(t, syncAll(t, ctx, s).grants,
+		"group:g-apollo:member -> user:u-alice",
+		"group:g-apollo:member -> user:u-carol",
+		"role:r-admin:member -> user:u-admin",
+		"role:r-itil:member -> group:g-apollo",
+		"role:r-itil:member -> user:u-alice",
+	)
+
+	grant := &v2.Grant{Entitlement: membership, Principal: synced.resources["u-carol"]}
+	if _, err := groups.Revoke(ctx, grant); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if rows, _ := instance.Rows("sys_user_grmember", "user=u-carol"); len(rows) != 0 {
+		t.Fatalf("after Revoke, carol still has %d memberships", len(rows))
+	}
+
+	// File a ticket against a catalog item with one mandatory variable.
+	instance.Insert("sc_cat_item", fake.Record{"sys_id": "item-laptop", "name": "Laptop", "short_description": "Request a laptop"})
+	instance.Insert("item_option_new", fake.Record{
+		"cat_item": "item-laptop", "name": "model", "question_text": "Model",
+		"type": strconv.Itoa(int(servicenow.TypeSingleLineText)), "mandatory": "true", "order": "100",
+	})
+	instance.Insert("sys_choice", fake.Record{"name": "task", "element": "state", "language": "en", "inactive": "false", "label": "Open", "value": "1"})
+
+	schemas, _, _, err := s.ListTicketSchemas(ctx, &pagination.Token{Size: 10})
+	if err != nil {
+		t.Fatalf("ListTicketSchemas: %v", err)
+	}
+	if len(schemas) != 1 || schemas[0].Id != "item-laptop" || schemas[0].CustomFields["model"] == nil {
+		t.Fatalf("schemas = %v, want the laptop item with its model field", schemas)
+	}
+
+	ticket, _, err := s.CreateTicket(ctx, &v2.Ticket{
+		Description:  "New starter",
+		Labels:       []string{"onboarding"},
+		RequestedFor: synced.resources["u-carol"],
+		CustomFields: map[string]*v2.TicketCustomField{"model": sdkTicket.StringField("model", "X1")},
+	}, schemas[0])
+	if err != nil {
+		t.Fatalf("CreateTicket: %v", err)
+	}
+	if len(ticket.Labels) != 1 || ticket.Labels[0] != "onboarding" {
+		t.Errorf("ticket labels = %v, want [onboarding]", ticket.Labels)
+	}
+	items, _ := instance.Rows("sc_req_item", "cat_item=item-laptop")
+	if len(items) != 1 || items[0]["variables.model"] != "X1" || items[0]["requested_for"] != "u-carol" || items[0]["description"] != "New starter" {
+		t.Errorf("requested items = %v, want one for carol with model X1 and the ticket's description", items)
+	}
+}
+
+// TestSyncAndProvisionScopedToADomain scopes the connector to one customer's
+// domain of a domain-separated instance: that domain and the one below it
+// are synced, a sibling customer's users and groups aren't, and new groups
+// land in the configured domain.
+func TestSyncAndProvisionScopedToADomain(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("domain", fake.Record{"sys_id": "d-top", "name": "TOP"})
+	instance.Insert("domain", fake.Record{"sys_id": "d-acme", "name": "ACME", "parent": "d-top"})
+	instance.Insert("domain", fake.Record{"sys_id": "d-acme-eu", "name": "ACME EU", "parent": "d-acme"})
+	instance.Insert("domain", fake.Record{"sys_id": "d-globex", "name": "GLOBEX", "parent": "d-top"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-admin", "user_name": "admin", "active": "true", "sys_domain": "d-top"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "active": "true", "sys_domain": "d-acme"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-erik", "user_name": "erik", "active": "true", "sys_domain": "d-acme-eu"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-gina", "user_name": "gina", "active": "true", "sys_domain": "d-globex"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-hank", "user_name": "hank", "active": "true", "sys_domain": "d-globex"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-acme", "name": "ACME Service Desk", "sys_domain": "d-acme"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-globex", "name": "GLOBEX Service Desk", "sys_domain": "d-globex"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-alice", "group": "g-acme"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-gina", "group": "g-acme"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-gina", "group": "g-globex"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-itil", "inherited": "false"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-gina", "role": "r-itil", "inherited": "false"})
+	instance.Insert("sys_group_has_role", fake.Record{"group": "g-acme", "role": "r-itil", "inherits": "true"})
+	instance.Insert("sys_group_has_role", fake.Record{"group": "g-globex", "role": "r-itil", "inherits": "true"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithSysDomain("d-acme")))
+
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	synced := syncAll(t, ctx, s)
+	for _, id := range []string{"u-admin", "u-gina", "u-hank", "g-globex"} {
+		if _, ok := synced.resources[id]; ok {
+			t.Errorf("%s is outside the ACME domain and shouldn't be synced", id)
+		}
+	}
+	erik, ok := synced.resources["u-erik"]
+	if !ok {
+		t.Fatal("erik is in a domain below ACME and should be synced")
+	}
+	if domain, _ := rs.GetProfileStringValue(erik.GetProfile(), "domain"); domain != "d-acme-eu" {
+		t.Errorf("erik's profile domain = %q, want d-acme-eu", domain)
+	}
+	assertGrants(t, synced.grants,
+		"group:g-acme:member -> user:u-alice",
+		"role:r-itil:member -> group:g-acme",
+		"role:r-itil:member -> user:u-alice",
+	)
+
+	groups := groupBuilder(s.client)
+	membership := synced.entitlements["group:g-acme:member"]
+	if _, err := groups.Grant(ctx, erik, membership); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	// hank wasn't synced, but a grant naming him must still be refused.
+	hank := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "u-hank"}}
+	if _, err := groups.Grant(ctx, hank, membership); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Grant to a GLOBEX user: err = %v, want PermissionDenied", err)
+	}
+
+	if _, _, err := groups.Create(ctx, &v2.Resource{DisplayName: "ACME Network"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	rows, _ := instance.Rows("sys_user_group", "name=ACME Network")
+	if len(rows) != 1 || rows[0]["sys_domain"] != "d-acme" {
+		t.Errorf("created groups = %v, want one in d-acme", rows)
+	}
+
+	// Revokes and deletes remove rows by sys_id, so a GLOBEX principal or
+	// group is refused before any row goes.
+	gina := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "u-gina"}}
+	if _, err := groups.Revoke(ctx, &v2.Grant{Entitlement: membership, Principal: gina}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Revoke a GLOBEX user's membership: err = %v, want PermissionDenied", err)
+	}
+	itil := &v2.Grant{Entitlement: synced.entitlements["role:r-itil:member"], Principal: gina}
+	if _, err := roleBuilder(s.client).Revoke(ctx, itil); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Revoke a GLOBEX user's role: err = %v, want PermissionDenied", err)
+	}
+	if _, err := groups.Delete(ctx, &v2.ResourceId{ResourceType: resourceTypeGroup.Id, Resource: "g-globex"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Delete the GLOBEX group: err = %v, want PermissionDenied", err)
+	}
+	for _, c := range []struct {
+		table string
+		query string
+		want  int
+	}{
+		{"sys_user_group", "sys_id=g-globex", 1},
+		{"sys_user_grmember", "user=u-gina", 2},
+		{"sys_user_has_role", "user=u-gina", 1},
+		{"sys_group_has_role", "group=g-globex", 1},
+	} {
+		if rows, _ := instance.Rows(c.table, c.query); len(rows) != c.want {
+			t.Errorf("%s rows where %s = %d, want the %d left alone", c.table, c.query, len(rows), c.want)
+		}
+	}
+}
+
+// TestSyncScopedApplications lists every role at the top level by default
+// and, with applications synced, each scoped application with its roles as
+// children and its creator in its profile; global roles stay top-level.
+func TestSyncScopedApplications(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_scope", fake.Record{"sys_id": "global", "name": "Global", "scope": "global"})
+	instance.Insert("sys_scope", fake.Record{
+		"sys_id": "app-hr", "name": "HR Onboarding", "scope": "x_acme_hr", "version": "1.2.0",
+		"sys_class_name": "sys_app", "active": "true", "sys_created_by": "alice",
+	})
+	instance.Insert("sys_scope", fake.Record{"sys_id": "app-store", "name": "Store App", "scope": "sn_store", "sys_created_by": "system"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "active": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-hr-admin", "name": "x_acme_hr.admin", "grantable": "true", "sys_scope": "app-hr"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-hr-admin", "inherited": "false"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	synced := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, nil))
+	if _, ok := synced.resources["app-hr"]; ok {
+		t.Error("applications shouldn't be synced unless enabled")
+	}
+	if parent := synced.resources["r-hr-admin"].GetParentResourceId(); parent != nil {
+		t.Errorf("x_acme_hr.admin parent = %v, want none with applications off", parent)
+	}
+
+	synced = syncAll(t, ctx, newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithApplications(true))))
+	if _, ok := synced.resources["global"]; ok {
+		t.Error("the global scope isn't an application and shouldn't be synced")
+	}
+	if parent := synced.resources["r-hr-admin"].GetParentResourceId(); parent.GetResource() != "app-hr" {
+		t.Errorf("x_acme_hr.admin parent = %v, want the HR Onboarding application", parent)
+	}
+	if parent := synced.resources["r-itil"].GetParentResourceId(); parent != nil {
+		t.Errorf("itil parent = %v, want none", parent)
+	}
+	if scope, _ := rs.GetProfileStringValue(synced.resources["app-hr"].GetProfile(), "scope"); scope != "x_acme_hr" {
+		t.Errorf("HR Onboarding scope = %q, want x_acme_hr", scope)
+	}
+	if createdBy, _ := rs.GetProfileStringValue(synced.resources["app-hr"].GetProfile(), "created_by"); createdBy != "alice" {
+		t.Errorf("HR Onboarding created_by = %q, want alice", createdBy)
+	}
+	assertGrants(t, synced.grants,
+		"role:r-hr-admin:member -> user:u-alice",
+	)
+}
+
+// TestGroupTypesAndProvisionableGroups syncs a group's type, status, email
+// and cost center into its profile, and keeps members from being added to
+// groups whose type isn't provisionable once the types are narrowed.
+func TestGroupTypesAndProvisionableGroups(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "active": "true"})
+	instance.Insert("sys_user_group_type", fake.Record{"sys_id": "t-itil", "name": "itil"})
+	instance.Insert("cmn_cost_center", fake.Record{"sys_id": "cc-ops", "name": "Operations"})
+	instance.Insert("sys_user_group", fake.Record{
+		"sys_id": "g-service-desk", "name": "Service Desk", "type": "t-itil", "active": "true",
+		"email": "servicedesk@example.com", "cost_center": "cc-ops",
+	})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-apollo", "name": "Apollo", "active": "true"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	// By default every type is provisionable.
+	s := newTestConnector(t, ctx, server.URL, nil)
+	synced := syncAll(t, ctx, s)
+	annos := annotations.Annotations(synced.entitlements["group:g-service-desk:member"].GetAnnotations())
+	if annos.Contains(&v2.EntitlementImmutable{}) {
+		t.Error("an itil group's membership should be provisionable by default")
+	}
+
+	s = newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithProvisionableGroupTypes([]string{})))
+	synced = syncAll(t, ctx, s)
+	profile := synced.resources["g-service-desk"].GetProfile()
+	for key, want := range map[string]string{
+		"type": "t-itil", "type_names": "itil", "active": "true",
+		"email": "servicedesk@example.com", "cost_center": "cc-ops", "cost_center_name": "Operations",
+	} {
+		if got, _ := rs.GetProfileStringValue(profile, key); got != want {
+			t.Errorf("Service Desk profile[%s] = %q, want %q", key, got, want)
+		}
+	}
+
+	immutable := func(id string) bool {
+		annos := annotations.Annotations(synced.entitlements[id].GetAnnotations())
+		return annos.Contains(&v2.EntitlementImmutable{})
+	}
+	if !immutable("group:g-service-desk:member") {
+		t.Error("an itil group's membership should be immutable unless itil is provisionable")
+	}
+	if immutable("group:g-apollo:member") {
+		t.Error("a group without a type should always be provisionable")
+	}
+
+	groups := groupBuilder(s.client)
+	if _, err := groups.Grant(ctx, synced.resources["u-alice"], synced.entitlements["group:g-service-desk:member"]); err == nil {
+		t.Error("Grant into an itil group should fail unless itil is provisionable")
+	}
+	if _, err := groups.Grant(ctx, synced.resources["u-alice"], synced.entitlements["group:g-apollo:member"]); err != nil {
+		t.Fatalf("Grant into Apollo: %v", err)
+	}
+
+	s = newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithProvisionableGroupTypes([]string{"itil"})))
+	if _, err := groupBuilder(s.client).Grant(ctx, synced.resources["u-alice"], synced.entitlements["group:g-service-desk:member"]); err != nil {
+		t.Fatalf("Grant into an itil group with itil provisionable: %v", err)
+	}
+	assertGrants(t, syncAll(t, ctx, s).grants,
+		"group:g-apollo:member -> user:u-alice",
+		"group:g-service-desk:member -> user:u-alice",
+	)
+}
+
+// TestEffectiveRoles resolves a user's roles with how each is held, through
+// the user action and as a profile enrichment during sync.
+func TestEffectiveRoles(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "active": "true"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-it", "name": "IT Admins"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-admin", "name": "admin", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-security", "name": "security_admin", "grantable": "false"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-itil", "inherited": "false"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-admin", "inherited": "true", "granted_by": "g-it"})
+	instance.Insert("sys_user_has_role", fake.Record{
+		"user": "u-alice", "role": "r-security", "inherited": "true", "granted_by": "g-it", "included_in_role": "r-admin",
+	})
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithEffectiveRoles(true)))
+
+	wantRoles := []string{"admin", "itil", "security_admin"}
+	wantPaths := []string{
+		"admin: group IT Admins",
+		"itil: direct",
+		"security_admin: role admin, group IT Admins",
+	}
+
+	resourceId, err := structpb.NewValue(map[string]interface{}{"resource_type_id": resourceTypeUser.Id, "resource_id": "u-alice"})
+	if err != nil {
+		t.Fatalf("NewValue: %v", err)
+	}
+	result, _, err := userBuilder(s.client).getEffectiveRoles(ctx, &structpb.Struct{Fields: map[string]*structpb.Value{"resource": resourceId}})
+	if err != nil {
+		t.Fatalf("getEffectiveRoles: %v", err)
+	}
+	stringList := func(v *structpb.Value) []string {
+		var rv []string
+		for _, item := range v.GetListValue().GetValues() {
+			rv = append(rv, item.GetStringValue())
+		}
+		return rv
+	}
+	if got := stringList(result.Fields["roles"]); strings.Join(got, "\n") != strings.Join(wantRoles, "\n") {
+		t.Errorf("roles = %q, want %q", got, wantRoles)
+	}
+	if got := stringList(result.Fields["paths"]); strings.Join(got, "\n") != strings.Join(wantPaths, "\n") {
+		t.Errorf("paths = %q, want %q", got, wantPaths)
+	}
+
+	profile := syncAll(t, ctx, s).resources["u-alice"].GetProfile()
+	if got, _ := rs.GetProfileStringValue(profile, "effective_roles"); got != "admin,itil,security_admin" {
+		t.Errorf("profile effective_roles = %q, want admin,itil,security_admin", got)
+	}
+	if got := stringList(profile.GetFields()["effective_role_paths"]); strings.Join(got, "\n") != strings.Join(wantPaths, "\n") {
+		t.Errorf("profile effective_role_paths = %q, want %q", got, wantPaths)
+	}
+}
+
+// TestSyncSubscriptions syncs subscriptions, when enabled, with a grant per
+// allocated user the sync lists and the seat counts on the license trait.
+func TestSyncSubscriptions(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-bob", "user_name": "bob", "email": "bob@other.com", "active": "true"})
+	instance.Insert("license_details", fake.Record{"sys_id": "lic-itsm", "name": "ITSM Fulfiller", "count": "10", "allocated": "2"})
+	instance.Insert("license_has_user", fake.Record{"license": "lic-itsm", "user": "u-alice"})
+	instance.Insert("license_has_user", fake.Record{"license": "lic-itsm", "user": "u-bob"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	if _, ok := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, []string{"example.com"})).resources["lic-itsm"]; ok {
+		t.Error("subscriptions shouldn't be synced unless enabled")
+	}
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"}, WithClientOptions(servicenow.WithSubscriptions(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	synced := syncAll(t, ctx, s)
+	trait, err := rs.GetLicenseProfileTrait(synced.resources["lic-itsm"])
+	if err != nil {
+		t.Fatalf("GetLicenseProfileTrait: %v", err)
+	}
+	if trait.GetPurchasedSeats() != 10 || trait.GetConsumedSeats() != 2 {
+		t.Errorf("seats = %d purchased, %d consumed, want 10 and 2", trait.GetPurchasedSeats(), trait.GetConsumedSeats())
+	}
+	assertGrants(t, synced.grants,
+		"subscription:lic-itsm:member -> user:u-alice",
+	)
+}
+
+// TestSyncUserCriteria syncs user criteria, when enabled, with a grant per
+// listed user and group the sync lists, and the knowledge bases and catalog
+// items each applies to in its profile.
+func TestSyncUserCriteria(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-bob", "user_name": "bob", "email": "bob@other.com", "active": "true"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-hr", "name": "HR"})
+	instance.Insert("user_criteria", fake.Record{
+		"sys_id": "uc-hr", "name": "HR staff", "active": "true", "match_all": "false",
+		"user": "u-alice,u-bob", "group": "g-hr", "role": "r-hr-agent",
+	})
+	instance.Insert("kb_knowledge_base", fake.Record{"sys_id": "kb-hr", "title": "HR Policies"})
+	instance.Insert("kb_knowledge_base", fake.Record{"sys_id": "kb-it", "title": "IT"})
+	instance.Insert("sc_cat_item", fake.Record{"sys_id": "item-payslip", "name": "Payslip copy"})
+	instance.Insert("kb_uc_can_read_mtom", fake.Record{"user_criteria": "uc-hr", "kb_knowledge_base": "kb-hr"})
+	instance.Insert("kb_uc_cannot_read_mtom", fake.Record{"user_criteria": "uc-hr", "kb_knowledge_base": "kb-it"})
+	instance.Insert("sc_cat_item_user_criteria_mtom", fake.Record{"user_criteria": "uc-hr", "sc_cat_item": "item-payslip"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	if _, ok := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, []string{"example.com"})).resources["uc-hr"]; ok {
+		t.Error("user criteria shouldn't be synced unless enabled")
+	}
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"}, WithClientOptions(servicenow.WithUserCriteria(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	synced := syncAll(t, ctx, s)
+	profile := synced.resources["uc-hr"].GetProfile().AsMap()
+	for key, want := range map[string][]interface{}{
+		"knowledge_bases_can_read":       {"HR Policies"},
+		"knowledge_bases_can_contribute": {},
+		"knowledge_bases_cannot_read":    {"IT"},
+		"catalog_items_available":        {"Payslip copy"},
+		"catalog_items_not_available":    {},
+	} {
+		got, _ := profile[key].([]interface{})
+		if len(got) != len(want) || (len(want) > 0 && got[0] != want[0]) {
+			t.Errorf("HR staff profile[%s] = %v, want %v", key, got, want)
+		}
+	}
+	if roles := profile["roles"]; roles != "r-hr-agent" {
+		t.Errorf("HR staff profile[roles] = %v, want r-hr-agent", roles)
+	}
+	// bob's email domain isn't allowed, so he isn't synced or granted.
+	assertGrants(t, synced.grants,
+		"user_criteria:uc-hr:member -> group:g-hr",
+		"user_criteria:uc-hr:member -> user:u-alice",
+	)
+}
+
+// TestSyncCMDB syncs business applications and services, when enabled,
+// with their owner, manager and support group as grants, leaving out
+// principals the sync doesn't list.
+func TestSyncCMDB(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-bob", "user_name": "bob", "email": "bob@other.com", "active": "true"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-payroll", "name": "Payroll Support"})
+	instance.Insert("cmdb_ci_business_app", fake.Record{
+		"sys_id": "ba-payroll", "name": "Payroll", "number": "APM0001", "sys_class_name": "cmdb_ci_business_app",
+		"owned_by": "u-alice", "managed_by": "u-bob", "support_group": "g-payroll", "business_criticality": "1 - most critical",
+	})
+	instance.Insert("cmdb_ci_service", fake.Record{
+		"sys_id": "bs-email", "name": "Email", "sys_class_name": "cmdb_ci_service",
+		"managed_by": "u-alice", "operational_status": "1",
+	})
+
+	server := instance.Start()
+	defer server.Close()
+
+	if _, ok := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, []string{"example.com"})).resources["ba-payroll"]; ok {
+		t.Error("CMDB CIs shouldn't be synced unless enabled")
+	}
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"}, WithClientOptions(servicenow.WithCMDB(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	synced := syncAll(t, ctx, s)
+	if got := synced.resources["ba-payroll"].GetId().GetResourceType(); got != "business_application" {
+		t.Errorf("Payroll resource type = %q, want business_application", got)
+	}
+	if got := synced.resources["bs-email"].GetId().GetResourceType(); got != "business_service" {
+		t.Errorf("Email resource type = %q, want business_service", got)
+	}
+	if criticality, _ := rs.GetProfileStringValue(synced.resources["ba-payroll"].GetProfile(), "business_criticality"); criticality != "1 - most critical" {
+		t.Errorf("Payroll business_criticality = %q, want 1 - most critical", criticality)
+	}
+	// bob's email domain isn't allowed, so he isn't synced and his
+	// management of Payroll isn't a grant.
+	assertGrants(t, synced.grants,
+		"business_application:ba-payroll:owner -> user:u-alice",
+		"business_application:ba-payroll:support_group -> group:g-payroll",
+		"business_service:bs-email:manager -> user:u-alice",
+	)
+}
+
+// TestSyncHRSD syncs HR roles and the groups holding them when HR Service
+// Delivery is installed, and skips both when the instance says its tables
+// don't exist.
+func TestSyncHRSD(t *testing.T) {
+	ctx := context.Background()
+
+	newInstance := func() *fake.Server {
+		instance := fake.New("u-admin")
+		instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+		instance.Insert("sys_user", fake.Record{"sys_id": "u-carol", "user_name": "carol", "email": "carol@example.com", "active": "true"})
+		instance.Insert("sys_user_group", fake.Record{"sys_id": "g-hr", "name": "HR Agents", "active": "true"})
+		instance.Insert("sys_user_group", fake.Record{"sys_id": "g-it", "name": "IT", "active": "true"})
+		instance.Insert("sys_user_grmember", fake.Record{"user": "u-carol", "group": "g-hr"})
+		instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+		instance.Insert("sys_user_role", fake.Record{"sys_id": "r-case-reader", "name": "sn_hr_core.case_reader", "grantable": "false"})
+		instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-case-reader", "inherited": "false"})
+		instance.Insert("sys_group_has_role", fake.Record{"group": "g-hr", "role": "r-case-reader"})
+		instance.Insert("sys_group_has_role", fake.Record{"group": "g-it", "role": "r-itil"})
+		return instance
+	}
+	installed := newInstance()
+	installed.Insert("sn_hr_core_profile", fake.Record{"sys_id": "p-alice", "user": "u-alice"})
+	server := installed.Start()
+	defer server.Close()
+
+	if _, ok := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, []string{"example.com"})).resources["r-case-reader"]; ok {
+		t.Error("HR roles shouldn't be synced unless enabled")
+	}
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"}, WithClientOptions(servicenow.WithHRSD(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	synced := syncAll(t, ctx, s)
+	if got := synced.resources["r-case-reader"].GetId().GetResourceType(); got != "hr_role" {
+		t.Errorf("case_reader resource type = %q, want hr_role", got)
+	}
+	if hrRoles, _ := rs.GetProfileStringValue(synced.resources["g-hr"].GetProfile(), "hr_roles"); hrRoles != "sn_hr_core.case_reader" {
+		t.Errorf("HR Agents hr_roles = %q, want sn_hr_core.case_reader", hrRoles)
+	}
+	if _, ok := synced.entitlements["hr_group:g-it:member"]; ok {
+		t.Error("IT holds no HR role, so it isn't an HR group")
+	}
+	assertGrants(t, synced.grants,
+		"group:g-hr:member -> user:u-carol",
+		"hr_group:g-hr:member -> user:u-carol",
+		"hr_role:r-case-reader:member -> group:g-hr",
+		"hr_role:r-case-reader:member -> user:u-alice",
+		"role:r-itil:member -> group:g-it",
+	)
+
+	missing := newInstance()
+	missing.Uninstall("sn_hr_core_profile")
+	missingServer := missing.Start()
+	defer missingServer.Close()
+
+	s = newTestConnector(t, ctx, missingServer.URL, []string{"example.com"}, WithClientOptions(servicenow.WithHRSD(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate without HR Service Delivery: %v", err)
+	}
+	synced = syncAll(t, ctx, s)
+	for id, resource := range synced.resources {
+		if rt := resource.GetId().GetResourceType(); rt == "hr_role" || rt == "hr_group" {
+			t.Errorf("%s synced as %s without HR Service Delivery", id, rt)
+		}
+	}
+}
+
+// TestSyncHRSDGroupsInPages lists more HR groups than one request names,
+// a page of sys_ids at a time.
+func TestSyncHRSDGroupsInPages(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sn_hr_core_profile", fake.Record{"sys_id": "p-1"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-case-reader", "name": "sn_hr_core.case_reader", "grantable": "false"})
+	const groups = 2*hrGroupsPerPage + 1
+	for i := 0; i < groups; i++ {
+		id := "g-hr-" + strconv.Itoa(i)
+		instance.Insert("sys_user_group", fake.Record{"sys_id": id, "name": "HR " + strconv.Itoa(i)})
+		instance.Insert("sys_group_has_role", fake.Record{"group": id, "role": "r-case-reader"})
+	}
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithHRSD(true)))
+
+	listed := listAll(t, ctx, hrGroupBuilder(s.client), nil)
+	if len(listed) != groups {
+		t.Errorf("listed %d HR groups, want %d", len(listed), groups)
+	}
+	groupRequests := 0
+	for _, request := range instance.Requests() {
+		if strings.HasSuffix(request, "/sys_user_group") {
+			groupRequests++
+		}
+	}
+	if groupRequests != 3 {
+		t.Errorf("sys_user_group requests = %d, want 3 pages of at most %d", groupRequests, hrGroupsPerPage)
+	}
+}
+
+// TestSyncACLs syncs active ACLs with a grant to each synced role they
+// require, and their table, field, operation and condition in the profile.
+func TestSyncACLs(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-internal", "name": "snc_internal", "grantable": "false"})
+	instance.Insert("sys_security_operation", fake.Record{"sys_id": "op-read", "name": "read"})
+	instance.Insert("sys_security_operation", fake.Record{"sys_id": "op-write", "name": "write"})
+	instance.Insert("sys_security_type", fake.Record{"sys_id": "t-record", "name": "record"})
+	instance.Insert("sys_security_acl", fake.Record{
+		"sys_id": "acl-incident-read", "name": "incident", "active": "true", "operation": "op-read", "type": "t-record",
+		"condition": "active=true", "admin_overrides": "true",
+	})
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-number-write", "name": "incident.number", "active": "true", "operation": "op-write", "type": "t-record"})
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-old", "name": "problem", "active": "false", "operation": "op-read", "type": "t-record"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-incident-read", "sys_user_role": "r-itil"})
+	// snc_internal isn't grantable, so it isn't synced and isn't granted.
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-incident-read", "sys_user_role": "r-internal"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-number-write", "sys_user_role": "r-itil"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-old", "sys_user_role": "r-itil"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	if _, ok := syncAll(t, ctx, newTestConnector(t, ctx, server.URL, nil)).resources["acl-incident-read"]; ok {
+		t.Error("ACLs shouldn't be synced unless enabled")
+	}
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithClientOptions(servicenow.WithACLs(true)))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	synced := syncAll(t, ctx, s)
+	if _, ok := synced.resources["acl-old"]; ok {
+		t.Error("inactive ACL was synced")
+	}
+	read := synced.resources["acl-incident-read"]
+	if read.GetDisplayName() != "incident read" {
+		t.Errorf("ACL display name = %q, want incident read", read.GetDisplayName())
+	}
+	for key, want := range map[string]string{"table": "incident", "operation": "read", "type": "record", "condition": "active=true"} {
+		if got, _ := rs.GetProfileStringValue(read.GetProfile(), key); got != want {
+			t.Errorf("incident read ACL %s = %q, want %q", key, got, want)
+		}
+	}
+	if field, _ := rs.GetProfileStringValue(synced.resources["acl-number-write"].GetProfile(), "field"); field != "number" {
+		t.Errorf("incident.number write ACL field = %q, want number", field)
+	}
+	assertGrants(t, synced.grants,
+		"acl:acl-incident-read:access -> role:r-itil",
+		"acl:acl-number-write:access -> role:r-itil",
+	)
+}
+
+// TestSyncAndProvisionDelegations syncs a user's delegates as grants that
+// carry the delegation's window and scope, skips an expired delegation, and
+// grants and revokes a delegate.
+func TestSyncAndProvisionDelegations(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-admin", "user_name": "admin", "email": "admin@example.com", "active": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-admin", "name": "admin", "grantable": "true"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-admin", "role": "r-admin", "inherited": "false"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-bob", "user_name": "bob", "email": "bob@other.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-carol", "user_name": "carol", "email": "carol@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-dave", "user_name": "dave", "email": "dave@example.com", "active": "true"})
+	instance.Insert("sys_user_delegate", fake.Record{
+		"user": "u-alice", "delegate": "u-carol", "starts": "2024-01-01 00:00:00", "ends": "2999-01-01 00:00:00",
+		"approvals": "true", "assignments": "false", "notifications": "true", "invitations": "false",
+	})
+	instance.Insert("sys_user_delegate", fake.Record{"user": "u-alice", "delegate": "u-dave", "starts": "2024-01-01 00:00:00", "ends": "2024-02-01 00:00:00"})
+	// Bob isn't synced, so neither end of his delegation is granted.
+	instance.Insert("sys_user_delegate", fake.Record{"user": "u-bob", "delegate": "u-carol", "ends": "2999-01-01 00:00:00"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"},
+		WithPreflight(PreflightScope{Provisioning: true}),
+		WithClientOptions(servicenow.WithDelegationDuration(7*24*time.Hour)),
+	)
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	synced := syncAll(t, ctx, s)
+	assertGrants(t, synced.grants,
+		"role:r-admin:member -> user:u-admin",
+		"user:u-alice:delegate -> user:u-carol",
+	)
+
+	users := userBuilder(s.client)
+	grants, _, _, err := users.Grants(ctx, synced.resources["u-alice"], &pagination.Token{})
+	if err != nil || len(grants) != 1 {
+		t.Fatalf("Grants = %v, %v, want carol's delegation", grants, err)
+	}
+	metadata := &v2.GrantMetadata{}
+	grantAnnos := annotations.Annotations(grants[0].Annotations)
+	if ok, err := grantAnnos.Pick(metadata); !ok || err != nil {
+		t.Fatalf("grant has no metadata: %v", err)
+	}
+	fields := metadata.Metadata.GetFields()
+	if fields["ends"].GetStringValue() != "2999-01-01 00:00:00" || fields["assignments"].GetStringValue() != "false" {
+		t.Errorf("grant metadata = %v, want carol's window and scope", fields)
+	}
+
+	// Make dave a delegate again; his old delegation has ended.
+	delegate := synced.entitlements["user:u-alice:delegate"]
+	before := time.Now().UTC()
+	if _, err := users.Grant(ctx, synced.resources["u-dave"], delegate); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	rows, _ := instance.Rows("sys_user_delegate", "user=u-alice^delegate=u-dave")
+	if len(rows) != 2 {
+		t.Fatalf("after Grant, alice has %d delegations to dave, want 2", len(rows))
+	}
+	ends, err := time.Parse(time.DateTime, rows[1]["ends"])
+	if err != nil || ends.Before(before.Add(7*24*time.Hour-time.Minute)) || ends.After(before.Add(7*24*time.Hour+time.Minute)) {
+		t.Errorf("new delegation ends %q, want a week from now", rows[1]["ends"])
+	}
+	if rows[1]["approvals"] != "true" || rows[1]["invitations"] != "false" {
+		t.Errorf("new delegation = %v, want approvals without invitations", rows[1])
+	}
+	annos, err := users.Grant(ctx, synced.resources["u-dave"], delegate)
+	if err != nil || !annos.Contains(&v2.GrantAlreadyExists{}) {
+		t.Errorf("second Grant = %v, %v, want GrantAlreadyExists", annos, err)
+	}
+	assertGrants(t, syncAll(t, ctx, s).grants,
+		"role:r-admin:member -> user:u-admin",
+		"user:u-alice:delegate -> user:u-carol",
+		"user:u-alice:delegate -> user:u-dave",
+	)
+
+	grant := &v2.Grant{Entitlement: delegate, Principal: synced.resources["u-dave"]}
+	if _, err := users.Revoke(ctx, grant); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if rows, _ := instance.Rows("sys_user_delegate", "user=u-alice^delegate=u-dave"); len(rows) != 1 {
+		t.Errorf("after Revoke, alice has %d delegations to dave, want only the expired one", len(rows))
+	}
+	assertGrants(t, syncAll(t, ctx, s).grants,
+		"role:r-admin:member -> user:u-admin",
+		"user:u-alice:delegate -> user:u-carol",
+	)
+}
+
+// TestCreateAccountDeletesUserWithoutPassword makes the password PATCH
+// fail: the user just created is deleted again rather than left without
+// the password C1 was told about.
+func TestCreateAccountDeletesUserWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-admin", "user_name": "admin", "email": "admin@example.com", "active": "true"})
+	instance.Deny("sys_user", http.MethodPatch)
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"})
+
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"username":   "erin",
+		"email":      "erin@example.com",
+		"first_name": "Erin",
+		"last_name":  "Example",
+	})
+	if err != nil {
+		t.Fatalf("NewStruct: %v", err)
+	}
+	credentials := &v2.LocalCredentialOptions{
+		Options: &v2.LocalCredentialOptions_RandomPassword_{
+			RandomPassword: &v2.LocalCredentialOptions_RandomPassword{Length: 16},
+		},
+	}
+	if _, _, _, err := userBuilder(s.client).CreateAccount(ctx, &v2.AccountInfo{Profile: profile}, credentials); err == nil {
+		t.Fatal("CreateAccount: want an error when the password can't be set, got nil")
+	}
+	deleted := false
+	for _, request := range instance.Requests() {
+		deleted = deleted || strings.HasPrefix(request, "DELETE /now/table/sys_user/")
+	}
+	if !deleted {
+		t.Errorf("requests = %v, want the new user deleted", instance.Requests())
+	}
+	if rows, _ := instance.Rows("sys_user", "user_name=erin"); len(rows) != 0 {
+		t.Errorf("after the failed CreateAccount, erin has %d users, want none", len(rows))
+	}
+}
+
+// TestTimeBoundGrantsAndExpirySweep grants with a duration set for one
+// group: its expiry is recorded before the membership and synced as grant
+// metadata, a role without a duration is granted permanently, and the sweep
+// revokes what has expired, leaving permanent grants alone.
+func TestTimeBoundGrantsAndExpirySweep(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-admin")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-admin", "user_name": "admin", "email": "admin@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-carol", "user_name": "carol", "email": "carol@example.com", "active": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-admin", "name": "admin", "grantable": "true"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-itil", "name": "itil", "grantable": "true"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-apollo", "name": "Apollo"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-admin", "role": "r-admin", "inherited": "false"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-alice", "role": "r-itil", "inherited": "false"})
+	instance.Insert("sys_user_grmember", fake.Record{"user": "u-alice", "group": "g-apollo"})
+	// Alice's itil role expired, and C1 never revoked it.
+	instance.Insert("u_grant_expiry", fake.Record{"u_table": "sys_user_has_role", "u_user": "u-alice", "u_target": "r-itil", "u_expires": "2024-01-01 00:00:00"})
+	// An expiry whose grant was never made, or is already gone.
+	instance.Insert("u_grant_expiry", fake.Record{"u_table": "sys_user_grmember", "u_user": "u-carol", "u_target": "g-gone", "u_expires": "2024-01-01 00:00:00"})
+
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, []string{"example.com"},
+		WithPreflight(PreflightScope{Provisioning: true}),
+		WithClientOptions(servicenow.WithGrantExpiry("u_grant_expiry", map[string]time.Duration{"Apollo": 8 * time.Hour})),
+	)
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	synced := syncAll(t, ctx, s)
+	groups := groupBuilder(s.client)
+	before := time.Now().UTC()
+	if _, err := groups.Grant(ctx, synced.resources["u-carol"], synced.entitlements["group:g-apollo:member"]); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	rows, _ := instance.Rows("u_grant_expiry", "u_table=sys_user_grmember^u_user=u-carol^u_target=g-apollo")
+	if len(rows) != 1 {
+		t.Fatalf("after Grant, carol's Apollo membership has %d expiries, want 1", len(rows))
+	}
+	expires, err := time.Parse(time.DateTime, rows[0]["u_expires"])
+	if err != nil || expires.Before(before.Add(8*time.Hour-time.Minute)) || expires.After(before.Add(8*time.Hour+time.Minute)) {
+		t.Errorf("carol's membership expires %q, want 8 hours from now", rows[0]["u_expires"])
+	}
+	if _, err := roleBuilder(s.client).Grant(ctx, synced.resources["u-carol"], synced.entitlements["role:r-itil:member"]); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if rows, _ := instance.Rows("u_grant_expiry", "u_user=u-carol^u_target=r-itil"); len(rows) != 0 {
+		t.Errorf("after Grant, carol's itil role has %d expiries, want none", len(rows))
+	}
+
+	expiries := map[string]string{}
+	for _, resource := range []*v2.Resource{synced.resources["g-apollo"], synced.resources["r-itil"]} {
+		syncer := connectorbuilder.ResourceSyncer(groups)
+		if resource.Id.ResourceType == resourceTypeRole.Id {
+			syncer = roleBuilder(s.client)
+		}
+		token := ""
+		for {
+			grants, next, _, err := syncer.Grants(ctx, resource, &pagination.Token{Token: token})
+			if err != nil {
+				t.Fatalf("%s Grants: %v", resource.Id.Resource, err)
+			}
+			for _, g := range grants {
+				metadata := &v2.GrantMetadata{}
+				grantAnnos := annotations.Annotations(g.Annotations)
+				if ok, _ := grantAnnos.Pick(metadata); ok {
+					expiries[g.Entitlement.Id+" -> "+g.Principal.Id.Resource] = metadata.Metadata.GetFields()["expires"].GetStringValue()
+				}
+			}
+			if token = next; token == "" {
+				break
+			}
+		}
+	}
+	if len(expiries) != 2 || expiries["group:g-apollo:member -> u-carol"] != rows[0]["u_expires"] || expiries["role:r-itil:member -> u-alice"] != "2024-01-01 00:00:00" {
+		t.Errorf("grant expiries = %v, want carol's Apollo membership and alice's itil role", expiries)
+	}
+
+	result, _, err := s.revokeExpiredGrants(ctx, &structpb.Struct{})
+	if err != nil {
+		t.Fatalf("revokeExpiredGrants: %v", err)
+	}
+	if got := result.GetFields()["revoked"].GetNumberValue(); got != 1 {
+		t.Errorf("revoked = %v, want 1", got)
+	}
+	assertGrants(t, syncAll(t, ctx, s).grants,
+		"group:g-apollo:member -> user:u-alice",
+		"group:g-apollo:member -> user:u-carol",
+		"role:r-admin:member -> user:u-admin",
+		"role:r-itil:member -> user:u-carol",
+	)
+	if rows, _ := instance.Rows("u_grant_expiry", ""); len(rows) != 1 || rows[0]["u_user"] != "u-carol" {
+		t.Errorf("after the sweep, expiries = %v, want only carol's", rows)
+	}
+
+	grant := &v2.Grant{Entitlement: synced.entitlements["group:g-apollo:member"], Principal: synced.resources["u-carol"]}
+	if _, err := groups.Revoke(ctx, grant); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if rows, _ := instance.Rows("u_grant_expiry", ""); len(rows) != 0 {
+		t.Errorf("after Revoke, %d expiries are left, want none", len(rows))
+	}
+
+	// Deleting the group takes the expiries of its memberships with it.
+	if _, err := groups.Grant(ctx, synced.resources["u-carol"], synced.entitlements["group:g-apollo:member"]); err != nil {
+		t.Fatalf("Grant: %v", err)
+	}
+	if _, err := groups.Delete(ctx, synced.resources["g-apollo"].Id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if rows, _ := instance.Rows("u_grant_expiry", ""); len(rows) != 0 {
+		t.Errorf("after Delete, %d expiries are left, want none", len(rows))
+	}
+}
@@ -0,0 +1,205 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// userDelegate is the entitlement on a user that their delegates hold.
+const userDelegate = "delegate"
+
+// delegationIndex holds every unexpired delegation between synced users,
+// by delegating user. Listing sys_user_delegate once is far cheaper than a
+// request per user, and the table stays small: it only grows with
+// delegations people set up by hand. Grants and revokes reset it.
+type delegationIndex struct {
+	*tableIndex[string, []servicenow.Delegation]
+}
+
+func newDelegationIndex(client *servicenow.Client) *delegationIndex {
+	return &delegationIndex{newTableIndex(func(ctx context.Context) (map[string][]servicenow.Delegation, annotations.Annotations, error) {
+		now := time.Now()
+		byUser := make(map[string][]servicenow.Delegation)
+		annos, err := eachRow(ctx, func(ctx context.Context, page servicenow.KeysetPaginationVars) ([]servicenow.Delegation, string, annotations.Annotations, error) {
+			return client.GetDelegations(ctx, "", "", page)
+		}, func(row servicenow.Delegation) {
+			if !row.Expired(now) {
+				byUser[row.User] = append(byUser[row.User], row)
+			}
+		})
+		if status.Code(err) == codes.PermissionDenied {
+			// Delegates are an extra on users; an account that can't read
+			// them syncs users without.
+			ctxzap.Extract(ctx).Warn("baton-servicenow: can't read sys_user_delegate, skipping delegate grants", zap.Error(err))
+			return map[string][]servicenow.Delegation{}, annos, nil
+		}
+		return byUser, annos, err
+	})}
+}
+
+// forUser returns the unexpired delegations of userID.
+func (d *delegationIndex) forUser(ctx context.Context, userID string) ([]servicenow.Delegation, annotations.Annotations, error) {
+	byUser, annos, err := d.get(ctx)
+	return byUser[userID], annos, err
+}
+
+func (u *userResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewPermissionEntitlement(
+			resource,
+			userDelegate,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDisplayName(fmt.Sprintf("%s User %s", resource.DisplayName, userDelegate)),
+			ent.WithDescription(fmt.Sprintf("Acts for %s on approvals, assignments or notifications in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns a grant per delegate of the user. Each carries the
+// delegation's scope and time window as grant metadata.
+func (u *userResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	delegations, annos, err := u.delegations.forUser(ctx, resource.Id.Resource)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list delegates of user %s: %w", resource.Id.Resource, err)
+	}
+
+	var rv []*v2.Grant
+	for _, delegation := range delegations {
+		metadata, err := structpb.NewStruct(map[string]interface{}{
+			"starts":        delegation.Starts,
+			"ends":          delegation.Ends,
+			"approvals":     delegation.Approvals,
+			"assignments":   delegation.Assignments,
+			"notifications": delegation.Notifications,
+			"invitations":   delegation.Invitations,
+		})
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(
+			rv,
+			grant.NewGrant(
+				resource,
+				userDelegate,
+				&v2.ResourceId{
+					ResourceType: resourceTypeUser.Id,
+					Resource:     delegation.Delegate,
+				},
+				grant.WithAnnotation(&v2.GrantMetadata{Metadata: metadata}),
+			),
+		)
+	}
+
+	return rv, "", annos, nil
+}
+
+// Grant makes principal a delegate of the entitlement's user for approvals,
+// assignments and notifications, from now until the configured delegation
+// duration has passed.
+func (u *userResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if principal.Id.ResourceType != resourceTypeUser.Id {
+		l.Warn(
+			"baton-servicenow: only users can be made delegates",
+			zap.String("principal_type", principal.Id.ResourceType),
+			zap.String("principal_id", principal.Id.Resource),
+		)
+
+		return nil, fmt.Errorf("baton-servicenow: only users can be made delegates")
+	}
+
+	userID := entitlement.Resource.Id.Resource
+	existing, annos, err := u.client.GetActiveDelegations(ctx, userID, principal.Id.Resource)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to get delegates of user %s: %w", userID, err)
+	}
+	if len(existing) > 0 {
+		l.Warn(
+			"baton-servicenow: user is already a delegate",
+			zap.String("user", userID),
+			zap.String("delegate", principal.Id.Resource),
+		)
+
+		// Update, not annotations.New: the latter would discard the
+		// rate-limit annotation already in the bag.
+		annos.Update(&v2.GrantAlreadyExists{})
+		return annos, nil
+	}
+
+	now := time.Now().UTC()
+	createAnnos, err := u.client.CreateDelegation(ctx, servicenow.DelegationPayload{
+		User:          userID,
+		Delegate:      principal.Id.Resource,
+		Starts:        now.Format(time.DateTime),
+		Ends:          now.Add(u.client.DelegationDuration).Format(time.DateTime),
+		Approvals:     "true",
+		Assignments:   "true",
+		Notifications: "true",
+		Invitations:   "false",
+	})
+	annos = append(createAnnos, annos...)
+	u.delegations.reset()
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to make %s a delegate of user %s: %w", principal.Id.Resource, userID, err)
+	}
+
+	l.Debug("created delegation", zap.String("user", userID), zap.String("delegate", principal.Id.Resource))
+	return annos, nil
+}
+
+// Revoke removes every unexpired delegation of the entitlement's user to
+// the principal.
+func (u *userResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	userID := grant.Entitlement.Resource.Id.Resource
+	delegateID := grant.Principal.Id.Resource
+	var annos annotations.Annotations
+	for _, id := range []string{userID, delegateID} {
+		scopeAnnos, err := u.client.RequireUserInSysDomain(ctx, id)
+		annos = append(scopeAnnos, annos...)
+		if err != nil {
+			return annos, fmt.Errorf("baton-servicenow: cannot remove delegate %s of user %s: %w", delegateID, userID, err)
+		}
+	}
+	existing, delegationAnnos, err := u.client.GetActiveDelegations(ctx, userID, delegateID)
+	annos = append(delegationAnnos, annos...)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to get delegates of user %s: %w", userID, err)
+	}
+	if len(existing) == 0 {
+		l.Warn(
+			"baton-servicenow: cannot remove a delegation that doesn't exist",
+			zap.String("user", userID),
+			zap.String("delegate", delegateID),
+		)
+
+		annos.Update(&v2.GrantAlreadyRevoked{})
+		return annos, nil
+	}
+
+	removeAnnos, err := u.client.RemoveDelegations(ctx, sysIDs(existing, func(d servicenow.Delegation) string { return d.Id }))
+	annos = append(removeAnnos, annos...)
+	u.delegations.reset()
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to remove delegate %s of user %s: %w", delegateID, userID, err)
+	}
+
+	l.Debug("removed delegation", zap.String("user", userID), zap.String("delegate", delegateID), zap.Int("rows", len(existing)))
+	return annos, nil
+}
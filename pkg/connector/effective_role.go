@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const ActionGetEffectiveRoles = "get_effective_roles"
+
+var getEffectiveRolesAction = &v2.BatonActionSchema{
+	Name:        ActionGetEffectiveRoles,
+	DisplayName: "Get effective roles",
+	Description: "List every role a ServiceNow user holds and how: directly, through a group, or contained in another role",
+	Arguments: []*config.Field{
+		{
+			Name:        "resource",
+			DisplayName: "User",
+			Field:       &config.Field_ResourceIdField{},
+			IsRequired:  true,
+		},
+	},
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+		{
+			Name:        "roles",
+			DisplayName: "Effective roles",
+			Field:       &config.Field_StringSliceField{},
+		},
+		{
+			Name:        "paths",
+			DisplayName: "Inheritance paths",
+			Description: "One line per role assignment, such as \"itil: group Service Desk\"",
+			Field:       &config.Field_StringSliceField{},
+		},
+	},
+}
+
+func (u *userResourceType) getEffectiveRoles(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if args == nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: arguments cannot be nil")
+	}
+
+	resourceId, err := actions.RequireResourceIDArg(args, "resource")
+	if err != nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: %w", err)
+	}
+	if resourceId.ResourceType != resourceTypeUser.Id {
+		return nil, nil, fmt.Errorf("baton-servicenow: resource must be a user, got %s", resourceId.ResourceType)
+	}
+
+	roles, annos, err := u.client.GetEffectiveRoles(ctx, resourceId.Resource)
+	if err != nil {
+		l.Error("failed to get effective roles", zap.String("userId", resourceId.Resource), zap.Error(err))
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to get effective roles of user %s: %w", resourceId.Resource, err)
+	}
+
+	return actions.NewReturnValues(true,
+		actions.NewStringListReturnField("roles", effectiveRoleNames(roles)),
+		actions.NewStringListReturnField("paths", effectiveRolePaths(roles)),
+	), annos, nil
+}
+
+// effectiveRoleNames returns the names of the roles held, each once and
+// sorted.
+func effectiveRoleNames(roles []servicenow.EffectiveRole) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, orID(role.RoleName, role.Role))
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// effectiveRolePaths describes each assignment as "role: path", where the
+// path is direct, the group the role came through, or the role containing
+// it followed by that role's group, if any. A user holding a role several
+// ways has a line for each.
+func effectiveRolePaths(roles []servicenow.EffectiveRole) []string {
+	paths := make([]string, 0, len(roles))
+	for _, role := range roles {
+		var via []string
+		switch role.Path() {
+		case servicenow.RolePathRole:
+			via = append(via, "role "+orID(role.IncludedInName, role.IncludedIn))
+			if role.GrantedBy != "" {
+				via = append(via, "group "+orID(role.GrantedByName, role.GrantedBy))
+			}
+		case servicenow.RolePathGroup:
+			via = append(via, "group "+orID(role.GrantedByName, role.GrantedBy))
+		default:
+			via = append(via, servicenow.RolePathDirect)
+		}
+		paths = append(paths, orID(role.RoleName, role.Role)+": "+strings.Join(via, ", "))
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths)
+}
+
+// orID is name, or the sys_id when the name couldn't be read.
+func orID(name string, id string) string {
+	if name == "" {
+		return id
+	}
+	return name
+}
+
+// withEffectiveRoles adds the user's effective roles to a synced user's
+// profile, when that's turned on (see servicenow.WithEffectiveRoles).
+func (u *userResourceType) withEffectiveRoles(ctx context.Context, resource *v2.Resource) (annotations.Annotations, error) {
+	if !u.client.SyncEffectiveRoles {
+		return nil, nil
+	}
+
+	roles, annos, err := u.client.GetEffectiveRoles(ctx, resource.Id.Resource)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to get effective roles of user %s: %w", resource.Id.Resource, err)
+	}
+
+	names := effectiveRoleNames(roles)
+	paths := make([]interface{}, 0, len(roles))
+	for _, path := range effectiveRolePaths(roles) {
+		paths = append(paths, path)
+	}
+	list, err := structpb.NewList(paths)
+	if err != nil {
+		return annos, err
+	}
+	if resource.Profile == nil {
+		resource.Profile = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	}
+	resource.Profile.Fields["effective_roles"] = structpb.NewStringValue(strings.Join(names, ","))
+	resource.Profile.Fields["effective_role_paths"] = structpb.NewListValue(list)
+	return annos, nil
+}
@@ -0,0 +1,259 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const ActionRevokeExpiredGrants = "revoke_expired_grants"
+
+var revokeExpiredGrantsAction = &v2.BatonActionSchema{
+	Name:        ActionRevokeExpiredGrants,
+	DisplayName: "Revoke expired grants",
+	Description: "Remove the group memberships and roles whose recorded expiry has passed, along with their expiry records",
+	ReturnTypes: []*config.Field{
+		{
+			Name:        "success",
+			DisplayName: "Success",
+			Field:       &config.Field_BoolField{},
+		},
+		{
+			Name:        "revoked",
+			DisplayName: "Grants revoked",
+			Field:       &config.Field_IntField{},
+		},
+	},
+}
+
+type grantExpiryKey struct {
+	table  string
+	user   string
+	target string
+}
+
+// grantExpiryIndex holds the grant expiry table, so a sync reads it once
+// rather than once per membership. Recording or clearing an expiry resets
+// it.
+type grantExpiryIndex struct {
+	*tableIndex[grantExpiryKey, string]
+	client *servicenow.Client
+}
+
+func newGrantExpiryIndex(client *servicenow.Client) *grantExpiryIndex {
+	return &grantExpiryIndex{
+		tableIndex: newTableIndex(func(ctx context.Context) (map[grantExpiryKey]string, annotations.Annotations, error) {
+			byGrant := make(map[grantExpiryKey]string)
+			annos, err := eachRow(ctx, client.GetGrantExpiries, func(row servicenow.GrantExpiry) {
+				key := grantExpiryKey{table: row.Table, user: row.User, target: row.Target}
+				// time.DateTime strings order like the times they hold;
+				// with several rows for one grant, the latest wins.
+				if row.Expires > byGrant[key] {
+					byGrant[key] = row.Expires
+				}
+			})
+			return byGrant, annos, err
+		}),
+		client: client,
+	}
+}
+
+// expiresAt returns when user's grant of target in table expires, or "" for
+// a grant without an expiry. An expired grant the sweep hasn't removed yet
+// keeps its expiry.
+func (x *grantExpiryIndex) expiresAt(ctx context.Context, table string, user string, target string) (string, annotations.Annotations, error) {
+	if x.client.GrantExpiryTable == "" {
+		return "", nil, nil
+	}
+
+	byGrant, annos, err := x.get(ctx)
+	return byGrant[grantExpiryKey{table: table, user: user, target: target}], annos, err
+}
+
+// grantExpiryOptions returns the grant options that carry an expiry: the
+// expiry as grant metadata, or nothing for a permanent grant.
+func grantExpiryOptions(expires string) ([]grant.GrantOption, error) {
+	if expires == "" {
+		return nil, nil
+	}
+	metadata, err := structpb.NewStruct(map[string]interface{}{"expires": expires})
+	if err != nil {
+		return nil, err
+	}
+	return []grant.GrantOption{grant.WithAnnotation(&v2.GrantMetadata{Metadata: metadata})}, nil
+}
+
+// recordGrantExpiry records when a grant the connector is about to make
+// expires, if grants of target are time-bound. It runs before the
+// membership is written: a membership without its expiry would silently be
+// permanent, while an expiry without its membership is dropped by the sweep.
+func (x *grantExpiryIndex) recordGrantExpiry(ctx context.Context, table string, user string, target *v2.Resource) (annotations.Annotations, error) {
+	targetId := target.Id.Resource
+	duration := x.client.GrantDuration(targetId, target.DisplayName)
+	if duration <= 0 {
+		return nil, nil
+	}
+	defer x.reset()
+	annos, err := x.client.SetGrantExpiry(ctx, table, user, targetId, time.Now().Add(duration))
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to record expiry of %s grant of %s to user %s: %w", table, targetId, user, err)
+	}
+	return annos, nil
+}
+
+// clearGrantExpiry removes the expiry of a grant that was just revoked.
+func (x *grantExpiryIndex) clearGrantExpiry(ctx context.Context, table string, user string, target string) (annotations.Annotations, error) {
+	if x.client.GrantExpiryTable == "" {
+		return nil, nil
+	}
+	defer x.reset()
+	annos, err := x.client.ClearGrantExpiry(ctx, table, user, target)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to remove expiry of %s grant of %s to user %s: %w", table, target, user, err)
+	}
+	return annos, nil
+}
+
+// clearTargetExpiries removes the expiries of every grant of a group or
+// role that was just deleted.
+func (x *grantExpiryIndex) clearTargetExpiries(ctx context.Context, table string, target string) (annotations.Annotations, error) {
+	if x.client.GrantExpiryTable == "" {
+		return nil, nil
+	}
+	defer x.reset()
+	annos, err := x.client.ClearGrantExpiriesOfTarget(ctx, table, target)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to remove expiries of %s grants of %s: %w", table, target, err)
+	}
+	return annos, nil
+}
+
+// revokeExpiredGrants is the sweep behind ActionRevokeExpiredGrants: every
+// expired row of the grant expiry table has its membership removed, then
+// the row itself. A failure doesn't stop the sweep; the failures are
+// returned together once every expired grant has been tried.
+func (s *ServiceNow) revokeExpiredGrants(ctx context.Context, _ *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	now := time.Now()
+	var expired []servicenow.GrantExpiry
+	var annos annotations.Annotations
+	page := servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	for {
+		rows, next, pageAnnos, err := s.client.GetGrantExpiries(ctx, page)
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return nil, annos, fmt.Errorf("baton-servicenow: failed to list grant expiries: %w", err)
+		}
+		for _, row := range rows {
+			if row.Expired(now) {
+				expired = append(expired, row)
+			}
+		}
+		if next == "" {
+			break
+		}
+		if page, err = keysetPageFromToken(next); err != nil {
+			return nil, annos, err
+		}
+	}
+
+	revoked := 0
+	var errs []error
+	for _, row := range expired {
+		rowAnnos, found, err := s.revokeExpiredGrant(ctx, row)
+		annos = append(rowAnnos, annos...)
+		if err != nil {
+			l.Error("failed to revoke expired grant",
+				zap.String("table", row.Table),
+				zap.String("user", row.User),
+				zap.String("target", row.Target),
+				zap.Error(err),
+			)
+			errs = append(errs, err)
+			continue
+		}
+		if found {
+			revoked++
+		}
+	}
+
+	l.Info("revoked expired grants", zap.Int("expired", len(expired)), zap.Int("revoked", revoked), zap.Int("failed", len(errs)))
+
+	response := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"success": structpb.NewBoolValue(len(errs) == 0),
+			"revoked": structpb.NewNumberValue(float64(revoked)),
+		},
+	}
+	return response, annos, errors.Join(errs...)
+}
+
+// revokeExpiredGrant removes the membership an expired row stands for,
+// reporting whether there was one, then the row. Inherited roles are left
+// alone: they come from a group membership, and ServiceNow would put them
+// straight back.
+func (s *ServiceNow) revokeExpiredGrant(ctx context.Context, row servicenow.GrantExpiry) (annotations.Annotations, bool, error) {
+	annos, err := s.client.RequireUserInSysDomain(ctx, row.User)
+	if err == nil && row.Table == servicenow.GrantExpiryGroupMember {
+		var scopeAnnos annotations.Annotations
+		scopeAnnos, err = s.client.RequireGroupInSysDomain(ctx, row.Target)
+		annos = append(scopeAnnos, annos...)
+	}
+	if err != nil {
+		return annos, false, fmt.Errorf("baton-servicenow: cannot revoke expired %s grant of %s from user %s: %w", row.Table, row.Target, row.User, err)
+	}
+
+	var ids []string
+	var listAnnos annotations.Annotations
+	switch row.Table {
+	case servicenow.GrantExpiryGroupMember:
+		var members []servicenow.GroupMember
+		members, _, listAnnos, err = s.client.GetUserToGroup(ctx, row.User, row.Target, servicenow.KeysetPaginationVars{Limit: ResourcesPageSize})
+		annos = append(listAnnos, annos...)
+		ids = sysIDs(members, func(m servicenow.GroupMember) string { return m.Id })
+		if err == nil && len(ids) > 0 {
+			var removeAnnos annotations.Annotations
+			removeAnnos, err = s.client.RemoveGroupMembers(ctx, ids)
+			annos = append(removeAnnos, annos...)
+		}
+
+	case servicenow.GrantExpiryUserRole:
+		var userRoles []servicenow.UserToRole
+		userRoles, _, listAnnos, err = s.client.GetUserToRole(ctx, row.User, row.Target, servicenow.KeysetPaginationVars{Limit: ResourcesPageSize})
+		annos = append(listAnnos, annos...)
+		for _, userRole := range userRoles {
+			if userRole.Inherited != "true" {
+				ids = append(ids, userRole.Id)
+			}
+		}
+		if err == nil && len(ids) > 0 {
+			var removeAnnos annotations.Annotations
+			removeAnnos, err = s.client.RevokeUserRoles(ctx, ids)
+			annos = append(removeAnnos, annos...)
+		}
+
+	default:
+		return nil, false, fmt.Errorf("baton-servicenow: grant expiry %s names unknown table %q", row.Id, row.Table)
+	}
+	if err != nil {
+		return annos, false, fmt.Errorf("baton-servicenow: failed to revoke expired %s grant of %s from user %s: %w", row.Table, row.Target, row.User, err)
+	}
+
+	removeAnnos, err := s.client.RemoveGrantExpiries(ctx, []string{row.Id})
+	annos = append(removeAnnos, annos...)
+	if err != nil {
+		return annos, false, fmt.Errorf("baton-servicenow: failed to remove grant expiry %s: %w", row.Id, err)
+	}
+	return annos, len(ids) > 0, nil
+}
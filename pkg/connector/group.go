@@ -3,6 +3,7 @@ package connector
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -13,11 +14,17 @@ import (
 	"github.com/conductorone/baton-servicenow/pkg/servicenow"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type groupResourceType struct {
 	resourceType *v2.ResourceType
 	client       *servicenow.Client
+	memberGrants *pagePrefetcher[servicenow.GroupMember]
+	expiries     *grantExpiryIndex
+	types        *groupTypeIndex
 }
 
 func (g *groupResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -26,12 +33,29 @@ func (g *groupResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 
 const groupMembership = "member"
 
-// Create a new connector resource for an ServiceNow Group.
-func groupResource(group *servicenow.Group) (*v2.Resource, error) {
+// Create a new connector resource for an ServiceNow Group. The profile's
+// type holds the group's type sys_ids, as Create takes them; type_names
+// holds their names.
+func groupResource(group *servicenow.Group, typeNames []string) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"group_name":        group.Name,
 		"group_id":          group.Id,
 		"group_description": group.Description,
+		"active":            group.Active,
+	}
+	if group.SysDomain != "" {
+		profile["domain"] = group.SysDomain
+	}
+	if group.Type != "" {
+		profile["type"] = group.Type
+		profile["type_names"] = strings.Join(typeNames, ",")
+	}
+	if group.Email != "" {
+		profile["email"] = group.Email
+	}
+	if group.CostCenter != "" {
+		profile["cost_center"] = group.CostCenter
+		profile["cost_center_name"] = group.CostCenterName
 	}
 
 	resource, err := rs.NewGroupResource(
@@ -54,6 +78,10 @@ func (g *groupResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagi
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if pt.Token == "" {
+		g.expiries.reset()
+		g.types.reset()
+	}
 
 	groups, nextPageToken, annos, err := g.client.GetGroups(
 		ctx,
@@ -72,7 +100,12 @@ func (g *groupResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagi
 	var rv []*v2.Resource
 	for _, group := range groups {
 		groupCopy := group
-		rr, err := groupResource(&groupCopy)
+		typeNames, typeAnnos, err := g.types.names(ctx, servicenow.ListIDs(group.Type))
+		annos = append(typeAnnos, annos...)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list group types: %w", err)
+		}
+		rr, err := groupResource(&groupCopy, typeNames)
 
 		if err != nil {
 			return nil, "", annos, err
@@ -84,6 +117,8 @@ func (g *groupResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagi
 	return rv, nextPage, annos, nil
 }
 
+// Entitlements returns the group's membership, marked immutable when the
+// group's type isn't provisionable.
 func (g *groupResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
 	var rv []*v2.Entitlement
 
@@ -93,13 +128,22 @@ func (g *groupResourceType) Entitlements(ctx context.Context, resource *v2.Resou
 		ent.WithDescription(fmt.Sprintf("Access to %s group in ServiceNow", resource.DisplayName)),
 	}
 
+	groupType, _ := rs.GetProfileStringValue(resource.GetProfile(), "type")
+	typeNames, annos, err := g.types.names(ctx, servicenow.ListIDs(groupType))
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list group types: %w", err)
+	}
+	if !g.client.GroupTypesProvisionable(typeNames) {
+		assignmentOptions = append(assignmentOptions, ent.WithAnnotation(&v2.EntitlementImmutable{}))
+	}
+
 	rv = append(rv, ent.NewAssignmentEntitlement(
 		resource,
 		groupMembership,
 		assignmentOptions...,
 	))
 
-	return rv, "", nil, nil
+	return rv, "", annos, nil
 }
 
 func (g *groupResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
@@ -108,12 +152,7 @@ func (g *groupResourceType) Grants(ctx context.Context, resource *v2.Resource, p
 		return nil, "", nil, err
 	}
 
-	groupMembers, nextPageToken, annos, err := g.client.GetUserToGroup(
-		ctx,
-		"", // all users, domain-filtered when allowed-domains is set
-		resource.Id.Resource,
-		page,
-	)
+	groupMembers, nextPageToken, annos, err := g.memberGrants.get(ctx, resource.Id.Resource, page)
 	if err != nil {
 		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list groupMembers: %w", err)
 	}
@@ -135,6 +174,16 @@ func (g *groupResourceType) Grants(ctx context.Context, resource *v2.Resource, p
 			return nil, "", annos, fmt.Errorf("baton-servicenow: error creating principal id for member %s: %w", member, err)
 		}
 
+		expires, expiryAnnos, err := g.expiries.expiresAt(ctx, servicenow.GrantExpiryGroupMember, member, resource.Id.Resource)
+		annos = append(expiryAnnos, annos...)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up grant expiries: %w", err)
+		}
+		grantOpts, err := grantExpiryOptions(expires)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
 		// grant group membership
 		rv = append(
 			rv,
@@ -142,6 +191,7 @@ func (g *groupResourceType) Grants(ctx context.Context, resource *v2.Resource, p
 				resource,
 				groupMembership,
 				rID,
+				grantOpts...,
 			),
 		)
 	}
@@ -163,12 +213,18 @@ func (r *groupResourceType) Grant(ctx context.Context, principal *v2.Resource, e
 	}
 
 	groupId := entitlement.Resource.Id.Resource
-	groupMembers, _, annos, err := r.client.GetUserToGroup(
+	annos, err := r.requireProvisionable(ctx, groupId)
+	if err != nil {
+		return annos, err
+	}
+
+	groupMembers, _, memberAnnos, err := r.client.GetUserToGroup(
 		ctx,
 		principal.Id.Resource,
 		groupId,
 		servicenow.KeysetPaginationVars{Limit: 1},
 	)
+	annos = append(memberAnnos, annos...)
 	if err != nil {
 		return annos, fmt.Errorf("baton-servicenow: failed to get group members for %s: %w", entitlement.Id, err)
 	}
@@ -187,14 +243,21 @@ func (r *groupResourceType) Grant(ctx context.Context, principal *v2.Resource, e
 		return annos, nil
 	}
 
+	expiryAnnos, err := r.expiries.recordGrantExpiry(ctx, servicenow.GrantExpiryGroupMember, principal.Id.Resource, entitlement.Resource)
+	annos = append(expiryAnnos, annos...)
+	if err != nil {
+		return annos, err
+	}
+
 	// grant group membership to the user
-	annos, err = r.client.AddUserToGroup(
+	addAnnos, err := r.client.AddUserToGroup(
 		ctx,
 		servicenow.GroupMemberPayload{
 			User:  principal.Id.Resource,
 			Group: groupId,
 		},
 	)
+	annos = append(addAnnos, annos...)
 	if err != nil {
 		return annos, fmt.Errorf("baton-servicenow: failed to add user %s to group %s: %w", principal.Id.Resource, groupId, err)
 	}
@@ -202,6 +265,26 @@ func (r *groupResourceType) Grant(ctx context.Context, principal *v2.Resource, e
 	return annos, nil
 }
 
+// requireProvisionable fails unless the group's types allow members to be
+// added (see servicenow.WithProvisionableGroupTypes). The group is read
+// fresh, not taken from the entitlement, so a type changed since the last
+// sync still counts.
+func (r *groupResourceType) requireProvisionable(ctx context.Context, groupId string) (annotations.Annotations, error) {
+	group, annos, err := r.client.GetGroup(ctx, groupId)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to get group %s: %w", groupId, err)
+	}
+	typeNames, typeAnnos, err := r.types.names(ctx, servicenow.ListIDs(group.Type))
+	annos = append(typeAnnos, annos...)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to list group types: %w", err)
+	}
+	if !r.client.GroupTypesProvisionable(typeNames) {
+		return annos, fmt.Errorf("baton-servicenow: group %s has type %s, which provisionable-group-types doesn't allow adding members to", groupId, strings.Join(typeNames, ","))
+	}
+	return annos, nil
+}
+
 func (r *groupResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annotations.Annotations, error) {
 	l := ctxzap.Extract(ctx)
 
@@ -216,13 +299,28 @@ func (r *groupResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annota
 		)
 	}
 
+	// The rows are deleted by sys_id, which says nothing of their domain,
+	// so the user and the group are checked first.
 	groupId := entitlement.Resource.Id.Resource
-	groupMembers, _, annos, err := r.client.GetUserToGroup(
+	annos, err := r.client.RequireUserInSysDomain(ctx, principal.Id.Resource)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: cannot remove user %s from group %s: %w", principal.Id.Resource, groupId, err)
+	}
+	scopeAnnos, err := r.client.RequireGroupInSysDomain(ctx, groupId)
+	annos = append(scopeAnnos, annos...)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: cannot remove user %s from group %s: %w", principal.Id.Resource, groupId, err)
+	}
+
+	// Fetch every row for the pair, not just one: a user can hold duplicate
+	// memberships, and leaving one behind would leave the grant in place.
+	groupMembers, _, memberAnnos, err := r.client.GetUserToGroup(
 		ctx,
 		principal.Id.Resource,
 		groupId,
-		servicenow.KeysetPaginationVars{Limit: 1},
+		servicenow.KeysetPaginationVars{Limit: ResourcesPageSize},
 	)
+	annos = append(memberAnnos, annos...)
 	if err != nil {
 		return annos, fmt.Errorf("baton-servicenow: failed to get user roles for %s: %w", grant.Principal.Id.Resource, err)
 	}
@@ -242,18 +340,156 @@ func (r *groupResourceType) Revoke(ctx context.Context, grant *v2.Grant) (annota
 	}
 
 	// revoke all group memberships from the user
-	for _, grpMember := range groupMembers {
-		annos, err = r.client.RemoveUserFromGroup(
-			ctx,
-			grpMember.Id,
-		)
+	annos, err = r.client.RemoveGroupMembers(ctx, sysIDs(groupMembers, func(m servicenow.GroupMember) string { return m.Id }))
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to remove user %s from group: %w", grant.Principal.Id.Resource, err)
+	}
+
+	l.Debug("revoked group membership from user", zap.String("group", grant.Entitlement.Id), zap.Int("rows", len(groupMembers)))
+
+	expiryAnnos, err := r.expiries.clearGrantExpiry(ctx, servicenow.GrantExpiryGroupMember, principal.Id.Resource, groupId)
+	return append(expiryAnnos, annos...), err
+}
+
+// Create makes a sys_user_group from the resource C1 sends. The name is the
+// display name; description, manager, type and parent come from the profile
+// (manager, type and parent as sys_ids), with the resource's own description
+// and a group parent resource as fallbacks. The group is placed in the
+// configured domain, if any.
+func (g *groupResourceType) Create(ctx context.Context, resource *v2.Resource) (*v2.Resource, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	payload, err := groupPayload(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload.SysDomain = g.client.SysDomain
+
+	created, annos, err := g.client.CreateGroup(ctx, *payload)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to create group %s: %w", payload.Name, err)
+	}
+
+	l.Info("created group", zap.String("groupId", created.Id), zap.String("name", created.Name))
+
+	typeNames, typeAnnos, err := g.types.names(ctx, servicenow.ListIDs(created.Type))
+	annos = append(typeAnnos, annos...)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to list group types: %w", err)
+	}
+	rv, err := groupResource(created, typeNames)
+	if err != nil {
+		return nil, annos, err
+	}
+
+	return rv, annos, nil
+}
+
+func groupPayload(resource *v2.Resource) (*servicenow.GroupPayload, error) {
+	payload := &servicenow.GroupPayload{
+		Name:        resource.GetDisplayName(),
+		Description: resource.GetDescription(),
+	}
+	if payload.Name == "" {
+		return nil, fmt.Errorf("baton-servicenow: group name is required")
+	}
+
+	if parent := resource.GetParentResourceId(); parent.GetResourceType() == resourceTypeGroup.Id {
+		payload.Parent = parent.GetResource()
+	}
+
+	// Group profiles live on the resource itself (see groupResource); a group
+	// trait profile is accepted too for callers that still send one.
+	profiles := []*structpb.Struct{resource.GetProfile()}
+	if groupTrait, err := rs.GetGroupTrait(resource); err == nil {
+		profiles = append(profiles, groupTrait.GetProfile())
+	}
+	for key, field := range map[string]*string{
+		"description": &payload.Description,
+		"manager":     &payload.Manager,
+		"type":        &payload.Type,
+		"parent":      &payload.Parent,
+	} {
+		for _, profile := range profiles {
+			if value, ok := rs.GetProfileStringValue(profile, key); ok && value != "" {
+				*field = value
+				break
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+// Delete removes a sys_user_group. Memberships and role bindings are removed
+// first, so users lose the group's roles through ServiceNow's own revoke
+// logic rather than being left with orphaned rows.
+func (g *groupResourceType) Delete(ctx context.Context, resourceId *v2.ResourceId) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if resourceId.GetResourceType() != resourceTypeGroup.Id {
+		return nil, fmt.Errorf("baton-servicenow: cannot delete %s as a group", resourceId.GetResourceType())
+	}
+	groupId := resourceId.GetResource()
+
+	// DeleteGroup checks the domain too, but only after the memberships
+	// and role bindings are gone.
+	annos, err := g.client.RequireGroupInSysDomain(ctx, groupId)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: cannot delete group %s: %w", groupId, err)
+	}
+
+	page := servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	for {
+		members, nextPageToken, pageAnnos, err := g.client.GetGroupMembers(ctx, groupId, page)
+		annos = pageAnnos
 		if err != nil {
-			return annos, fmt.Errorf("baton-servicenow: failed to remove user %s from group: %w", grant.Principal.Id.Resource, err)
+			return annos, fmt.Errorf("baton-servicenow: failed to list members of group %s: %w", groupId, err)
+		}
+		if annos, err = g.client.RemoveGroupMembers(ctx, sysIDs(members, func(m servicenow.GroupMember) string { return m.Id })); err != nil {
+			return annos, fmt.Errorf("baton-servicenow: failed to remove members from group %s: %w", groupId, err)
+		}
+		if nextPageToken == "" {
+			break
 		}
+		if page, err = keysetPageFromToken(nextPageToken); err != nil {
+			return annos, err
+		}
+	}
+
+	page = servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	for {
+		groupRoles, nextPageToken, pageAnnos, err := g.client.GetGroupToRole(ctx, groupId, "", page)
+		annos = pageAnnos
+		if err != nil {
+			return annos, fmt.Errorf("baton-servicenow: failed to list roles of group %s: %w", groupId, err)
+		}
+		if annos, err = g.client.RevokeGroupRoles(ctx, sysIDs(groupRoles, func(r servicenow.GroupToRole) string { return r.Id })); err != nil {
+			return annos, fmt.Errorf("baton-servicenow: failed to revoke roles from group %s: %w", groupId, err)
+		}
+		if nextPageToken == "" {
+			break
+		}
+		if page, err = keysetPageFromToken(nextPageToken); err != nil {
+			return annos, err
+		}
+	}
 
-		l.Debug("revoked role from user", zap.String("role", grant.Entitlement.Id))
+	annos, err = g.client.DeleteGroup(ctx, groupId)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to delete group %s: %w", groupId, err)
 	}
 
+	// The memberships went above without Revoke, so their expiries are
+	// still recorded and would otherwise linger until they pass.
+	expiryAnnos, err := g.expiries.clearTargetExpiries(ctx, servicenow.GrantExpiryGroupMember, groupId)
+	annos = append(expiryAnnos, annos...)
+	if err != nil {
+		return annos, err
+	}
+
+	l.Info("deleted group", zap.String("groupId", groupId))
+
 	return annos, nil
 }
 
@@ -261,5 +497,53 @@ func groupBuilder(client *servicenow.Client) *groupResourceType {
 	return &groupResourceType{
 		resourceType: resourceTypeGroup,
 		client:       client,
+		memberGrants: newPagePrefetcher("sys_user_grmember", func(ctx context.Context, groupID string, page servicenow.KeysetPaginationVars) ([]servicenow.GroupMember, string, annotations.Annotations, error) {
+			return client.GetUserToGroup(ctx, "", groupID, page) // all users, domain-filtered when allowed-domains is set
+		}),
+		expiries: newGrantExpiryIndex(client),
+		types:    newGroupTypeIndex(client),
+	}
+}
+
+// groupTypeIndex holds sys_user_group_type's names by sys_id. The table is
+// small and rarely changes.
+type groupTypeIndex struct {
+	*tableIndex[string, string]
+}
+
+func newGroupTypeIndex(client *servicenow.Client) *groupTypeIndex {
+	return &groupTypeIndex{newTableIndex(func(ctx context.Context) (map[string]string, annotations.Annotations, error) {
+		byID := make(map[string]string)
+		annos, err := eachRow(ctx, client.GetGroupTypes, func(row servicenow.GroupType) {
+			byID[row.Id] = row.Name
+		})
+		if status.Code(err) == codes.PermissionDenied {
+			// Every type then stands for its sys_id, below.
+			ctxzap.Extract(ctx).Warn("baton-servicenow: can't read sys_user_group_type, using group type sys_ids", zap.Error(err))
+			return map[string]string{}, annos, nil
+		}
+		return byID, annos, err
+	})}
+}
+
+// names returns the names of the group types ids, in order. An id missing
+// from the table, such as one hidden by an ACL, stands for itself.
+func (x *groupTypeIndex) names(ctx context.Context, ids []string) ([]string, annotations.Annotations, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	byID, annos, err := x.get(ctx)
+	if err != nil {
+		return nil, annos, err
+	}
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if name, ok := byID[id]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, id)
+		}
 	}
+	return names, annos, nil
 }
@@ -3,7 +3,9 @@ package connector
 import (
 	"testing"
 
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // TestGroupResource_ProfileSurfacesOnResource guards against a regression
@@ -16,7 +18,7 @@ func TestGroupResource_ProfileSurfacesOnResource(t *testing.T) {
 		Description:  "Administrators group",
 	}
 
-	resource, err := groupResource(group)
+	resource, err := groupResource(group, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -32,3 +34,38 @@ func TestGroupResource_ProfileSurfacesOnResource(t *testing.T) {
 		t.Errorf("profile[group_description] = %v, want %q", got, "Administrators group")
 	}
 }
+
+func TestGroupPayload_ReadsProfileAndParent(t *testing.T) {
+	profile, err := structpb.NewStruct(map[string]interface{}{
+		"manager": "mgr-1",
+		"type":    "type-1,type-2",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload, err := groupPayload(&v2.Resource{
+		DisplayName:      "Project Apollo",
+		Description:      "Apollo access",
+		ParentResourceId: &v2.ResourceId{ResourceType: resourceTypeGroup.Id, Resource: "parent-1"},
+		Profile:          profile,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := servicenow.GroupPayload{
+		Name:        "Project Apollo",
+		Description: "Apollo access",
+		Manager:     "mgr-1",
+		Type:        "type-1,type-2",
+		Parent:      "parent-1",
+	}
+	if *payload != want {
+		t.Errorf("groupPayload() = %+v, want %+v", *payload, want)
+	}
+
+	if _, err := groupPayload(&v2.Resource{}); err == nil {
+		t.Error("a group without a name should be rejected")
+	}
+}
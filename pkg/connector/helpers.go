@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
-	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	"github.com/conductorone/baton-servicenow/pkg/servicenow"
 )
@@ -21,12 +20,6 @@ import (
 const ResourcesPageSize = 200
 const TicketSchemasPageSize = 25
 
-func annotationsForUserResourceType() annotations.Annotations {
-	annos := annotations.Annotations{}
-	annos.Update(&v2.SkipEntitlementsAndGrants{})
-	return annos
-}
-
 // parsePageToken returns the bag plus the seek position, decoded by the same codec
 // that produced it (servicenow.ParseKeysetToken) and carrying ResourcesPageSize as
 // the limit. A malformed token fails loudly rather than restarting: a wrong guess
@@ -56,11 +49,36 @@ func parsePageToken(i string, resourceID *v2.ResourceId) (*pagination.Bag, servi
 	}, nil
 }
 
+// keysetPageFromToken turns a raw keyset token from the client back into the
+// next page to request, for callers that walk every page in one call rather
+// than through a pagination.Bag.
+func keysetPageFromToken(token string) (servicenow.KeysetPaginationVars, error) {
+	lastID, offset, err := servicenow.ParseKeysetToken(token)
+	if err != nil {
+		return servicenow.KeysetPaginationVars{}, fmt.Errorf("baton-servicenow: %w", err)
+	}
+
+	return servicenow.KeysetPaginationVars{
+		Limit:  ResourcesPageSize,
+		LastID: lastID,
+		Offset: offset,
+	}, nil
+}
+
 // convertPageToken converts a string token into an int.
 func convertPageToken(token string) (int, error) {
 	return servicenow.ConvertPageToken(token)
 }
 
+// sysIDs returns the sys_ids of membership rows, for batch deletes.
+func sysIDs[T any](rows []T, idOf func(T) string) []string {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, idOf(row))
+	}
+	return ids
+}
+
 func mapGroupMembers(resources []servicenow.GroupMember) []string {
 	members := make([]string, len(resources))
 
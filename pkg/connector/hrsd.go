@@ -0,0 +1,394 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const hrMembership = "member"
+
+// hrGroupsPerPage bounds how many HR group sys_ids one sys_user_group
+// request names, so its query stays well inside URL length limits.
+const hrGroupsPerPage = 50
+
+// hrRoleResourceType syncs the HR Service Delivery roles (sn_hr_*), which
+// decide who opens HR cases and profiles, with the users and groups that
+// hold them. They're read-only here; HR roles are granted through the role
+// resource type like any other when they're grantable, and those show up
+// under both resource types.
+type hrRoleResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+}
+
+func (h *hrRoleResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return h.resourceType
+}
+
+// Create a new connector resource for an HR role.
+func hrRoleResource(role *servicenow.Role) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"role_name": role.Name,
+		"role_id":   role.Id,
+		"grantable": role.Grantable,
+	}
+	if role.SysScope != "" {
+		profile["scope_id"] = role.SysScope
+	}
+
+	resource, err := rs.NewRoleResource(
+		role.Name,
+		resourceTypeHRRole,
+		role.Id,
+		nil,
+		rs.WithResourceProfile(profile),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (h *hrRoleResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	installed, annos, err := hrsdInstalled(ctx, h.client)
+	if err != nil || !installed {
+		return nil, "", annos, err
+	}
+
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeHRRole.Id})
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	roles, nextPageToken, pageAnnos, err := h.client.GetHRRoles(ctx, page)
+	annos = append(pageAnnos, annos...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list HR roles: %w", err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, role := range roles {
+		roleCopy := role
+		rr, err := hrRoleResource(&roleCopy)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, rr)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (h *hrRoleResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(
+			resource,
+			hrMembership,
+			ent.WithGrantableTo(resourceTypeUser, resourceTypeGroup),
+			ent.WithDisplayName(fmt.Sprintf("%s HR Role %s", resource.DisplayName, hrMembership)),
+			ent.WithDescription(fmt.Sprintf("Holds the %s HR Service Delivery role in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants pages the role's users, then its groups, the same way the role
+// resource type does. A group's grant expands to its members.
+func (h *hrRoleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeHRRole.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var rv []*v2.Grant
+	var annos annotations.Annotations
+	switch bag.ResourceTypeID() {
+	case resourceTypeHRRole.Id:
+		bag.Pop()
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeGroup.Id,
+		})
+		bag.Push(pagination.PageState{
+			ResourceTypeID: resourceTypeUser.Id,
+		})
+
+	case resourceTypeUser.Id:
+		usersToRoles, nextPageToken, userAnnos, err := h.client.GetUserToRole(ctx, "", resource.Id.Resource, page)
+		annos = userAnnos
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list users under HR role %s: %w", resource.Id.Resource, err)
+		}
+
+		err = bag.Next(nextPageToken)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		for _, roleBinding := range usersToRoles {
+			rv = append(rv, grant.NewGrant(
+				resource,
+				hrMembership,
+				&v2.ResourceId{
+					ResourceType: resourceTypeUser.Id,
+					Resource:     roleBinding.User,
+				},
+			))
+		}
+
+	case resourceTypeGroup.Id:
+		groupsToRoles, nextPageToken, groupAnnos, err := h.client.GetGroupToRole(ctx, "", resource.Id.Resource, page)
+		annos = groupAnnos
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list groups under HR role %s: %w", resource.Id.Resource, err)
+		}
+
+		err = bag.Next(nextPageToken)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		for _, roleBinding := range groupsToRoles {
+			rv = append(rv, grant.NewGrant(
+				resource,
+				hrMembership,
+				&v2.ResourceId{
+					ResourceType: resourceTypeGroup.Id,
+					Resource:     roleBinding.Group,
+				},
+				grant.WithAnnotation(&v2.GrantExpandable{
+					EntitlementIds: []string{fmt.Sprintf("group:%s:%s", roleBinding.Group, groupMembership)},
+					Shallow:        true,
+				}),
+			))
+		}
+
+	default:
+		return nil, "", nil, fmt.Errorf("baton-servicenow: unknown resource type: %s", bag.ResourceTypeID())
+	}
+
+	nextPage, err := bag.Marshal()
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func hrRoleBuilder(client *servicenow.Client) *hrRoleResourceType {
+	return &hrRoleResourceType{
+		resourceType: resourceTypeHRRole,
+		client:       client,
+	}
+}
+
+// hrGroupResourceType syncs HR groups, the groups that hold an HR role, with
+// their members. Their profile names the HR roles they hold. They're the
+// same sys_user_group rows the group resource type lists.
+type hrGroupResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+	roles        *hrGroupRoleIndex
+}
+
+func (h *hrGroupResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return h.resourceType
+}
+
+// Create a new connector resource for an HR group.
+func hrGroupResource(group *servicenow.Group, hrRoles []string) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"group_name":        group.Name,
+		"group_id":          group.Id,
+		"group_description": group.Description,
+		"active":            group.Active,
+		"hr_roles":          strings.Join(hrRoles, ","),
+	}
+	if group.SysDomain != "" {
+		profile["domain"] = group.SysDomain
+	}
+
+	resource, err := rs.NewGroupResource(
+		group.Name,
+		resourceTypeHRGroup,
+		group.Id,
+		nil,
+		rs.WithResourceProfile(profile),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (h *hrGroupResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	installed, annos, err := hrsdInstalled(ctx, h.client)
+	if err != nil || !installed {
+		return nil, "", annos, err
+	}
+
+	bag := &pagination.Bag{}
+	if err := bag.Unmarshal(pt.Token); err != nil {
+		return nil, "", annos, err
+	}
+	if bag.Current() == nil {
+		bag.Push(pagination.PageState{ResourceTypeID: resourceTypeHRGroup.Id})
+	}
+	offset, err := convertPageToken(bag.PageToken())
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: %w", err)
+	}
+	if pt.Token == "" {
+		h.roles.reset()
+	}
+
+	byGroup, indexAnnos, err := h.roles.get(ctx)
+	annos = append(indexAnnos, annos...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list HR group roles: %w", err)
+	}
+	groupIDs := make([]string, 0, len(byGroup))
+	for id := range byGroup {
+		groupIDs = append(groupIDs, id)
+	}
+	sort.Strings(groupIDs)
+	if offset >= len(groupIDs) {
+		// GetGroups reads an empty id list as no filter at all.
+		return nil, "", annos, nil
+	}
+
+	// Each page is the next hrGroupsPerPage of the index's groups, by
+	// sys_id, rather than one query naming them all.
+	pageIDs := groupIDs[offset:min(offset+hrGroupsPerPage, len(groupIDs))]
+	groups, _, pageAnnos, err := h.client.GetGroups(ctx, servicenow.KeysetPaginationVars{Limit: len(pageIDs)}, pageIDs)
+	annos = append(pageAnnos, annos...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list HR groups: %w", err)
+	}
+
+	nextPageToken := ""
+	if next := offset + len(pageIDs); next < len(groupIDs) {
+		nextPageToken = strconv.Itoa(next)
+	}
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, group := range groups {
+		groupCopy := group
+		gr, err := hrGroupResource(&groupCopy, byGroup[group.Id])
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, gr)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (h *hrGroupResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(
+			resource,
+			hrMembership,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDisplayName(fmt.Sprintf("%s HR Group %s", resource.DisplayName, hrMembership)),
+			ent.WithDescription(fmt.Sprintf("Member of the %s HR group in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+func (h *hrGroupResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeHRGroup.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	members, nextPageToken, annos, err := h.client.GetUserToGroup(ctx, "", resource.Id.Resource, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list members of HR group %s: %w", resource.Id.Resource, err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Grant
+	for _, member := range mapGroupMembers(members) {
+		rv = append(rv, grant.NewGrant(
+			resource,
+			hrMembership,
+			&v2.ResourceId{
+				ResourceType: resourceTypeUser.Id,
+				Resource:     member,
+			},
+		))
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func hrGroupBuilder(client *servicenow.Client) *hrGroupResourceType {
+	return &hrGroupResourceType{
+		resourceType: resourceTypeHRGroup,
+		client:       client,
+		roles:        newHRGroupRoleIndex(client),
+	}
+}
+
+// hrsdInstalled reports whether the instance has HR Service Delivery,
+// logging once per listing when it doesn't, so its resource types come up
+// empty instead of failing the sync.
+func hrsdInstalled(ctx context.Context, client *servicenow.Client) (bool, annotations.Annotations, error) {
+	installed, annos, err := client.HRSDInstalled(ctx)
+	if err != nil {
+		return false, annos, fmt.Errorf("baton-servicenow: failed to check for HR Service Delivery: %w", err)
+	}
+	if !installed {
+		ctxzap.Extract(ctx).Info("baton-servicenow: HR Service Delivery isn't installed, skipping HR roles and groups",
+			zap.String("table", servicenow.HRProfilesTable),
+		)
+	}
+	return installed, annos, nil
+}
+
+// hrGroupRoleIndex holds the names of the HR roles of every group that has
+// one, by group sys_id, read from sys_group_has_role in one pass.
+type hrGroupRoleIndex struct {
+	*tableIndex[string, []string]
+}
+
+func newHRGroupRoleIndex(client *servicenow.Client) *hrGroupRoleIndex {
+	return &hrGroupRoleIndex{newTableIndex(func(ctx context.Context) (map[string][]string, annotations.Annotations, error) {
+		byGroup := make(map[string][]string)
+		annos, err := eachRow(ctx, client.GetHRGroupRoles, func(row servicenow.HRGroupRole) {
+			byGroup[row.Group] = append(byGroup[row.Group], row.RoleName)
+		})
+		return byGroup, annos, err
+	})}
+}
@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+// tableIndexTTL bounds how long a tableIndex is reused once read.
+const tableIndexTTL = 10 * time.Minute
+
+// keysetList lists one page of a table, like Client.GetGroupTypes.
+type keysetList[T any] func(ctx context.Context, page servicenow.KeysetPaginationVars) ([]T, string, annotations.Annotations, error)
+
+// eachRow calls add with every row of every page list returns.
+func eachRow[T any](ctx context.Context, list keysetList[T], add func(T)) (annotations.Annotations, error) {
+	var annos annotations.Annotations
+	page := servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	for {
+		rows, next, pageAnnos, err := list(ctx, page)
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return annos, err
+		}
+		for _, row := range rows {
+			add(row)
+		}
+		if next == "" {
+			return annos, nil
+		}
+		if page, err = keysetPageFromToken(next); err != nil {
+			return annos, err
+		}
+	}
+}
+
+// tableIndex holds a table, or a few, read into a map, so a sync reads them
+// once rather than once per resource. It's read on first use and again once
+// older than tableIndexTTL.
+type tableIndex[K comparable, V any] struct {
+	read func(ctx context.Context) (map[K]V, annotations.Annotations, error)
+
+	mu     sync.Mutex
+	loaded time.Time
+	byKey  map[K]V
+}
+
+func newTableIndex[K comparable, V any](read func(ctx context.Context) (map[K]V, annotations.Annotations, error)) *tableIndex[K, V] {
+	return &tableIndex[K, V]{read: read}
+}
+
+// get returns the index, reading it first when it's empty or stale.
+func (x *tableIndex[K, V]) get(ctx context.Context) (map[K]V, annotations.Annotations, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.byKey != nil && time.Since(x.loaded) <= tableIndexTTL {
+		return x.byKey, nil, nil
+	}
+	now := time.Now()
+	byKey, annos, err := x.read(ctx)
+	if err != nil {
+		return nil, annos, err
+	}
+	x.byKey, x.loaded = byKey, now
+	return byKey, annos, nil
+}
+
+// reset drops the index, so the next get reads it again. Listings call it on
+// their first page, so a sync never sees the last one's rows, and writes
+// call it once they've changed the tables behind it.
+func (x *tableIndex[K, V]) reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.byKey = nil
+}
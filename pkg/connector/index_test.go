@@ -0,0 +1,41 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// A tableIndex reads its tables once until reset, and a failed read isn't
+// kept: the next get tries again.
+func TestTableIndexReadsOnceUntilReset(t *testing.T) {
+	ctx := context.Background()
+
+	reads := 0
+	fail := true
+	index := newTableIndex(func(ctx context.Context) (map[string]int, annotations.Annotations, error) {
+		reads++
+		if fail {
+			return nil, nil, errors.New("unavailable")
+		}
+		return map[string]int{"a": reads}, nil, nil
+	})
+
+	if _, _, err := index.get(ctx); err == nil {
+		t.Fatal("get: want the read's error, got nil")
+	}
+	fail = false
+	for range 2 {
+		byKey, _, err := index.get(ctx)
+		if err != nil || byKey["a"] != 2 {
+			t.Fatalf("get = %v, %v, want the second read", byKey, err)
+		}
+	}
+
+	index.reset()
+	if byKey, _, err := index.get(ctx); err != nil || byKey["a"] != 3 {
+		t.Errorf("get after reset = %v, %v, want a third read", byKey, err)
+	}
+}
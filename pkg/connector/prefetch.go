@@ -0,0 +1,158 @@
+package connector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+const (
+	// prefetchTTL is how long a prefetched page may wait to be read. Pages
+	// are normally read within one Grants call of being fetched; one left
+	// over from an aborted sync must not resurface a revoked grant in the
+	// next.
+	prefetchTTL = 30 * time.Second
+
+	// maxPendingPrefetches bounds the pages held at once. Past it, pages are
+	// fetched when asked for, as if prefetching were off.
+	maxPendingPrefetches = 64
+)
+
+// membershipFetch lists one page of a membership table for a resource, like
+// Client.GetUserToRole with the user left empty.
+type membershipFetch[T any] func(ctx context.Context, resourceID string, page servicenow.KeysetPaginationVars) ([]T, string, annotations.Annotations, error)
+
+type prefetchKey struct {
+	resourceID string
+	page       servicenow.KeysetPaginationVars
+}
+
+type prefetchedPage[T any] struct {
+	done    chan struct{}
+	fetched time.Time
+	cancel  context.CancelFunc
+
+	rows  []T
+	next  string
+	annos annotations.Annotations
+	err   error
+}
+
+// pagePrefetcher overlaps membership round-trips with the SDK's processing
+// of the page before: each page read starts fetching the one after it, and
+// start fans the first pages of several tables out at once. The requests
+// still go through the client's per-instance limiter, so prefetching never
+// exceeds max-concurrent-requests.
+type pagePrefetcher[T any] struct {
+	name  string
+	fetch membershipFetch[T]
+
+	mu      sync.Mutex
+	pending map[prefetchKey]*prefetchedPage[T]
+}
+
+func newPagePrefetcher[T any](name string, fetch membershipFetch[T]) *pagePrefetcher[T] {
+	return &pagePrefetcher[T]{
+		name:    name,
+		fetch:   fetch,
+		pending: make(map[prefetchKey]*prefetchedPage[T]),
+	}
+}
+
+// get returns a page, from a prefetch if one was started for it, and starts
+// prefetching the page after it. A prefetch that failed is retried here
+// rather than failing the sync: it ran under its own context, so its error
+// says nothing about this call.
+func (p *pagePrefetcher[T]) get(ctx context.Context, resourceID string, page servicenow.KeysetPaginationVars) ([]T, string, annotations.Annotations, error) {
+	key := prefetchKey{resourceID: resourceID, page: page}
+
+	p.mu.Lock()
+	prefetched := p.pending[key]
+	delete(p.pending, key)
+	p.mu.Unlock()
+
+	var rows []T
+	var next string
+	var annos annotations.Annotations
+	var err error
+	switch {
+	case prefetched == nil:
+		rows, next, annos, err = p.fetch(ctx, resourceID, page)
+
+	default:
+		select {
+		case <-prefetched.done:
+		case <-ctx.Done():
+			prefetched.cancel()
+			return nil, "", nil, ctx.Err()
+		}
+		prefetched.cancel()
+		if prefetched.err != nil || time.Since(prefetched.fetched) > prefetchTTL {
+			ctxzap.Extract(ctx).Debug("baton-servicenow: refetching prefetched page",
+				zap.String("table", p.name),
+				zap.String("resource_id", resourceID),
+				zap.Error(prefetched.err),
+			)
+			rows, next, annos, err = p.fetch(ctx, resourceID, page)
+		} else {
+			rows, next, annos = prefetched.rows, prefetched.next, prefetched.annos
+		}
+	}
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	if next != "" {
+		// A token that doesn't parse fails the next Grants call on its own.
+		if nextPage, err := keysetPageFromToken(next); err == nil {
+			p.start(ctx, resourceID, nextPage)
+		}
+	}
+	return rows, next, annos, nil
+}
+
+// start fetches a page in the background for a later get. The fetch
+// outlives ctx -- the Grants call that starts it returns first -- but keeps
+// its logger.
+func (p *pagePrefetcher[T]) start(ctx context.Context, resourceID string, page servicenow.KeysetPaginationVars) {
+	key := prefetchKey{resourceID: resourceID, page: page}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictExpired()
+	if _, ok := p.pending[key]; ok || len(p.pending) >= maxPendingPrefetches {
+		return
+	}
+
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), prefetchTTL)
+	prefetched := &prefetchedPage[T]{
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	p.pending[key] = prefetched
+
+	go func() {
+		defer close(prefetched.done)
+		prefetched.rows, prefetched.next, prefetched.annos, prefetched.err = p.fetch(fetchCtx, resourceID, page)
+		prefetched.fetched = time.Now()
+	}()
+}
+
+// evictExpired drops pages nobody read in time. Called with p.mu held.
+func (p *pagePrefetcher[T]) evictExpired() {
+	for key, prefetched := range p.pending {
+		select {
+		case <-prefetched.done:
+			if time.Since(prefetched.fetched) > prefetchTTL {
+				prefetched.cancel()
+				delete(p.pending, key)
+			}
+		default:
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+// Reading a page starts fetching the next one, so it's already there when
+// the SDK asks for it; every page is fetched exactly once, in order.
+func TestPagePrefetcherReadsAhead(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	pages := map[string]string{"": "r-1", "r-1": "r-2", "r-2": ""}
+	prefetcher := newPagePrefetcher("sys_user_has_role", func(_ context.Context, roleID string, page servicenow.KeysetPaginationVars) ([]string, string, annotations.Annotations, error) {
+		mu.Lock()
+		fetched = append(fetched, page.LastID)
+		mu.Unlock()
+		next := ""
+		if pages[page.LastID] != "" {
+			var err error
+			if next, err = servicenow.EncodeKeysetToken(pages[page.LastID], 0); err != nil {
+				return nil, "", nil, err
+			}
+		}
+		return []string{roleID + "@" + page.LastID}, next, nil, nil
+	})
+
+	ctx := context.Background()
+	page := servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	var rows []string
+	for {
+		got, next, _, err := prefetcher.get(ctx, "r-admin", page)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		rows = append(rows, got...)
+		if next == "" {
+			break
+		}
+		if page, err = keysetPageFromToken(next); err != nil {
+			t.Fatalf("keysetPageFromToken: %v", err)
+		}
+
+		prefetcher.mu.Lock()
+		_, pending := prefetcher.pending[prefetchKey{resourceID: "r-admin", page: page}]
+		prefetcher.mu.Unlock()
+		if !pending {
+			t.Fatalf("the page after %q wasn't prefetched", rows[len(rows)-1])
+		}
+	}
+
+	if got, want := fmt.Sprint(rows), "[r-admin@ r-admin@r-1 r-admin@r-2]"; got != want {
+		t.Errorf("rows = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(fetched), "[ r-1 r-2]"; got != want {
+		t.Errorf("fetched pages = %s, want %s", got, want)
+	}
+}
+
+// A prefetch that failed is fetched again when read, rather than failing a
+// sync the error may have nothing to do with.
+func TestPagePrefetcherRefetchesAFailedPrefetch(t *testing.T) {
+	calls := 0
+	prefetcher := newPagePrefetcher("sys_user_grmember", func(_ context.Context, groupID string, _ servicenow.KeysetPaginationVars) ([]string, string, annotations.Annotations, error) {
+		calls++
+		if calls == 1 {
+			return nil, "", nil, errors.New("connection reset")
+		}
+		return []string{groupID}, "", nil, nil
+	})
+
+	ctx := context.Background()
+	page := servicenow.KeysetPaginationVars{Limit: ResourcesPageSize}
+	prefetcher.start(ctx, "g-apollo", page)
+	rows, _, _, err := prefetcher.get(ctx, "g-apollo", page)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if fmt.Sprint(rows) != "[g-apollo]" || calls != 2 {
+		t.Errorf("rows = %v after %d fetches, want [g-apollo] after 2", rows, calls)
+	}
+}
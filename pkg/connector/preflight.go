@@ -0,0 +1,439 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// PreflightScope says which of the connector's optional capabilities Validate
+// has to check access for, beyond sync.
+type PreflightScope struct {
+	Provisioning bool
+	Ticketing    bool
+}
+
+// provisioningRoles are the roles ServiceNow's stock ACLs require to create
+// users and groups and to write their memberships. When the account can't
+// read the ACLs on a table it writes, holding one of these stands in for
+// them; a custom role with the right ACLs works as well, so holding none of
+// them is then only a warning.
+var provisioningRoles = []string{"admin", "user_admin"}
+
+// PreflightCheck is one access check: whether the connector can perform
+// Operation on Table, which Capability needs: sync, provisioning, ticketing
+// or one of the optional synced features (applications, subscriptions,
+// user_criteria, cmdb, hrsd, acls, grant_expiry, domain). A Warning check's
+// failure is reported but doesn't fail Validate: the connector can do
+// without it.
+type PreflightCheck struct {
+	Capability string
+	Table      string
+	Operation  string
+	Warning    bool
+	Err        error
+}
+
+// PreflightReport is every check Validate ran. It is returned as the
+// Validate error when any check failed.
+type PreflightReport struct {
+	Checks []PreflightCheck
+}
+
+// Failed returns the checks that didn't pass and fail Validate.
+func (r *PreflightReport) Failed() []PreflightCheck {
+	var failed []PreflightCheck
+	for _, check := range r.Checks {
+		if check.Err != nil && !check.Warning {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Warnings returns the warning checks that didn't pass.
+func (r *PreflightReport) Warnings() []PreflightCheck {
+	var warnings []PreflightCheck
+	for _, check := range r.Checks {
+		if check.Err != nil && check.Warning {
+			warnings = append(warnings, check)
+		}
+	}
+	return warnings
+}
+
+func (r *PreflightReport) Error() string {
+	failed := r.Failed()
+	lines := make([]string, 0, len(failed))
+	for _, check := range failed {
+		lines = append(lines, fmt.Sprintf("%s: cannot %s %s: %v", check.Capability, check.Operation, check.Table, check.Err))
+	}
+	return fmt.Sprintf("%d of %d access checks failed:\n%s", len(failed), len(r.Checks), strings.Join(lines, "\n"))
+}
+
+type preflightProbe struct {
+	capability string
+	table      string
+	operation  string
+	warning    bool
+	run        func(ctx context.Context) (annotations.Annotations, error)
+}
+
+func (s *ServiceNow) readProbe(capability string, table string) preflightProbe {
+	return preflightProbe{
+		capability: capability,
+		table:      table,
+		operation:  "read",
+		run: func(ctx context.Context) (annotations.Annotations, error) {
+			return s.client.ProbeTableRead(ctx, table)
+		},
+	}
+}
+
+// unsettledError fails a check that couldn't be settled either way, such as
+// a write the account's ACLs couldn't be read for. It's reported as a
+// warning, like a warningProbe's failure.
+type unsettledError struct {
+	err error
+}
+
+func (e *unsettledError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unsettledError) Unwrap() error {
+	return e.err
+}
+
+// warningProbe is probe, reported without failing Validate.
+func warningProbe(probe preflightProbe) preflightProbe {
+	probe.warning = true
+	return probe
+}
+
+// preflightProbes lists what each capability in scope touches. Sync reads
+// the six tables users, groups, roles and their memberships live in; group
+// types and delegations are only warnings, since sync goes without them when
+// they can't be read. Each optional feature turned on reads its own tables
+// under its own name, so the report says which one a table ACL blocks.
+// Provisioning creates and deletes users, groups, their memberships and
+// delegations, and grant expiries, and updates users (see writeACLs);
+// ticketing reads the Service Catalog and the tables requests, their states
+// and labels live in.
+func (s *ServiceNow) preflightProbes() []preflightProbe {
+	probes := []preflightProbe{
+		s.readProbe("sync", "sys_user"),
+		s.readProbe("sync", "sys_user_group"),
+		s.readProbe("sync", "sys_user_role"),
+		s.readProbe("sync", "sys_user_grmember"),
+		s.readProbe("sync", "sys_user_has_role"),
+		s.readProbe("sync", "sys_group_has_role"),
+		warningProbe(s.readProbe("sync", "sys_user_group_type")),
+		warningProbe(s.readProbe("sync", "sys_user_delegate")),
+	}
+	if s.client.SyncApplications {
+		probes = append(probes, s.readProbe("applications", "sys_scope"))
+	}
+	if s.client.SyncSubscriptions {
+		probes = append(probes,
+			s.readProbe("subscriptions", "license_details"),
+			s.readProbe("subscriptions", "license_has_user"),
+		)
+	}
+	if s.client.SyncUserCriteria {
+		probes = append(probes, s.readProbe("user_criteria", servicenow.UserCriteriaTable))
+		for _, table := range servicenow.UserCriteriaLinkTables {
+			probes = append(probes, s.readProbe("user_criteria", table))
+		}
+	}
+	if s.client.SyncCMDB {
+		probes = append(probes,
+			s.readProbe("cmdb", servicenow.BusinessApplicationsTable),
+			s.readProbe("cmdb", servicenow.BusinessServicesTable),
+		)
+	}
+	if s.client.SyncHRSD {
+		// An instance without HR Service Delivery passes: sync skips it.
+		probes = append(probes, preflightProbe{
+			capability: "hrsd",
+			table:      servicenow.HRProfilesTable,
+			operation:  "read",
+			run: func(ctx context.Context) (annotations.Annotations, error) {
+				_, annos, err := s.client.HRSDInstalled(ctx)
+				return annos, err
+			},
+		})
+	}
+	if s.client.SyncACLs {
+		probes = append(probes,
+			s.readProbe("acls", servicenow.ACLTable),
+			s.readProbe("acls", servicenow.ACLRoleTable),
+		)
+	}
+	if s.client.GrantExpiryTable != "" {
+		probes = append(probes, s.readProbe("grant_expiry", s.client.GrantExpiryTable))
+	}
+	if s.client.SysDomain != "" {
+		probes = append(probes, preflightProbe{
+			capability: "domain",
+			table:      "domain",
+			operation:  "read",
+			run: func(ctx context.Context) (annotations.Annotations, error) {
+				_, annos, err := s.client.SysDomainScope(ctx)
+				return annos, err
+			},
+		})
+	}
+
+	if s.preflight.Provisioning {
+		writes := []tableWrites{
+			{"sys_user", []string{"create", "write", "delete"}},
+			{"sys_user_group", []string{"create", "delete"}},
+			{"sys_user_grmember", []string{"create", "delete"}},
+			{"sys_user_has_role", []string{"create", "delete"}},
+			{"sys_group_has_role", []string{"create", "delete"}},
+			{"sys_user_delegate", []string{"create", "delete"}},
+		}
+		if s.client.GrantExpiryTable != "" {
+			writes = append(writes, tableWrites{s.client.GrantExpiryTable, []string{"create", "delete"}})
+		}
+
+		tables := []string{"*"}
+		for _, w := range writes {
+			tables = append(tables, w.table)
+		}
+		acls := newWriteACLs(s.client, tables)
+		for _, w := range writes {
+			for _, operation := range w.operations {
+				probes = append(probes, preflightProbe{
+					capability: "provisioning",
+					table:      w.table,
+					operation:  operation,
+					run: func(ctx context.Context) (annotations.Annotations, error) {
+						annos := acls.load(ctx)
+						return annos, acls.check(w.table, operation)
+					},
+				})
+			}
+		}
+	}
+
+	if s.preflight.Ticketing {
+		probes = append(probes,
+			preflightProbe{
+				capability: "ticketing",
+				table:      "sn_sc/servicecatalog/items",
+				operation:  "read",
+				run: func(ctx context.Context) (annotations.Annotations, error) {
+					_, _, annos, err := s.client.GetCatalogItems(ctx, &servicenow.PaginationVars{Limit: 1})
+					return annos, err
+				},
+			},
+			s.readProbe("ticketing", "item_option_new"),
+			s.readProbe("ticketing", "io_set_item"),
+			s.readProbe("ticketing", "question_choice"),
+			s.readProbe("ticketing", "sc_request"),
+			s.readProbe("ticketing", "sc_req_item"),
+			s.readProbe("ticketing", "sys_choice"),
+			s.readProbe("ticketing", "label"),
+			s.readProbe("ticketing", "label_entry"),
+		)
+	}
+
+	return probes
+}
+
+// tableWrites are the operations provisioning performs on the rows of table.
+type tableWrites struct {
+	table      string
+	operations []string
+}
+
+// writeACLs answers the provisioning probes from the record ACLs on the
+// tables provisioning writes, the roles those ACLs require and the roles the
+// account holds, all read once on the first probe. ServiceNow grants an
+// operation when any ACL on the table for it passes, or, without one, any
+// "*" ACL; an ACL passes when the account holds one of its roles, it
+// requires none, or it lets admin override it and the account is admin.
+// Conditions and scripts can only narrow that, so an account no ACL passes
+// by role provably can't write, while one that passes may still be denied
+// by a condition the probe can't evaluate.
+type writeACLs struct {
+	client *servicenow.Client
+	tables []string
+
+	loaded           bool
+	rolesErr         error
+	aclsErr          error
+	roles            map[string]bool
+	admin            bool
+	provisioningRole bool
+	acls             []servicenow.ACL
+	aclRoles         map[string][]servicenow.ACLRole
+}
+
+func newWriteACLs(client *servicenow.Client, tables []string) *writeACLs {
+	return &writeACLs{client: client, tables: tables}
+}
+
+// load reads the account's roles and the ACLs, unless an earlier probe did.
+// An ACL table the account can't read leaves the probes to the role check
+// (see provisioningRoles).
+func (w *writeACLs) load(ctx context.Context) annotations.Annotations {
+	if w.loaded {
+		return nil
+	}
+	w.loaded = true
+
+	w.roles = make(map[string]bool)
+	annos, err := eachRow(ctx, w.client.GetAccountRoles, func(r servicenow.EffectiveRole) {
+		w.roles[r.Role] = true
+		if r.RoleName == "admin" {
+			w.admin = true
+		}
+		if slices.Contains(provisioningRoles, r.RoleName) {
+			w.provisioningRole = true
+		}
+	})
+	if err != nil {
+		w.rolesErr = fmt.Errorf("failed to look up the account's roles: %w", err)
+		return annos
+	}
+
+	aclAnnos, err := eachRow(ctx, func(ctx context.Context, page servicenow.KeysetPaginationVars) ([]servicenow.ACL, string, annotations.Annotations, error) {
+		return w.client.GetTableACLs(ctx, w.tables, []string{"create", "write", "delete"}, page)
+	}, func(acl servicenow.ACL) {
+		w.acls = append(w.acls, acl)
+	})
+	annos = append(aclAnnos, annos...)
+	if err != nil {
+		w.aclsErr = fmt.Errorf("failed to read the ACLs: %w", err)
+		return annos
+	}
+	if len(w.acls) == 0 {
+		return annos
+	}
+
+	ids := make([]string, 0, len(w.acls))
+	for _, acl := range w.acls {
+		ids = append(ids, acl.Id)
+	}
+	w.aclRoles = make(map[string][]servicenow.ACLRole)
+	roleAnnos, err := eachRow(ctx, func(ctx context.Context, page servicenow.KeysetPaginationVars) ([]servicenow.ACLRole, string, annotations.Annotations, error) {
+		return w.client.GetRolesOfACLs(ctx, ids, page)
+	}, func(r servicenow.ACLRole) {
+		w.aclRoles[r.ACL] = append(w.aclRoles[r.ACL], r)
+	})
+	annos = append(roleAnnos, annos...)
+	if err != nil {
+		w.aclsErr = fmt.Errorf("failed to read the roles the ACLs require: %w", err)
+	}
+	return annos
+}
+
+// check fails unless the account may perform operation on table's rows. A
+// failure the ACLs prove fails Validate; one the role check stands in for is
+// an unsettledError.
+func (w *writeACLs) check(table string, operation string) error {
+	if w.rolesErr != nil {
+		return &unsettledError{err: w.rolesErr}
+	}
+
+	applicable := w.applicable(table, operation)
+	if w.aclsErr != nil || len(applicable) == 0 {
+		if w.provisioningRole {
+			return nil
+		}
+		err := fmt.Errorf("account holds none of the roles %s; writes need a custom role with equivalent ACLs", strings.Join(provisioningRoles, ", "))
+		if w.aclsErr != nil {
+			err = fmt.Errorf("%w, and %w", w.aclsErr, err)
+		}
+		return &unsettledError{err: err}
+	}
+
+	var required []string
+	for _, acl := range applicable {
+		if w.admin && acl.AdminOverrides == "true" {
+			return nil
+		}
+		roles := w.aclRoles[acl.Id]
+		if len(roles) == 0 {
+			return nil
+		}
+		for _, role := range roles {
+			if w.roles[role.Role] {
+				return nil
+			}
+			name := role.RoleName
+			if name == "" {
+				name = role.Role
+			}
+			required = append(required, name)
+		}
+	}
+	slices.Sort(required)
+	return fmt.Errorf("no %s ACL on %s passes the account's roles; it needs one of %s", operation, table, strings.Join(slices.Compact(required), ", "))
+}
+
+// applicable returns the ACLs guarding operation on table's rows: its own,
+// or the "*" ones when it has none.
+func (w *writeACLs) applicable(table string, operation string) []servicenow.ACL {
+	var own, wildcard []servicenow.ACL
+	for _, acl := range w.acls {
+		if acl.Op() != operation {
+			continue
+		}
+		switch acl.Name {
+		case table:
+			own = append(own, acl)
+		case "*":
+			wildcard = append(wildcard, acl)
+		}
+	}
+	if len(own) > 0 {
+		return own
+	}
+	return wildcard
+}
+
+// Preflight runs every access check in scope. Checks don't stop at the
+// first failure, so one run reports everything an administrator has to fix.
+func (s *ServiceNow) Preflight(ctx context.Context) (*PreflightReport, annotations.Annotations) {
+	l := ctxzap.Extract(ctx)
+
+	var annos annotations.Annotations
+	report := &PreflightReport{}
+	for _, probe := range s.preflightProbes() {
+		probeAnnos, err := probe.run(ctx)
+		if len(probeAnnos) > 0 {
+			annos = probeAnnos
+		}
+		var unsettled *unsettledError
+		warning := probe.warning || errors.As(err, &unsettled)
+		report.Checks = append(report.Checks, PreflightCheck{
+			Capability: probe.capability,
+			Table:      probe.table,
+			Operation:  probe.operation,
+			Warning:    warning,
+			Err:        err,
+		})
+		if err != nil {
+			l.Warn("baton-servicenow: access check failed",
+				zap.String("capability", probe.capability),
+				zap.String("table", probe.table),
+				zap.String("operation", probe.operation),
+				zap.Bool("warning", warning),
+				zap.Error(err),
+			)
+		}
+	}
+
+	return report, annos
+}
@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow/fake"
+)
+
+// A table ACL denying sys_user_has_role has to surface from Validate as the
+// sync read it breaks -- not hours into a sync -- and as a warning on every
+// provisioning write the account's roles couldn't be checked for.
+func TestValidate_ReportsEveryBlockedCheck(t *testing.T) {
+	roleLookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/sys_user_has_role") {
+			if strings.Contains(r.URL.Query().Get("sysparm_query"), "gs.getUserID()") {
+				roleLookups++
+			}
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"message":"User Not Authorized"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := servicenow.NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		servicenow.WithRetryPolicy(servicenow.RetryPolicy{}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	s := &ServiceNow{client: client, preflight: PreflightScope{Provisioning: true}}
+
+	_, err = s.Validate(context.Background())
+	var report *PreflightReport
+	if !errors.As(err, &report) {
+		t.Fatalf("Validate error = %v, want a *PreflightReport", err)
+	}
+
+	var got []string
+	for _, check := range report.Failed() {
+		got = append(got, check.Capability+" "+check.Operation+" "+check.Table)
+	}
+	if want := "sync read sys_user_has_role"; strings.Join(got, "\n") != want {
+		t.Errorf("failed checks:\n%s\nwant:\n%s", strings.Join(got, "\n"), want)
+	}
+
+	got = nil
+	for _, check := range report.Warnings() {
+		got = append(got, check.Capability+" "+check.Operation+" "+check.Table)
+	}
+	want := []string{
+		"provisioning create sys_user",
+		"provisioning write sys_user",
+		"provisioning delete sys_user",
+		"provisioning create sys_user_group",
+		"provisioning delete sys_user_group",
+		"provisioning create sys_user_grmember",
+		"provisioning delete sys_user_grmember",
+		"provisioning create sys_user_has_role",
+		"provisioning delete sys_user_has_role",
+		"provisioning create sys_group_has_role",
+		"provisioning delete sys_group_has_role",
+		"provisioning create sys_user_delegate",
+		"provisioning delete sys_user_delegate",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(report.Checks) != 21 {
+		t.Errorf("ran %d checks, want 21 (8 sync reads, 13 provisioning writes)", len(report.Checks))
+	}
+	if roleLookups != 1 {
+		t.Errorf("role lookups = %d, want 1", roleLookups)
+	}
+}
+
+// A check blocked on an optional feature's table names that feature, not
+// sync, so whoever reads the report knows which setting to turn off or
+// which table ACL to open.
+func TestValidate_LabelsChecksWithTheirFeature(t *testing.T) {
+	core := map[string]bool{
+		"sys_user": true, "sys_user_group": true, "sys_user_role": true,
+		"sys_user_grmember": true, "sys_user_has_role": true, "sys_group_has_role": true,
+		"sys_user_group_type": true, "sys_user_delegate": true,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, table, _ := strings.Cut(r.URL.Path, "/table/")
+		table, _, _ = strings.Cut(table, "/")
+		if !core[table] {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"message":"User Not Authorized"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"result":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := servicenow.NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		servicenow.WithRetryPolicy(servicenow.RetryPolicy{}),
+		servicenow.WithApplications(true),
+		servicenow.WithSubscriptions(true),
+		servicenow.WithUserCriteria(true),
+		servicenow.WithCMDB(true),
+		servicenow.WithHRSD(true),
+		servicenow.WithACLs(true),
+		servicenow.WithGrantExpiry("u_grant_expiry", nil),
+		servicenow.WithSysDomain("d-top"),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	s := &ServiceNow{client: client}
+
+	_, err = s.Validate(context.Background())
+	var report *PreflightReport
+	if !errors.As(err, &report) {
+		t.Fatalf("Validate error = %v, want a *PreflightReport", err)
+	}
+
+	var got []string
+	for _, check := range report.Failed() {
+		got = append(got, check.Capability+" "+check.Operation+" "+check.Table)
+	}
+	want := []string{
+		"applications read sys_scope",
+		"subscriptions read license_details",
+		"subscriptions read license_has_user",
+		"user_criteria read user_criteria",
+		"user_criteria read kb_uc_can_read_mtom",
+		"user_criteria read kb_uc_can_contribute_mtom",
+		"user_criteria read kb_uc_cannot_read_mtom",
+		"user_criteria read sc_cat_item_user_criteria_mtom",
+		"user_criteria read sc_cat_item_user_criteria_no_mtom",
+		"cmdb read cmdb_ci_business_app",
+		"cmdb read cmdb_ci_service",
+		"hrsd read sn_hr_core_profile",
+		"acls read sys_security_acl",
+		"acls read sys_security_acl_role",
+		"grant_expiry read u_grant_expiry",
+		"domain read domain",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("failed checks:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// An account with a custom role instead of admin, and no read ACL on group
+// types or delegations, still validates and syncs: those checks only warn,
+// and so do the writes when there are no ACLs to check the role against.
+func TestValidate_LeastPrivilegeAccountWarns(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-sync")
+	instance.Insert("sys_user", fake.Record{"sys_id": "u-alice", "user_name": "alice", "email": "alice@example.com", "active": "true"})
+	instance.Insert("sys_user_group_type", fake.Record{"sys_id": "t-itil", "name": "itil"})
+	instance.Insert("sys_user_group", fake.Record{"sys_id": "g-ops", "name": "Ops", "type": "t-itil"})
+	instance.Insert("sys_user_delegate", fake.Record{"user": "u-alice", "delegate": "u-alice", "ends": "2999-01-01 00:00:00"})
+	instance.Deny("sys_user_group_type", http.MethodGet)
+	instance.Deny("sys_user_delegate", http.MethodGet)
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithPreflight(PreflightScope{Provisioning: true}))
+	if _, err := s.Validate(ctx); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	report, _ := s.Preflight(ctx)
+	if got := len(report.Warnings()); got != 15 {
+		t.Errorf("warnings = %d, want 15 (group types, delegations, 13 provisioning writes)", got)
+	}
+
+	synced := syncAll(t, ctx, s)
+	if typeNames, _ := rs.GetProfileStringValue(synced.resources["g-ops"].GetProfile(), "type_names"); typeNames != "t-itil" {
+		t.Errorf("Ops type_names = %q, want the type's sys_id t-itil", typeNames)
+	}
+	for _, g := range synced.grants {
+		if strings.Contains(g, ":delegate ->") {
+			t.Errorf("delegate grant %s synced without read access to sys_user_delegate", g)
+		}
+	}
+}
+
+// Provisioning writes are checked against the ACLs on each table: a custom
+// role the ACLs name passes, and a table whose ACLs all require roles the
+// account lacks fails Validate rather than warning.
+func TestValidate_ChecksWritesAgainstTableACLs(t *testing.T) {
+	ctx := context.Background()
+
+	instance := fake.New("u-sync")
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-user-admin", "name": "user_admin"})
+	instance.Insert("sys_user_role", fake.Record{"sys_id": "r-provisioner", "name": "x_corp_provisioner"})
+	instance.Insert("sys_user_has_role", fake.Record{"user": "u-sync", "role": "r-provisioner"})
+	instance.Insert("sys_security_type", fake.Record{"sys_id": "t-record", "name": "record"})
+	for _, op := range []string{"create", "write", "delete"} {
+		instance.Insert("sys_security_operation", fake.Record{"sys_id": "op-" + op, "name": op})
+		// Tables without ACLs of their own fall back to "*".
+		instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-any-" + op, "name": "*", "active": "true", "operation": "op-" + op, "type": "t-record"})
+		instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-any-" + op, "sys_user_role": "r-provisioner"})
+	}
+	// Only user_admin may add members...
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-member-create", "name": "sys_user_grmember", "active": "true", "operation": "op-create", "type": "t-record", "admin_overrides": "true"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-member-create", "sys_user_role": "r-user-admin"})
+	// ...but the custom role may remove them.
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-member-delete", "name": "sys_user_grmember", "active": "true", "operation": "op-delete", "type": "t-record"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-member-delete", "sys_user_role": "r-user-admin"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-member-delete", "sys_user_role": "r-provisioner"})
+	// Any one ACL passing is enough: the second one requires no role.
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-role-create", "name": "sys_user_has_role", "active": "true", "operation": "op-create", "type": "t-record"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-role-create", "sys_user_role": "r-user-admin"})
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-role-create-open", "name": "sys_user_has_role", "active": "true", "operation": "op-create", "type": "t-record", "condition": "user.active=true"})
+	// An inactive ACL doesn't count.
+	instance.Insert("sys_security_acl", fake.Record{"sys_id": "acl-old", "name": "sys_user_group", "active": "false", "operation": "op-delete", "type": "t-record"})
+	instance.Insert("sys_security_acl_role", fake.Record{"sys_security_acl": "acl-old", "sys_user_role": "r-user-admin"})
+	server := instance.Start()
+	defer server.Close()
+
+	s := newTestConnector(t, ctx, server.URL, nil, WithPreflight(PreflightScope{Provisioning: true}))
+	_, err := s.Validate(ctx)
+	var report *PreflightReport
+	if !errors.As(err, &report) {
+		t.Fatalf("Validate error = %v, want a *PreflightReport", err)
+	}
+
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Capability+" "+failed[0].Operation+" "+failed[0].Table != "provisioning create sys_user_grmember" {
+		t.Fatalf("failed checks = %v, want only provisioning create sys_user_grmember", failed)
+	}
+	if !strings.Contains(failed[0].Err.Error(), "user_admin") {
+		t.Errorf("error %q doesn't name the role the ACL requires", failed[0].Err)
+	}
+	if warnings := report.Warnings(); len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none", warnings)
+	}
+}
@@ -20,18 +20,25 @@ const roleMembership = "member"
 type roleResourceType struct {
 	resourceType *v2.ResourceType
 	client       *servicenow.Client
+	userGrants   *pagePrefetcher[servicenow.UserToRole]
+	groupGrants  *pagePrefetcher[servicenow.GroupToRole]
+	expiries     *grantExpiryIndex
 }
 
 func (r *roleResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 	return r.resourceType
 }
 
-// Create a new connector resource for an ServiceNow Role.
-func roleResource(role *servicenow.Role) (*v2.Resource, error) {
+// Create a new connector resource for an ServiceNow Role. A role of a
+// scoped application has the application as its parent.
+func roleResource(role *servicenow.Role, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"role_name": role.Name,
 		"role_id":   role.Id,
 	}
+	if role.SysScope != "" {
+		profile["scope_id"] = role.SysScope
+	}
 
 	resource, err := rs.NewRoleResource(
 		role.Name,
@@ -39,6 +46,7 @@ func roleResource(role *servicenow.Role) (*v2.Resource, error) {
 		role.Id,
 		nil,
 		rs.WithResourceProfile(profile),
+		rs.WithParentResourceID(parentResourceID),
 	)
 
 	if err != nil {
@@ -48,16 +56,33 @@ func roleResource(role *servicenow.Role) (*v2.Resource, error) {
 	return resource, nil
 }
 
-func (r *roleResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+// List lists every role at the top level or, when applications are synced,
+// the global roles at the top level and the roles of a scoped application
+// under it.
+func (r *roleResourceType) List(ctx context.Context, parentResourceID *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
 	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeRole.Id})
 	if err != nil {
 		return nil, "", nil, err
 	}
 
-	roles, nextPageToken, annos, err := r.client.GetRoles(
-		ctx,
-		page,
-	)
+	scopeID := servicenow.GlobalScope
+	if parentResourceID != nil {
+		if parentResourceID.ResourceType != resourceTypeApplication.Id {
+			return nil, "", nil, nil
+		}
+		scopeID = parentResourceID.Resource
+	} else if pt.Token == "" {
+		r.expiries.reset()
+	}
+
+	var roles []servicenow.Role
+	var nextPageToken string
+	var annos annotations.Annotations
+	if r.client.SyncApplications {
+		roles, nextPageToken, annos, err = r.client.GetRolesInScope(ctx, scopeID, page)
+	} else {
+		roles, nextPageToken, annos, err = r.client.GetRoles(ctx, page)
+	}
 	if err != nil {
 		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list roles: %w", err)
 	}
@@ -70,7 +95,7 @@ func (r *roleResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagin
 	var rv []*v2.Resource
 	for _, role := range roles {
 		roleCopy := role
-		rr, err := roleResource(&roleCopy)
+		rr, err := roleResource(&roleCopy, parentResourceID)
 
 		if err != nil {
 			return nil, "", annos, err
@@ -113,6 +138,11 @@ func (r *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt
 	var annos annotations.Annotations
 	switch bag.ResourceTypeID() {
 	case resourceTypeRole.Id:
+		// Both tables' first pages are requested now, so the group listing
+		// is already in flight while the user pages are read.
+		r.userGrants.start(ctx, resource.Id.Resource, page)
+		r.groupGrants.start(ctx, resource.Id.Resource, page)
+
 		bag.Pop()
 		bag.Push(pagination.PageState{
 			ResourceTypeID: resourceTypeGroup.Id,
@@ -122,12 +152,7 @@ func (r *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt
 		})
 
 	case resourceTypeUser.Id:
-		usersToRoles, nextPageToken, userAnnos, err := r.client.GetUserToRole(
-			ctx,
-			"", // all users, domain-filtered when allowed-domains is set
-			resource.Id.Resource,
-			page,
-		)
+		usersToRoles, nextPageToken, userAnnos, err := r.userGrants.get(ctx, resource.Id.Resource, page)
 		annos = userAnnos
 		if err != nil {
 			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list users under role %s: %w", resource.Id.Resource, err)
@@ -140,6 +165,16 @@ func (r *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt
 
 		// for each roleBinding, create a grant
 		for _, roleBinding := range usersToRoles {
+			expires, expiryAnnos, err := r.expiries.expiresAt(ctx, servicenow.GrantExpiryUserRole, roleBinding.User, resource.Id.Resource)
+			annos = append(expiryAnnos, annos...)
+			if err != nil {
+				return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up grant expiries: %w", err)
+			}
+			grantOpts, err := grantExpiryOptions(expires)
+			if err != nil {
+				return nil, "", annos, err
+			}
+
 			rv = append(
 				rv,
 				grant.NewGrant(
@@ -149,17 +184,13 @@ func (r *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt
 						ResourceType: resourceTypeUser.Id,
 						Resource:     roleBinding.User,
 					},
+					grantOpts...,
 				),
 			)
 		}
 
 	case resourceTypeGroup.Id:
-		groupsToRoles, nextPageToken, groupAnnos, err := r.client.GetGroupToRole(
-			ctx,
-			"", // all groups
-			resource.Id.Resource,
-			page,
-		)
+		groupsToRoles, nextPageToken, groupAnnos, err := r.groupGrants.get(ctx, resource.Id.Resource, page)
 		annos = groupAnnos
 		if err != nil {
 			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list groups under role %s: %w", resource.Id.Resource, err)
@@ -210,7 +241,8 @@ func (r *roleResourceType) helperGrantForGroup(role servicenow.GroupToRole) []gr
 	return grantOptions
 }
 
-func (r *roleResourceType) GrantToUser(ctx context.Context, l *zap.Logger, principal string, roleId string) (annotations.Annotations, error) {
+func (r *roleResourceType) GrantToUser(ctx context.Context, l *zap.Logger, principal string, role *v2.Resource) (annotations.Annotations, error) {
+	roleId := role.Id.Resource
 	userRoles, _, annos, err := r.client.GetUserToRole(
 		ctx,
 		principal,
@@ -235,6 +267,12 @@ func (r *roleResourceType) GrantToUser(ctx context.Context, l *zap.Logger, princ
 		return annos, nil
 	}
 
+	expiryAnnos, err := r.expiries.recordGrantExpiry(ctx, servicenow.GrantExpiryUserRole, principal, role)
+	annos = append(expiryAnnos, annos...)
+	if err != nil {
+		return annos, err
+	}
+
 	// grant the role to the user
 	annos, err = r.client.GrantRoleToUser(
 		ctx,
@@ -308,7 +346,7 @@ func (r *roleResourceType) Grant(ctx context.Context, principal *v2.Resource, en
 	roleId := entitlement.Resource.Id.Resource
 
 	if principalIsUser {
-		return r.GrantToUser(ctx, l, principal.Id.Resource, roleId)
+		return r.GrantToUser(ctx, l, principal.Id.Resource, entitlement.Resource)
 	}
 
 	if principalIsGroup {
@@ -319,13 +357,19 @@ func (r *roleResourceType) Grant(ctx context.Context, principal *v2.Resource, en
 }
 
 func (r *roleResourceType) RevokeFromUser(ctx context.Context, l *zap.Logger, principal *v2.Resource, roleId string) (annotations.Annotations, error) {
+	annos, err := r.client.RequireUserInSysDomain(ctx, principal.Id.Resource)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: cannot revoke role %s from user %s: %w", roleId, principal.Id.Resource, err)
+	}
+
 	// check if role is present
-	userRoles, _, annos, err := r.client.GetUserToRole(
+	userRoles, _, roleAnnos, err := r.client.GetUserToRole(
 		ctx,
 		principal.Id.Resource,
 		roleId,
-		servicenow.KeysetPaginationVars{Limit: 1},
+		servicenow.KeysetPaginationVars{Limit: ResourcesPageSize},
 	)
+	annos = append(roleAnnos, annos...)
 	if err != nil {
 		return annos, fmt.Errorf("baton-servicenow: failed to get user roles for %s: %w", principal.Id.Resource, err)
 	}
@@ -344,29 +388,31 @@ func (r *roleResourceType) RevokeFromUser(ctx context.Context, l *zap.Logger, pr
 	}
 
 	// revoke all roles (inherited or not) from the user
-	for _, userRole := range userRoles {
-		annos, err = r.client.RevokeRoleFromUser(
-			ctx,
-			userRole.Id,
-		)
-		if err != nil {
-			return annos, fmt.Errorf("baton-servicenow: failed to revoke role %s from user %s: %w", roleId, principal.Id.Resource, err)
-		}
-
-		l.Debug("revoked role from user", zap.String("role", roleId))
+	annos, err = r.client.RevokeUserRoles(ctx, sysIDs(userRoles, func(r servicenow.UserToRole) string { return r.Id }))
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to revoke role %s from user %s: %w", roleId, principal.Id.Resource, err)
 	}
 
-	return annos, nil
+	l.Debug("revoked role from user", zap.String("role", roleId), zap.Int("rows", len(userRoles)))
+
+	expiryAnnos, err := r.expiries.clearGrantExpiry(ctx, servicenow.GrantExpiryUserRole, principal.Id.Resource, roleId)
+	return append(expiryAnnos, annos...), err
 }
 
 func (r *roleResourceType) RevokeFromGroup(ctx context.Context, l *zap.Logger, principal *v2.Resource, roleId string) (annotations.Annotations, error) {
+	annos, err := r.client.RequireGroupInSysDomain(ctx, principal.Id.Resource)
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: cannot revoke role %s from group %s: %w", roleId, principal.Id.Resource, err)
+	}
+
 	// check if role is present
-	groupRoles, _, annos, err := r.client.GetGroupToRole(
+	groupRoles, _, roleAnnos, err := r.client.GetGroupToRole(
 		ctx,
 		principal.Id.Resource,
 		roleId,
-		servicenow.KeysetPaginationVars{Limit: 1},
+		servicenow.KeysetPaginationVars{Limit: ResourcesPageSize},
 	)
+	annos = append(roleAnnos, annos...)
 	if err != nil {
 		return annos, fmt.Errorf("baton-servicenow: failed to get group roles for %s: %w", principal.Id.Resource, err)
 	}
@@ -382,18 +428,13 @@ func (r *roleResourceType) RevokeFromGroup(ctx context.Context, l *zap.Logger, p
 	}
 
 	// revoke all roles (inherited or not) from the group
-	for _, groupRole := range groupRoles {
-		annos, err = r.client.RevokeRoleFromGroup(
-			ctx,
-			groupRole.Id,
-		)
-		if err != nil {
-			return annos, fmt.Errorf("baton-servicenow: failed to revoke role %s from group %s: %w", roleId, principal.Id.Resource, err)
-		}
-
-		l.Debug("revoked role from group", zap.String("role", roleId))
+	annos, err = r.client.RevokeGroupRoles(ctx, sysIDs(groupRoles, func(r servicenow.GroupToRole) string { return r.Id }))
+	if err != nil {
+		return annos, fmt.Errorf("baton-servicenow: failed to revoke role %s from group %s: %w", roleId, principal.Id.Resource, err)
 	}
 
+	l.Debug("revoked role from group", zap.String("role", roleId), zap.Int("rows", len(groupRoles)))
+
 	return annos, nil
 }
 
@@ -432,5 +473,12 @@ func roleBuilder(client *servicenow.Client) *roleResourceType {
 	return &roleResourceType{
 		resourceType: resourceTypeRole,
 		client:       client,
+		userGrants: newPagePrefetcher("sys_user_has_role", func(ctx context.Context, roleID string, page servicenow.KeysetPaginationVars) ([]servicenow.UserToRole, string, annotations.Annotations, error) {
+			return client.GetUserToRole(ctx, "", roleID, page) // all users, domain-filtered when allowed-domains is set
+		}),
+		groupGrants: newPagePrefetcher("sys_group_has_role", func(ctx context.Context, roleID string, page servicenow.KeysetPaginationVars) ([]servicenow.GroupToRole, string, annotations.Annotations, error) {
+			return client.GetGroupToRole(ctx, "", roleID, page) // all groups
+		}),
+		expiries: newGrantExpiryIndex(client),
 	}
 }
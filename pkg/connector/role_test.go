@@ -15,7 +15,7 @@ func TestRoleResource_ProfileSurfacesOnResource(t *testing.T) {
 		Name:         "admin",
 	}
 
-	resource, err := roleResource(role)
+	resource, err := roleResource(role, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+// SizingRow is one sync listing in a sizing report.
+type SizingRow struct {
+	Listing  string
+	Rows     int
+	PageSize int
+	Requests int
+}
+
+// SizingReport estimates how many Table API requests a full sync makes.
+type SizingReport struct {
+	Rows []SizingRow
+}
+
+// TotalRequests sums the per-listing estimates.
+func (r *SizingReport) TotalRequests() int {
+	total := 0
+	for _, row := range r.Rows {
+		total += row.Requests
+	}
+	return total
+}
+
+// listingPages is how many pages a keyset listing of rows takes: only an
+// empty page ends one, so a listing always costs one request past its rows.
+func listingPages(rows int, pageSize int) int {
+	return (rows+pageSize-1)/pageSize + 1
+}
+
+// EstimateSyncRequests turns row counts into a request estimate. Membership
+// listings run once per parent (group or role), so each parent adds its own
+// closing page on top of the pages its rows need; the estimate assumes rows
+// fill pages evenly across parents, which makes it a lower bound when a few
+// parents hold most of the rows. Roles are listed once for the global scope
+// and, when applications are synced, once per application. Delegations are
+// listed once for every user, not per user. Each user criteria and each
+// CMDB CI costs two lookups, one for its users and one for its groups. The user criteria link tables aren't counted. Each HR role
+// lists its users and its groups; HR groups' members aren't counted. The
+// roles ACLs require are read in one listing, which isn't counted either.
+func EstimateSyncRequests(counts servicenow.SyncCounts, userScopedPageSize int) *SizingReport {
+	perParent := func(parents int, rows int, pageSize int) int {
+		return parents + (rows+pageSize-1)/pageSize
+	}
+
+	report := &SizingReport{Rows: []SizingRow{
+		{"users", counts.Users, userScopedPageSize, listingPages(counts.Users, userScopedPageSize)},
+		{"groups", counts.Groups, ResourcesPageSize, listingPages(counts.Groups, ResourcesPageSize)},
+		{"roles", counts.Roles, ResourcesPageSize, perParent(counts.Applications+1, counts.Roles, ResourcesPageSize)},
+		{"group members", counts.GroupMembers, userScopedPageSize, perParent(counts.Groups, counts.GroupMembers, userScopedPageSize)},
+		{"user roles", counts.UserRoles, userScopedPageSize, perParent(counts.Roles, counts.UserRoles, userScopedPageSize)},
+		{"group roles", counts.GroupRoles, ResourcesPageSize, perParent(counts.Roles, counts.GroupRoles, ResourcesPageSize)},
+		{"delegates", counts.Delegations, ResourcesPageSize, listingPages(counts.Delegations, ResourcesPageSize)},
+	}}
+	// Applications are counted only when they're synced.
+	if counts.Applications > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"applications", counts.Applications, ResourcesPageSize, listingPages(counts.Applications, ResourcesPageSize)},
+		)
+	}
+	// So are subscriptions.
+	if counts.Subscriptions > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"subscriptions", counts.Subscriptions, ResourcesPageSize, listingPages(counts.Subscriptions, ResourcesPageSize)},
+			SizingRow{"subscription users", counts.SubscriptionUsers, userScopedPageSize, perParent(counts.Subscriptions, counts.SubscriptionUsers, userScopedPageSize)},
+		)
+	}
+	// So are user criteria.
+	if counts.UserCriteria > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"user criteria", counts.UserCriteria, ResourcesPageSize, listingPages(counts.UserCriteria, ResourcesPageSize)},
+			SizingRow{"user criteria principals", counts.UserCriteria, 1, 2 * counts.UserCriteria},
+		)
+	}
+	// So are CMDB CIs.
+	if cis := counts.BusinessApplications + counts.BusinessServices; cis > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"business applications", counts.BusinessApplications, ResourcesPageSize, listingPages(counts.BusinessApplications, ResourcesPageSize)},
+			SizingRow{"business services", counts.BusinessServices, ResourcesPageSize, listingPages(counts.BusinessServices, ResourcesPageSize)},
+			SizingRow{"CI owners", cis, 1, 2 * cis},
+		)
+	}
+	// So are HR roles.
+	if counts.HRRoles > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"HR roles", counts.HRRoles, ResourcesPageSize, listingPages(counts.HRRoles, ResourcesPageSize)},
+			SizingRow{"HR role grants", counts.HRRoles, 1, 2 * counts.HRRoles},
+			SizingRow{"HR group roles", counts.HRGroupRoles, ResourcesPageSize, listingPages(counts.HRGroupRoles, ResourcesPageSize)},
+		)
+	}
+	// So are ACLs.
+	if counts.ACLs > 0 {
+		report.Rows = append(report.Rows,
+			SizingRow{"ACLs", counts.ACLs, ResourcesPageSize, listingPages(counts.ACLs, ResourcesPageSize)},
+		)
+	}
+	return report
+}
+
+// Sizing counts what a sync would list and estimates the requests it takes,
+// without syncing.
+func (s *ServiceNow) Sizing(ctx context.Context) (*SizingReport, annotations.Annotations, error) {
+	counts, annos, err := s.client.GetSyncCounts(ctx)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: %w", err)
+	}
+
+	report := EstimateSyncRequests(*counts, s.client.UserScopedPageSize(ResourcesPageSize))
+	if s.client.SyncEffectiveRoles {
+		// At least one sys_user_has_role listing per user.
+		report.Rows = append(report.Rows, SizingRow{"effective roles", counts.Users, 1, counts.Users})
+	}
+	return report, annos, nil
+}
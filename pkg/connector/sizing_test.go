@@ -0,0 +1,34 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+func TestEstimateSyncRequests(t *testing.T) {
+	counts := servicenow.SyncCounts{Users: 1200, Groups: 40, Roles: 15, GroupMembers: 3000, UserRoles: 900, GroupRoles: 0, Applications: 3, Delegations: 12}
+
+	report := EstimateSyncRequests(counts, 50)
+
+	want := map[string]int{
+		"users":         25,      // 24 full pages + the empty one
+		"groups":        2,       // 1 page + the empty one
+		"roles":         4 + 1,   // a closing page for global and each application + 15/50
+		"group members": 40 + 60, // a closing page per group + 3000/50
+		"user roles":    15 + 18, // a closing page per role + 900/50
+		"group roles":   15,      // only the closing page per role
+		"applications":  2,       // 1 page + the empty one
+		"delegates":     2,       // 1 page + the empty one
+	}
+	total := 0
+	for _, row := range report.Rows {
+		if row.Requests != want[row.Listing] {
+			t.Errorf("%s: %d requests, want %d", row.Listing, row.Requests, want[row.Listing])
+		}
+		total += want[row.Listing]
+	}
+	if report.TotalRequests() != total {
+		t.Errorf("total = %d, want %d", report.TotalRequests(), total)
+	}
+}
@@ -0,0 +1,151 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+const subscriptionMember = "member"
+
+type subscriptionResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+	userGrants   *pagePrefetcher[servicenow.SubscriptionUser]
+}
+
+func (s *subscriptionResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// Create a new connector resource for a ServiceNow subscription. The
+// purchased and allocated counts go on the license profile trait as well as
+// the profile; a count ServiceNow left empty is 0 on the trait.
+func subscriptionResource(subscription *servicenow.Subscription) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"subscription_name": subscription.Name,
+		"subscription_id":   subscription.Id,
+		"purchased":         subscription.Purchased,
+		"allocated":         subscription.Allocated,
+		"start_date":        subscription.StartDate,
+		"end_date":          subscription.EndDate,
+	}
+
+	purchased, _ := strconv.ParseInt(subscription.Purchased, 10, 64)
+	allocated, _ := strconv.ParseInt(subscription.Allocated, 10, 64)
+	memberID := ent.NewEntitlementID(&v2.Resource{
+		Id: &v2.ResourceId{ResourceType: resourceTypeSubscription.Id, Resource: subscription.Id},
+	}, subscriptionMember)
+
+	resource, err := rs.NewResource(
+		subscription.Name,
+		resourceTypeSubscription,
+		subscription.Id,
+		rs.WithResourceProfile(profile),
+		rs.WithLicenseProfileTrait(
+			rs.WithLicenseName(subscription.Name),
+			rs.WithLicenseSeats(purchased, allocated),
+			rs.WithLicenseEntitlementIDs(memberID),
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (s *subscriptionResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeSubscription.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	subscriptions, nextPageToken, annos, err := s.client.GetSubscriptions(ctx, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list subscriptions: %w", err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, subscription := range subscriptions {
+		subscriptionCopy := subscription
+		sr, err := subscriptionResource(&subscriptionCopy)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, sr)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (s *subscriptionResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(
+			resource,
+			subscriptionMember,
+			ent.WithGrantableTo(resourceTypeUser),
+			ent.WithDisplayName(fmt.Sprintf("%s Subscription %s", resource.DisplayName, subscriptionMember)),
+			ent.WithDescription(fmt.Sprintf("Allocated a seat of the %s subscription in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+func (s *subscriptionResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeSubscription.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	allocations, nextPageToken, annos, err := s.userGrants.get(ctx, resource.Id.Resource, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list users of subscription %s: %w", resource.Id.Resource, err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Grant
+	for _, allocation := range allocations {
+		rv = append(
+			rv,
+			grant.NewGrant(
+				resource,
+				subscriptionMember,
+				&v2.ResourceId{
+					ResourceType: resourceTypeUser.Id,
+					Resource:     allocation.User,
+				},
+			),
+		)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func subscriptionBuilder(client *servicenow.Client) *subscriptionResourceType {
+	return &subscriptionResourceType{
+		resourceType: resourceTypeSubscription,
+		client:       client,
+		userGrants: newPagePrefetcher("license_has_user", func(ctx context.Context, subscriptionID string, page servicenow.KeysetPaginationVars) ([]servicenow.SubscriptionUser, string, annotations.Annotations, error) {
+			return client.GetSubscriptionUsers(ctx, subscriptionID, page)
+		}),
+	}
+}
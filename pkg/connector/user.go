@@ -2,19 +2,25 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/crypto"
 	"github.com/conductorone/baton-sdk/pkg/pagination"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
 	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
 )
 
 type userResourceType struct {
 	resourceType *v2.ResourceType
 	client       *servicenow.Client
+	delegations  *delegationIndex
 }
 
 func (u *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -31,6 +37,9 @@ func userResource(user *servicenow.User) (*v2.Resource, error) {
 		"last_name":  user.LastName,
 		"active":     user.Active,
 	}
+	if user.SysDomain != "" {
+		profile["domain"] = user.SysDomain
+	}
 
 	for k, v := range user.CustomFields {
 		profile[k] = v
@@ -73,6 +82,9 @@ func (u *userResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagin
 	if err != nil {
 		return nil, "", nil, err
 	}
+	if pt.Token == "" {
+		u.delegations.reset()
+	}
 
 	users, nextPageToken, annos, err := u.client.GetUsers(
 		ctx,
@@ -96,35 +108,137 @@ func (u *userResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagin
 			return nil, "", annos, err
 		}
 
+		roleAnnos, err := u.withEffectiveRoles(ctx, ur)
+		annos = append(roleAnnos, annos...)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
 		rv = append(rv, ur)
 	}
 
 	return rv, nextPage, annos, nil
 }
 
-func (u *userResourceType) Entitlements(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
-}
-
-func (u *userResourceType) Grants(ctx context.Context, resource *v2.Resource, token *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
-}
-
 func userBuilder(client *servicenow.Client) *userResourceType {
 	return &userResourceType{
 		resourceType: resourceTypeUser,
 		client:       client,
+		delegations:  newDelegationIndex(client),
 	}
 }
 
+// optionalAccountFields are the optional sys_user columns offered in the
+// account creation schema, in display order. Keys are the column names, so
+// CreateAccount passes them through unchanged. Reference columns (manager,
+// company, location) take the referenced record's sys_id.
+var optionalAccountFields = []struct {
+	name        string
+	displayName string
+	description string
+	placeholder string
+}{
+	{"title", "Title", "User's job title", "Software Engineer"},
+	{"department", "Department", "sys_id of the user's department (cmn_department)", "a581ab703710200044e0bfc8bcbe5de8"},
+	{"manager", "Manager", "sys_id of the user's manager (sys_user)", "6816f79cc0a8016401c5a33be04be441"},
+	{"company", "Company", "sys_id of the user's company (core_company)", "31bea3d53790200044e0bfc8bcbe5dec"},
+	{"location", "Location", "sys_id of the user's location (cmn_location)", "25ab9c4d0a0a0bb300f7dabdc0ca7c1c"},
+	{"time_zone", "Time Zone", "User's time zone", "America/Los_Angeles"},
+}
+
+// accountCreationSchema is the schema C1 renders for CreateAccount: the four
+// required identity fields, the optional profile fields, then one optional
+// field per configured custom user field.
+func accountCreationSchema(customUserFields []string) *v2.ConnectorAccountCreationSchema {
+	fieldMap := map[string]*v2.ConnectorAccountCreationSchema_Field{
+		"username": {
+			DisplayName: "Username",
+			Required:    true,
+			Description: "Username of the user",
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Placeholder: "John08",
+			Order:       1,
+		},
+		"email": {
+			DisplayName: "Email",
+			Required:    true,
+			Description: "Email address of the user",
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Placeholder: "user@example.com",
+			Order:       2,
+		},
+		"first_name": {
+			DisplayName: "First Name",
+			Required:    true,
+			Description: "User's first name",
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Placeholder: "John",
+			Order:       3,
+		},
+		"last_name": {
+			DisplayName: "Last Name",
+			Required:    true,
+			Description: "User's last name",
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Placeholder: "Travolta",
+			Order:       4,
+		},
+	}
+
+	order := int32(len(fieldMap))
+	for _, f := range optionalAccountFields {
+		order++
+		fieldMap[f.name] = &v2.ConnectorAccountCreationSchema_Field{
+			DisplayName: f.displayName,
+			Description: f.description,
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Placeholder: f.placeholder,
+			Order:       order,
+		}
+	}
+
+	for _, name := range customUserFields {
+		// Same rule as the sync side (prepareUserFilters): only u_ columns.
+		if !strings.HasPrefix(name, "u_") {
+			continue
+		}
+		if _, exists := fieldMap[name]; exists {
+			continue
+		}
+		order++
+		fieldMap[name] = &v2.ConnectorAccountCreationSchema_Field{
+			DisplayName: name,
+			Description: fmt.Sprintf("Custom user field %s", name),
+			Field: &v2.ConnectorAccountCreationSchema_Field_StringField{
+				StringField: &v2.ConnectorAccountCreationSchema_StringField{},
+			},
+			Order: order,
+		}
+	}
+
+	return &v2.ConnectorAccountCreationSchema{FieldMap: fieldMap}
+}
+
 // CreateAccountCapabilityDetails returns the account provisioning capabilities of this connector.
-// In this case, only account creation without password is supported.
+// Accounts are created without a password by default (SSO), or with a random
+// local password that must be reset at first login.
 func (u *userResourceType) CreateAccountCapabilityDetails(
 	_ context.Context,
 ) (*v2.CredentialDetailsAccountProvisioning, annotations.Annotations, error) {
 	return &v2.CredentialDetailsAccountProvisioning{
 		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
 			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
 		},
 		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_NO_PASSWORD,
 	}, nil, nil
@@ -133,7 +247,7 @@ func (u *userResourceType) CreateAccountCapabilityDetails(
 func (u *userResourceType) CreateAccount(
 	ctx context.Context,
 	accountInfo *v2.AccountInfo,
-	_ *v2.LocalCredentialOptions,
+	credentialOptions *v2.LocalCredentialOptions,
 ) (connectorbuilder.CreateAccountResponse, []*v2.PlaintextData,
 	annotations.Annotations,
 	error) {
@@ -168,15 +282,129 @@ func (u *userResourceType) CreateAccount(
 		"active":     "true",
 	}
 
+	for _, f := range optionalAccountFields {
+		if v, ok := profile[f.name].(string); ok && v != "" {
+			user[f.name] = v
+		}
+	}
+	for _, name := range u.client.CustomUserFields {
+		if !strings.HasPrefix(name, "u_") {
+			continue
+		}
+		if v, ok := profile[name].(string); ok && v != "" {
+			user[name] = v
+		}
+	}
+	if u.client.SysDomain != "" {
+		user["sys_domain"] = u.client.SysDomain
+	}
+
+	// Generate before creating anything, so a bad length/constraint fails
+	// without leaving a half-provisioned account behind.
+	var password string
+	if credentialOptions.GetRandomPassword() != nil {
+		var err error
+		password, err = crypto.GeneratePassword(ctx, credentialOptions)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("baton-servicenow: failed to generate password: %w", err)
+		}
+	}
+
 	createdUser, annos, err := u.client.CreateUserAccount(ctx, user)
 	if err != nil {
 		return nil, nil, annos, fmt.Errorf("baton-servicenow: failed to create user: %w", err)
 	}
 
+	var plaintexts []*v2.PlaintextData
+	if password != "" {
+		passwordAnnos, err := u.client.SetUserPassword(ctx, createdUser.Id, password, true)
+		annos = append(passwordAnnos, annos...)
+		if err != nil {
+			// A user without the password C1 was promised is no use, and
+			// a retried create would collide with it on user_name. The
+			// password can't go in the create itself: it needs
+			// sysparm_input_display_value, which would make sys_domain
+			// expect a name.
+			deleteAnnos, deleteErr := u.client.DeleteUser(ctx, createdUser.Id)
+			annos = append(deleteAnnos, annos...)
+			if deleteErr != nil {
+				return nil, nil, annos, fmt.Errorf("baton-servicenow: created user %s but failed to set its password, and failed to delete it again: %w", createdUser.Id, errors.Join(err, deleteErr))
+			}
+			return nil, nil, annos, fmt.Errorf("baton-servicenow: failed to set the password of new user %s, so it was deleted again: %w", createdUser.Id, err)
+		}
+		plaintexts = append(plaintexts, passwordPlaintext(password, true))
+	}
+
 	resource, err := userResource(createdUser)
 	if err != nil {
 		return nil, nil, annos, fmt.Errorf("baton-servicenow: failed to create user resource: %w", err)
 	}
 
-	return &v2.CreateAccountResponse_SuccessResult{Resource: resource}, nil, annos, nil
+	return &v2.CreateAccountResponse_SuccessResult{Resource: resource}, plaintexts, annos, nil
+}
+
+// passwordPlaintext wraps a generated password for the SDK, which encrypts
+// it before it leaves the connector.
+func passwordPlaintext(password string, needsReset bool) *v2.PlaintextData {
+	description := "ServiceNow local password"
+	if needsReset {
+		description += "; must be changed at next login"
+	}
+	return &v2.PlaintextData{
+		Name:        "password",
+		Description: description,
+		Bytes:       []byte(password),
+	}
+}
+
+// RotateCapabilityDetails returns the credential rotation capabilities of this
+// connector: local ServiceNow passwords are replaced with a random one.
+func (u *userResourceType) RotateCapabilityDetails(
+	_ context.Context,
+) (*v2.CredentialDetailsCredentialRotation, annotations.Annotations, error) {
+	return &v2.CredentialDetailsCredentialRotation{
+		SupportedCredentialOptions: []v2.CapabilityDetailCredentialOption{
+			v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
+		},
+		PreferredCredentialOption: v2.CapabilityDetailCredentialOption_CAPABILITY_DETAIL_CREDENTIAL_OPTION_RANDOM_PASSWORD,
+	}, nil, nil
+}
+
+// Rotate sets a new random local password on a sys_user, for break-glass and
+// integration accounts that don't log in through SSO. The password honours
+// the length and character-set constraints C1 sends (which should mirror the
+// instance's password policy), and a reset at next login is forced only when
+// requested -- an integration account has nobody to do the reset.
+func (u *userResourceType) Rotate(
+	ctx context.Context,
+	resourceId *v2.ResourceId,
+	credentialOptions *v2.LocalCredentialOptions,
+) ([]*v2.PlaintextData, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if resourceId.GetResourceType() != resourceTypeUser.Id {
+		return nil, nil, fmt.Errorf("baton-servicenow: only user credentials can be rotated, got %s", resourceId.GetResourceType())
+	}
+
+	if credentialOptions.GetRandomPassword() == nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: only random password rotation is supported")
+	}
+
+	password, err := crypto.GeneratePassword(ctx, credentialOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("baton-servicenow: failed to generate password: %w", err)
+	}
+
+	needsReset := credentialOptions.GetForceChangeAtNextLogin()
+	annos, err := u.client.SetUserPassword(ctx, resourceId.GetResource(), password, needsReset)
+	if err != nil {
+		return nil, annos, fmt.Errorf("baton-servicenow: failed to rotate password for user %s: %w", resourceId.GetResource(), err)
+	}
+
+	l.Info("rotated user password",
+		zap.String("userId", resourceId.GetResource()),
+		zap.Bool("password_needs_reset", needsReset),
+	)
+
+	return []*v2.PlaintextData{passwordPlaintext(password, needsReset)}, annos, nil
 }
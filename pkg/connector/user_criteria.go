@@ -0,0 +1,224 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow"
+)
+
+const userCriteriaMembership = "member"
+
+// userCriteriaLinkProfileKeys names the profile list each link table fills.
+var userCriteriaLinkProfileKeys = map[string]string{
+	servicenow.KnowledgeBaseCanRead:       "knowledge_bases_can_read",
+	servicenow.KnowledgeBaseCanContribute: "knowledge_bases_can_contribute",
+	servicenow.KnowledgeBaseCannotRead:    "knowledge_bases_cannot_read",
+	servicenow.CatalogItemAvailable:       "catalog_items_available",
+	servicenow.CatalogItemNotAvailable:    "catalog_items_not_available",
+}
+
+// userCriteriaResourceType syncs user criteria, granting their member
+// entitlement to the users and groups they list by name. Criteria that
+// match by role, department, company, location or script aren't expanded;
+// the profile carries those conditions as they are.
+type userCriteriaResourceType struct {
+	resourceType *v2.ResourceType
+	client       *servicenow.Client
+	links        *userCriteriaLinkIndex
+}
+
+func (u *userCriteriaResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return u.resourceType
+}
+
+// Create a new connector resource for a user criteria. links holds the
+// names of the knowledge bases and catalog items it applies to, by link
+// table.
+func userCriteriaResource(uc *servicenow.UserCriteria, links map[string][]string) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"criteria_name": uc.Name,
+		"criteria_id":   uc.Id,
+		"active":        uc.Active,
+		"match_all":     uc.MatchAll,
+		"advanced":      uc.Advanced,
+		"users":         uc.User,
+		"groups":        uc.Group,
+		"roles":         uc.Role,
+		"departments":   uc.Department,
+		"companies":     uc.Company,
+		"locations":     uc.Location,
+	}
+	for table, key := range userCriteriaLinkProfileKeys {
+		names := make([]interface{}, 0, len(links[table]))
+		for _, name := range links[table] {
+			names = append(names, name)
+		}
+		profile[key] = names
+	}
+
+	resource, err := rs.NewGroupResource(
+		uc.Name,
+		resourceTypeUserCriteria,
+		uc.Id,
+		nil,
+		rs.WithResourceProfile(profile),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (u *userCriteriaResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
+	bag, page, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: resourceTypeUserCriteria.Id})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if pt.Token == "" {
+		u.links.reset()
+	}
+
+	criteria, nextPageToken, annos, err := u.client.GetUserCriteria(ctx, page)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list user criteria: %w", err)
+	}
+
+	nextPage, err := bag.NextToken(nextPageToken)
+	if err != nil {
+		return nil, "", annos, err
+	}
+
+	var rv []*v2.Resource
+	for _, uc := range criteria {
+		ucCopy := uc
+		links, linkAnnos, err := u.links.forCriteria(ctx, uc.Id)
+		annos = append(linkAnnos, annos...)
+		if err != nil {
+			return nil, "", annos, fmt.Errorf("baton-servicenow: failed to list what user criteria apply to: %w", err)
+		}
+		ur, err := userCriteriaResource(&ucCopy, links)
+		if err != nil {
+			return nil, "", annos, err
+		}
+
+		rv = append(rv, ur)
+	}
+
+	return rv, nextPage, annos, nil
+}
+
+func (u *userCriteriaResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(
+			resource,
+			userCriteriaMembership,
+			ent.WithGrantableTo(resourceTypeUser, resourceTypeGroup),
+			ent.WithDisplayName(fmt.Sprintf("%s User Criteria %s", resource.DisplayName, userCriteriaMembership)),
+			ent.WithDescription(fmt.Sprintf("Listed by name on the %s user criteria in ServiceNow", resource.DisplayName)),
+		),
+	}, "", nil, nil
+}
+
+// Grants returns a grant per user and group the criteria lists, each only
+// when the sync lists it too. A group's grant expands to its members.
+func (u *userCriteriaResourceType) Grants(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+	profile := resource.GetProfile()
+	users, _ := rs.GetProfileStringValue(profile, "users")
+	groups, _ := rs.GetProfileStringValue(profile, "groups")
+	userIDs := servicenow.ListIDs(users)
+	groupIDs := servicenow.ListIDs(groups)
+
+	syncedUsers, annos, err := u.client.SyncedUserIDs(ctx, userIDs...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up users of user criteria %s: %w", resource.Id.Resource, err)
+	}
+	syncedGroups, groupAnnos, err := u.client.SyncedGroupIDs(ctx, groupIDs...)
+	annos = append(groupAnnos, annos...)
+	if err != nil {
+		return nil, "", annos, fmt.Errorf("baton-servicenow: failed to look up groups of user criteria %s: %w", resource.Id.Resource, err)
+	}
+
+	var rv []*v2.Grant
+	for _, userID := range userIDs {
+		if syncedUsers[userID] {
+			rv = append(rv, grant.NewGrant(
+				resource,
+				userCriteriaMembership,
+				&v2.ResourceId{
+					ResourceType: resourceTypeUser.Id,
+					Resource:     userID,
+				},
+			))
+		}
+	}
+	for _, groupID := range groupIDs {
+		if syncedGroups[groupID] {
+			rv = append(rv, grant.NewGrant(
+				resource,
+				userCriteriaMembership,
+				&v2.ResourceId{
+					ResourceType: resourceTypeGroup.Id,
+					Resource:     groupID,
+				},
+				grant.WithAnnotation(&v2.GrantExpandable{
+					EntitlementIds: []string{fmt.Sprintf("group:%s:%s", groupID, groupMembership)},
+					Shallow:        true,
+				}),
+			))
+		}
+	}
+
+	return rv, "", annos, nil
+}
+
+func userCriteriaBuilder(client *servicenow.Client) *userCriteriaResourceType {
+	return &userCriteriaResourceType{
+		resourceType: resourceTypeUserCriteria,
+		client:       client,
+		links:        newUserCriteriaLinkIndex(client),
+	}
+}
+
+// userCriteriaLinkIndex holds the link tables by criteria, so a sync reads
+// each once rather than once per criteria.
+type userCriteriaLinkIndex struct {
+	*tableIndex[string, map[string][]string]
+}
+
+func newUserCriteriaLinkIndex(client *servicenow.Client) *userCriteriaLinkIndex {
+	return &userCriteriaLinkIndex{newTableIndex(func(ctx context.Context) (map[string]map[string][]string, annotations.Annotations, error) {
+		byCriteria := make(map[string]map[string][]string)
+		var annos annotations.Annotations
+		for _, table := range servicenow.UserCriteriaLinkTables {
+			tableAnnos, err := eachRow(ctx, func(ctx context.Context, page servicenow.KeysetPaginationVars) ([]servicenow.UserCriteriaLink, string, annotations.Annotations, error) {
+				return client.GetUserCriteriaLinks(ctx, table, page)
+			}, func(row servicenow.UserCriteriaLink) {
+				if byCriteria[row.UserCriteria] == nil {
+					byCriteria[row.UserCriteria] = make(map[string][]string)
+				}
+				byCriteria[row.UserCriteria][table] = append(byCriteria[row.UserCriteria][table], row.TargetName())
+			})
+			annos = append(tableAnnos, annos...)
+			if err != nil {
+				return nil, annos, fmt.Errorf("%s: %w", table, err)
+			}
+		}
+		return byCriteria, annos, nil
+	})}
+}
+
+// forCriteria returns the names of what criteriaID applies to, by link
+// table.
+func (x *userCriteriaLinkIndex) forCriteria(ctx context.Context, criteriaID string) (map[string][]string, annotations.Annotations, error) {
+	byCriteria, annos, err := x.get(ctx)
+	return byCriteria[criteriaID], annos, err
+}
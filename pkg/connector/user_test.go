@@ -1,6 +1,7 @@
 package connector
 
 import (
+	"context"
 	"testing"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -48,3 +49,67 @@ func TestUserResource_StatusSurfacesOnResource(t *testing.T) {
 		})
 	}
 }
+
+// The creation schema keeps the four required identity fields, and appends
+// each configured u_ field after the optional profile fields with a unique
+// order, skipping names the sync side would ignore too.
+func TestAccountCreationSchema_IncludesConfiguredCustomFields(t *testing.T) {
+	schema := accountCreationSchema([]string{"u_cost_code", "not_custom", "u_badge"})
+	fields := schema.GetFieldMap()
+
+	for _, name := range []string{"username", "email", "first_name", "last_name"} {
+		if !fields[name].GetRequired() {
+			t.Errorf("field %q should be required", name)
+		}
+	}
+	for _, name := range []string{"title", "department", "manager", "company", "location", "time_zone", "u_cost_code", "u_badge"} {
+		f, ok := fields[name]
+		if !ok {
+			t.Errorf("field %q missing from schema", name)
+			continue
+		}
+		if f.GetRequired() {
+			t.Errorf("field %q should be optional", name)
+		}
+	}
+	if _, ok := fields["not_custom"]; ok {
+		t.Error("a custom field without the u_ prefix should not be offered")
+	}
+
+	seen := map[int32]string{}
+	for name, f := range fields {
+		if other, dup := seen[f.GetOrder()]; dup {
+			t.Errorf("fields %q and %q share order %d", name, other, f.GetOrder())
+		}
+		seen[f.GetOrder()] = name
+	}
+}
+
+func TestRotate_RejectsUnsupportedRequests(t *testing.T) {
+	u := userBuilder(nil)
+	randomPassword := &v2.LocalCredentialOptions{
+		Options: &v2.LocalCredentialOptions_RandomPassword_{
+			RandomPassword: &v2.LocalCredentialOptions_RandomPassword{Length: 16},
+		},
+	}
+
+	if _, _, err := u.Rotate(context.Background(), &v2.ResourceId{ResourceType: resourceTypeGroup.Id, Resource: "g1"}, randomPassword); err == nil {
+		t.Error("rotating a group credential should fail")
+	}
+
+	noPassword := &v2.LocalCredentialOptions{
+		Options: &v2.LocalCredentialOptions_NoPassword_{NoPassword: &v2.LocalCredentialOptions_NoPassword{}},
+	}
+	if _, _, err := u.Rotate(context.Background(), &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "u1"}, noPassword); err == nil {
+		t.Error("rotating without a random password option should fail")
+	}
+}
+
+func TestPasswordPlaintext_DescribesReset(t *testing.T) {
+	if got := passwordPlaintext("x", false).GetDescription(); got != "ServiceNow local password" {
+		t.Errorf("unexpected description without reset: %q", got)
+	}
+	if got := passwordPlaintext("x", true).GetDescription(); got != "ServiceNow local password; must be changed at next login" {
+		t.Errorf("unexpected description with reset: %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// sys_security_acl holds the access control rules; sys_security_acl_role
+// lists the roles each one requires. A record ACL is named after what it
+// guards: "incident" for the rows of a table, "incident.number" for one of
+// its fields and "incident.*" for all of them. operation and type reference
+// sys_security_operation and sys_security_type.
+const (
+	ACLTable     = "sys_security_acl"
+	ACLRoleTable = "sys_security_acl_role"
+)
+
+var ACLFields = []string{
+	"sys_id", "name", "description", "active", "operation", "operation.name", "type", "type.name",
+	"condition", "advanced", "admin_overrides",
+}
+
+// WithACLs turns on syncing active ACLs with the roles they require. It's
+// off by default: an instance has thousands of ACLs, and reading them takes
+// security_admin or a read ACL of its own.
+func WithACLs(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncACLs = enabled
+	}
+}
+
+// GetACLs lists the active ACLs.
+func (c *Client) GetACLs(ctx context.Context, paginationVars KeysetPaginationVars) ([]ACL, string, annotations.Annotations, error) {
+	query, err := NewQuery().Equals("active", "true").Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(TableAPIBaseURL+"/%s", c.deployment, ACLTable),
+		&FilterVars{Fields: ACLFields, Query: query}, &paginationVars,
+		func(a ACL) string { return a.Id })
+}
+
+// GetACLRoles lists the roles active ACLs require, narrowed to the roles a
+// sync lists: grantable ones that pass the role filter.
+func (c *Client) GetACLRoles(ctx context.Context, paginationVars KeysetPaginationVars) ([]ACLRole, string, annotations.Annotations, error) {
+	query, err := NewQuery().
+		Equals("sys_security_acl.active", "true").
+		Equals("sys_user_role.grantable", "true").
+		FilterVia("sys_user_role", c.Filters.Role).
+		Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(TableAPIBaseURL+"/%s", c.deployment, ACLRoleTable),
+		&FilterVars{Fields: []string{"sys_id", "sys_security_acl", "sys_user_role"}, Query: query}, &paginationVars,
+		func(r ACLRole) string { return r.Id })
+}
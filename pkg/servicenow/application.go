@@ -0,0 +1,61 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// Table sys_scope (Applications). sys_app (custom applications) and
+// sys_store_app (Store applications) extend it, so one listing covers both;
+// sys_class_name says which a row is. Roles belong to an application
+// through sys_user_role.sys_scope.
+const (
+	ApplicationsBaseUrl = TableAPIBaseURL + "/sys_scope"
+
+	// GlobalScope is the sys_id of the global scope's sys_scope row, which
+	// isn't an application: roles in it are listed on their own.
+	GlobalScope = "global"
+)
+
+// WithApplications turns on syncing scoped applications, with their roles
+// listed under them rather than at the top level. It's off by default: an
+// account that can't read an application's sys_scope row would lose that
+// application's roles from the sync.
+func WithApplications(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncApplications = enabled
+	}
+}
+
+// ApplicationFields are the sys_scope columns an application is built from.
+var ApplicationFields = []string{"sys_id", "name", "scope", "version", "vendor", "short_description", "active", "sys_class_name", "sys_created_by"}
+
+// applicationQuery is the sys_scope listing condition: every row but the
+// global scope.
+func applicationQuery() *Query {
+	return NewQuery().Where("sys_id", OpNotEquals, GlobalScope)
+}
+
+// GetApplications lists the scoped applications (see applicationQuery).
+func (c *Client) GetApplications(ctx context.Context, paginationVars KeysetPaginationVars) ([]Application, string, annotations.Annotations, error) {
+	query, err := applicationQuery().Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(ApplicationsBaseUrl, c.deployment),
+		&FilterVars{Fields: ApplicationFields, Query: query}, &paginationVars,
+		func(a Application) string { return a.Id })
+}
+
+// GetRolesInScope is GetRoles narrowed to the roles of one application,
+// or to those of no application with GlobalScope.
+func (c *Client) GetRolesInScope(ctx context.Context, scopeID string, paginationVars KeysetPaginationVars) ([]Role, string, annotations.Annotations, error) {
+	query, err := roleQuery(c.Filters.Role).Equals("sys_scope", scopeID).Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(RolesBaseUrl, c.deployment),
+		&FilterVars{Fields: RoleFields, Query: query}, &paginationVars,
+		func(r Role) string { return r.Id })
+}
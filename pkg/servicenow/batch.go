@@ -0,0 +1,345 @@
+package servicenow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/status"
+)
+
+// Batch API: many REST sub-requests in one HTTP call.
+// https://www.servicenow.com/docs/bundle/yokohama-api-reference/page/integrate/inbound-rest/concept/batch-api.html .
+const BatchBaseUrl = BaseURL + "/now/v1/batch"
+
+// maxBatchSize bounds the sub-requests sent per batch call. ServiceNow runs
+// a batch's sub-requests sequentially inside one transaction-time budget, so
+// an unbounded batch would trade a rate-limit problem for a timeout one.
+const maxBatchSize = 100
+
+// Batch collects sub-requests for the Batch API. Sub-requests are built with
+// the same ReqOpts as single calls and run in the order they were added, but
+// independently: one failing doesn't stop the rest, and a later one can't
+// reference an earlier one's result. Each item's outcome is read from its
+// BatchItem once Execute returns.
+type Batch struct {
+	client *Client
+	items  []*BatchItem
+	err    error
+}
+
+// BatchItem is one sub-request of a Batch and, after Execute, its outcome.
+type BatchItem struct {
+	id         string
+	method     string
+	urlAddress string // absolute, for the sequential fallback
+	relURL     string // what the Batch API is sent
+	headers    []batchHeader
+	data       any
+	body       []byte // request body, JSON
+	opts       []ReqOpt
+
+	done       bool
+	statusCode int
+	response   []byte
+	err        error
+}
+
+type batchHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type batchRestRequest struct {
+	ID                     string        `json:"id"`
+	Method                 string        `json:"method"`
+	URL                    string        `json:"url"`
+	Headers                []batchHeader `json:"headers"`
+	Body                   string        `json:"body,omitempty"`
+	ExcludeResponseHeaders bool          `json:"exclude_response_headers"`
+}
+
+type batchRequestPayload struct {
+	BatchRequestID string             `json:"batch_request_id"`
+	RestRequests   []batchRestRequest `json:"rest_requests"`
+}
+
+type batchServicedRequest struct {
+	ID         string        `json:"id"`
+	Body       string        `json:"body"`
+	StatusCode int           `json:"status_code"`
+	StatusText string        `json:"status_text"`
+	Headers    []batchHeader `json:"headers"`
+}
+
+type batchResponse struct {
+	BatchRequestID     string                 `json:"batch_request_id"`
+	ServicedRequests   []batchServicedRequest `json:"serviced_requests"`
+	UnservicedRequests []string               `json:"unserviced_requests"`
+}
+
+// NewBatch starts an empty batch.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c}
+}
+
+// Len is the number of sub-requests added so far.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+func (b *Batch) Get(urlAddress string, opts ...ReqOpt) *BatchItem {
+	return b.Add(http.MethodGet, urlAddress, nil, opts...)
+}
+
+func (b *Batch) Post(urlAddress string, data any, opts ...ReqOpt) *BatchItem {
+	return b.Add(http.MethodPost, urlAddress, data, opts...)
+}
+
+func (b *Batch) Patch(urlAddress string, data any, opts ...ReqOpt) *BatchItem {
+	return b.Add(http.MethodPatch, urlAddress, data, opts...)
+}
+
+func (b *Batch) Delete(urlAddress string, opts ...ReqOpt) *BatchItem {
+	return b.Add(http.MethodDelete, urlAddress, nil, opts...)
+}
+
+// Add queues a sub-request. urlAddress is a full API URL as built by
+// apiURL; the query and headers are prepared exactly as doHTTPRequest would
+// for a single call. A sub-request that can't be built fails Execute.
+func (b *Batch) Add(method string, urlAddress string, data any, opts ...ReqOpt) *BatchItem {
+	item := &BatchItem{
+		id:         strconv.Itoa(len(b.items) + 1),
+		method:     method,
+		urlAddress: urlAddress,
+		data:       data,
+		opts:       opts,
+	}
+	b.items = append(b.items, item)
+
+	if err := item.prepare(); err != nil && b.err == nil {
+		b.err = fmt.Errorf("batch sub-request %s %s: %w", method, urlAddress, err)
+	}
+	return item
+}
+
+func (i *BatchItem) prepare() error {
+	if i.data != nil {
+		body, err := json.Marshal(i.data)
+		if err != nil {
+			return err
+		}
+		i.body = body
+	}
+
+	req, err := http.NewRequest(i.method, i.urlAddress, nil)
+	if err != nil {
+		return err
+	}
+	WithQueryParam("sysparm_exclude_reference_link", "true")(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if i.method == http.MethodPost || i.method == http.MethodPatch {
+		req.Header.Set("X-no-response-body", "true")
+	}
+	for _, o := range i.opts {
+		o(req)
+	}
+	req.URL.RawQuery = req.URL.Query().Encode()
+
+	i.relURL = req.URL.RequestURI()
+	for name, values := range req.Header {
+		for _, value := range values {
+			i.headers = append(i.headers, batchHeader{Name: name, Value: value})
+		}
+	}
+	return nil
+}
+
+// StatusCode is the sub-request's HTTP status, or 0 if it wasn't serviced.
+func (i *BatchItem) StatusCode() int {
+	return i.statusCode
+}
+
+// Err reports why the sub-request failed, if it did. A non-2xx status is a
+// *responseError carrying the gRPC code uhttp would have mapped the status
+// to, so callers see the same codes as for a single call.
+func (i *BatchItem) Err() error {
+	if !i.done {
+		return errors.New("batch sub-request was not executed")
+	}
+	return i.err
+}
+
+// Decode unmarshals the sub-request's JSON response into v.
+func (i *BatchItem) Decode(v any) error {
+	if err := i.Err(); err != nil {
+		return err
+	}
+	if len(i.response) == 0 {
+		return fmt.Errorf("decode %s response: empty body", i.method)
+	}
+	if err := json.Unmarshal(i.response, v); err != nil {
+		return fmt.Errorf("decode %s response: %w", i.method, err)
+	}
+	return nil
+}
+
+func (i *BatchItem) setResult(statusCode int, header http.Header, response []byte) {
+	i.done = true
+	i.statusCode = statusCode
+	i.response = response
+	if statusCode >= 200 && statusCode < 300 {
+		i.err = nil
+		return
+	}
+	i.err = &responseError{
+		statusCode: statusCode,
+		header:     header,
+		err: status.Errorf(uhttp.GrpcCodeFromHTTPStatus(statusCode),
+			"batch sub-request %s %s failed with status %d: %s", i.method, i.relURL, statusCode, string(response)),
+	}
+}
+
+// Execute sends the queued sub-requests, maxBatchSize per call, and records
+// each outcome on its BatchItem. The error covers the batch calls themselves;
+// sub-request failures are only reported through BatchItem.Err, so callers
+// decide which of them matter. Annotations follow doHTTPRequestWithBackoff:
+// every call's, newest first.
+//
+// A batch call is a POST, which is never replayed blindly, but one made only
+// of GETs is retried like a GET.
+//
+// Instances where the Batch API isn't reachable (404/405) get the
+// sub-requests one by one instead, so callers need no second code path.
+func (b *Batch) Execute(ctx context.Context) (annotations.Annotations, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	var annos annotations.Annotations
+	for start := 0; start < len(b.items); start += maxBatchSize {
+		chunk := b.items[start:min(start+maxBatchSize, len(b.items))]
+
+		chunkAnnos, err := b.client.executeBatchChunk(ctx, strconv.Itoa(start/maxBatchSize+1), chunk)
+		annos = append(chunkAnnos, annos...)
+		var respErr *responseError
+		if errors.As(err, &respErr) && (respErr.statusCode == http.StatusNotFound || respErr.statusCode == http.StatusMethodNotAllowed) {
+			ctxzap.Extract(ctx).Debug("baton-servicenow: batch API unavailable, sending sub-requests individually",
+				zap.Int("status_code", respErr.statusCode),
+			)
+			seqAnnos := b.client.executeSequentially(ctx, b.items[start:])
+			return append(seqAnnos, annos...), nil
+		}
+		if err != nil {
+			return annos, fmt.Errorf("batch request failed: %w", err)
+		}
+	}
+
+	return annos, nil
+}
+
+func (c *Client) executeBatchChunk(ctx context.Context, batchID string, items []*BatchItem) (annotations.Annotations, error) {
+	payload := batchRequestPayload{
+		BatchRequestID: batchID,
+		RestRequests:   make([]batchRestRequest, 0, len(items)),
+	}
+	byID := make(map[string]*BatchItem, len(items))
+	for _, item := range items {
+		restRequest := batchRestRequest{
+			ID:      item.id,
+			Method:  item.method,
+			URL:     item.relURL,
+			Headers: item.headers,
+		}
+		if item.body != nil {
+			restRequest.Body = base64.StdEncoding.EncodeToString(item.body)
+		}
+		payload.RestRequests = append(payload.RestRequests, restRequest)
+		byID[item.id] = item
+	}
+
+	var response batchResponse
+	batchURL := c.apiURL(BatchBaseUrl, c.deployment)
+	_, annos, err := withAuthRetry(ctx, batchURL, http.MethodPost, func() (string, annotations.Annotations, error) {
+		_, a, reqErr := c.replayHTTPRequest(ctx, idempotentBatch(items), batchURL, http.MethodPost,
+			&payload, &response, WithIncludeResponseBody())
+		return "", a, reqErr
+	})
+	if err != nil {
+		return annos, err
+	}
+
+	for _, serviced := range response.ServicedRequests {
+		item, ok := byID[serviced.ID]
+		if !ok {
+			continue
+		}
+		body, err := base64.StdEncoding.DecodeString(serviced.Body)
+		if err != nil {
+			item.done = true
+			item.err = fmt.Errorf("batch sub-request %s %s: undecodable body: %w", item.method, item.relURL, err)
+			continue
+		}
+		header := make(http.Header, len(serviced.Headers))
+		for _, h := range serviced.Headers {
+			header.Add(h.Name, h.Value)
+		}
+		item.setResult(serviced.StatusCode, header, body)
+	}
+
+	// Unserviced sub-requests -- the batch ran out of time, typically -- and
+	// any the response didn't mention at all weren't run.
+	for _, item := range items {
+		if !item.done {
+			item.done = true
+			item.err = fmt.Errorf("batch sub-request %s %s was not serviced", item.method, item.relURL)
+		}
+	}
+
+	return annos, nil
+}
+
+// idempotentBatch reports whether a batch call can be replayed like its
+// sub-requests could be one by one: the call is a POST, but one made only of
+// GETs and DELETEs (see isIdempotentMethod) is safe to send again.
+func idempotentBatch(items []*BatchItem) bool {
+	for _, item := range items {
+		if !isIdempotentMethod(item.method) {
+			return false
+		}
+	}
+	return true
+}
+
+// executeSequentially is the fallback for instances without the Batch API.
+func (c *Client) executeSequentially(ctx context.Context, items []*BatchItem) annotations.Annotations {
+	var annos annotations.Annotations
+	for _, item := range items {
+		var raw json.RawMessage
+		_, itemAnnos, err := c.doRequestWithRetry(ctx, item.urlAddress, item.method, item.data, &raw, item.opts...)
+		annos = append(itemAnnos, annos...)
+
+		var respErr *responseError
+		switch {
+		case err == nil:
+			item.setResult(http.StatusOK, nil, raw)
+		case errors.As(err, &respErr) && respErr.statusCode != 0:
+			item.done = true
+			item.statusCode = respErr.statusCode
+			item.err = err
+		default:
+			item.done = true
+			item.err = err
+		}
+	}
+	return annos
+}
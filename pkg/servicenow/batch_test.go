@@ -0,0 +1,262 @@
+package servicenow
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// batchServer fronts a Table API handler with a fake /api/now/v1/batch that
+// runs each sub-request against it, the way ServiceNow does.
+type batchServer struct {
+	t     *testing.T
+	table http.Handler
+
+	mu         sync.Mutex
+	batchCalls int
+}
+
+func (b *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The test client's base URL override stands in for .../api.
+	if r.URL.Path != "/now/v1/batch" {
+		b.table.ServeHTTP(w, r)
+		return
+	}
+
+	var payload batchRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		b.t.Errorf("failed to decode batch payload: %v", err)
+	}
+
+	b.mu.Lock()
+	b.batchCalls++
+	b.mu.Unlock()
+
+	response := batchResponse{BatchRequestID: payload.BatchRequestID}
+	for _, sub := range payload.RestRequests {
+		if !strings.HasPrefix(sub.URL, "/now/") {
+			b.t.Errorf("sub-request URL %q should be relative to the instance", sub.URL)
+		}
+		body, err := base64.StdEncoding.DecodeString(sub.Body)
+		if err != nil {
+			b.t.Errorf("sub-request body is not base64: %v", err)
+		}
+		req := httptest.NewRequest(sub.Method, sub.URL, bytes.NewReader(body))
+		for _, h := range sub.Headers {
+			req.Header.Add(h.Name, h.Value)
+		}
+
+		rec := httptest.NewRecorder()
+		b.table.ServeHTTP(rec, req)
+		response.ServicedRequests = append(response.ServicedRequests, batchServicedRequest{
+			ID:         sub.ID,
+			Body:       base64.StdEncoding.EncodeToString(rec.Body.Bytes()),
+			StatusCode: rec.Code,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func newBatchTestClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+	return client
+}
+
+func TestBatchDecodesEachSubRequest(t *testing.T) {
+	table := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("sysparm_query") == "name=admin":
+			_ = json.NewEncoder(w).Encode(ListResponse[Role]{Result: []Role{{BaseResource: BaseResource{Id: "r1"}, Name: "admin"}}})
+		case r.Method == http.MethodPost:
+			if r.Header.Get("X-no-response-body") != "false" {
+				t.Errorf("WithIncludeResponseBody should have dropped X-no-response-body")
+			}
+			var group GroupPayload
+			_ = json.NewDecoder(r.Body).Decode(&group)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(SingleResponse[Group]{Result: Group{BaseResource: BaseResource{Id: "g1"}, Name: group.Name}})
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"No Record found"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	fake := &batchServer{t: t, table: table}
+	client := newBatchTestClient(t, fake)
+
+	batch := client.NewBatch()
+	get := batch.Get(client.apiURL(RolesBaseUrl, client.deployment), WithQuery("name=admin"))
+	post := batch.Post(client.apiURL(GroupsBaseUrl, client.deployment), &GroupPayload{Name: "Apollo"}, WithIncludeResponseBody())
+	del := batch.Delete(client.apiURL(GroupBaseUrl, client.deployment, "gone"))
+
+	if _, err := batch.Execute(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.batchCalls != 1 {
+		t.Errorf("batch endpoint called %d times, want 1", fake.batchCalls)
+	}
+
+	var roles ListResponse[Role]
+	if err := get.Decode(&roles); err != nil || len(roles.Result) != 1 || roles.Result[0].Id != "r1" {
+		t.Errorf("GET sub-request: roles=%+v err=%v", roles.Result, err)
+	}
+	var group GroupResponse
+	if err := post.Decode(&group); err != nil || group.Result.Name != "Apollo" {
+		t.Errorf("POST sub-request: group=%+v err=%v", group.Result, err)
+	}
+	if del.StatusCode() != http.StatusNotFound {
+		t.Errorf("DELETE sub-request status = %d, want 404", del.StatusCode())
+	}
+	if code := status.Code(del.Err()); code != codes.NotFound {
+		t.Errorf("DELETE sub-request code = %v, want NotFound", code)
+	}
+}
+
+func TestBatchFallsBackWhenTheBatchAPIIsMissing(t *testing.T) {
+	var deletes []string
+	client := newBatchTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/now/v1/batch" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		deletes = append(deletes, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	if _, err := client.RemoveGroupMembers(context.Background(), []string{"m1", "m2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "/now/table/sys_user_grmember/m1 /now/table/sys_user_grmember/m2"
+	if got := strings.Join(deletes, " "); got != want {
+		t.Errorf("individual deletes = %q, want %q", got, want)
+	}
+}
+
+// A batch call is a POST, so it's only replayed after a 503 when every
+// sub-request in it could be: a GET or a DELETE. One that creates or
+// updates could have been applied.
+func TestBatchRetriesOnlyIdempotentChunks(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		add       func(b *Batch, c *Client)
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name: "reads",
+			add: func(b *Batch, c *Client) {
+				b.Get(c.apiURL(RolesBaseUrl, c.deployment), WithQuery("name=admin"))
+				b.Get(c.apiURL(RolesBaseUrl, c.deployment), WithQuery("name=itil"))
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "a read and a delete",
+			add: func(b *Batch, c *Client) {
+				b.Get(c.apiURL(RolesBaseUrl, c.deployment), WithQuery("name=admin"))
+				b.Delete(c.apiURL(GroupBaseUrl, c.deployment, "g1"))
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "a delete and a create",
+			add: func(b *Batch, c *Client) {
+				b.Delete(c.apiURL(GroupBaseUrl, c.deployment, "g1"))
+				b.Post(c.apiURL(GroupsBaseUrl, c.deployment), &GroupPayload{Name: "Apollo"})
+			},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &batchServer{t: t, table: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(ListResponse[Role]{})
+			})}
+			calls := 0
+			client := newBatchTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls++; calls == 1 {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				fake.ServeHTTP(w, r)
+			}))
+
+			batch := client.NewBatch()
+			tc.add(batch, client)
+			_, err := batch.Execute(context.Background())
+			if tc.wantErr != (err != nil) {
+				t.Errorf("Execute error = %v, want error: %v", err, tc.wantErr)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("batch endpoint called %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// Two labels, one already defined: one lookup batch, one create batch and
+// one attach batch, instead of two or three calls per label.
+func TestAddLabelsToRequestUsesThreeBatches(t *testing.T) {
+	var entries []LabelEntryPayload
+	table := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/label"):
+			var result []Label
+			if r.URL.Query().Get("sysparm_query") == "name=existing" {
+				result = []Label{{Id: "label-existing", Name: "existing"}}
+			}
+			_ = json.NewEncoder(w).Encode(ListResponse[Label]{Result: result})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/label"):
+			var label Label
+			_ = json.NewDecoder(r.Body).Decode(&label)
+			label.Id = "label-" + label.Name
+			_ = json.NewEncoder(w).Encode(SingleResponse[Label]{Result: label})
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/label_entry"):
+			var entry LabelEntryPayload
+			_ = json.NewDecoder(r.Body).Decode(&entry)
+			entries = append(entries, entry)
+			_ = json.NewEncoder(w).Encode(SingleResponse[BaseResource]{Result: BaseResource{Id: "entry"}})
+		default:
+			t.Errorf("unexpected sub-request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	fake := &batchServer{t: t, table: table}
+	client := newBatchTestClient(t, fake)
+
+	if _, err := client.AddLabelsToRequest(context.Background(), "ritm-1", []string{"existing", "new", "existing"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fake.batchCalls != 3 {
+		t.Errorf("batch endpoint called %d times, want 3", fake.batchCalls)
+	}
+	if len(entries) != 2 || entries[0].Label != "label-existing" || entries[1].Label != "label-new" {
+		t.Errorf("label entries = %+v, want label-existing then label-new", entries)
+	}
+}
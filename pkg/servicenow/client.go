@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
@@ -41,8 +45,12 @@ const (
 	GroupRolesBaseUrl      = TableAPIBaseURL + "/sys_group_has_role"
 	GroupRoleDetailBaseUrl = GroupRolesBaseUrl + "/%s"
 
+	// Deprecated: nothing calls this endpoint. GetEffectiveRoles reads
+	// sys_user_has_role instead; see its doc comment for why.
 	UserRoleInheritanceBaseUrl = GlobalApiBaseURL + "/user_role_inheritance"
 
+	DictionaryBaseUrl = TableAPIBaseURL + "/sys_dictionary"
+
 	// Service Catalogs.
 	ServiceCatalogRequestedItemBaseUrl        = TableAPIBaseURL + "/sc_req_item"
 	ServiceCatalogRequestedItemDetailsBaseUrl = ServiceCatalogRequestedItemBaseUrl + "/%s"
@@ -104,16 +112,60 @@ type VariableSetM2MResponse = ListResponse[VariableSetM2M]
 type VariableSetsResponse = ListResponse[VariableSet]
 type ItemOptionNewResponse = ListResponse[ItemOptionNew]
 type QuestionChoiceResponse = ListResponse[QuestionChoice]
+type DictionaryEntriesResponse = ListResponse[DictionaryEntry]
 
 type Client struct {
-	httpClient          *uhttp.BaseHttpClient
-	auth                string
-	deployment          string
-	baseURL             string
-	baseURLOverride     bool
-	TicketSchemaFilters map[string]string
-	AllowedDomains      []string
-	CustomUserFields    []string
+	httpClient              *uhttp.BaseHttpClient
+	auth                    string
+	deployment              string
+	baseURL                 string
+	baseURLOverride         bool
+	TicketSchemaFilters     map[string]string
+	AllowedDomains          []string
+	CustomUserFields        []string
+	Filters                 QueryFilters
+	SysDomain               string
+	SyncSubscriptions       bool
+	SyncApplications        bool
+	SyncCMDB                bool
+	DelegationDuration      time.Duration
+	GrantExpiryTable        string
+	GrantDurations          map[string]time.Duration
+	ProvisionableGroupTypes []string
+	SyncEffectiveRoles      bool
+	SyncUserCriteria        bool
+	SyncHRSD                bool
+	SyncACLs                bool
+	retryPolicy             RetryPolicy
+
+	maxConcurrentRequests int
+	limiter               *requestLimiter
+
+	domainMu    sync.Mutex
+	domainScope []string
+
+	hrsdMu        sync.Mutex
+	hrsdInstalled *bool
+}
+
+// ClientOption configures optional Client behaviour at construction time.
+type ClientOption func(c *Client)
+
+// WithQueryFilters ANDs operator-supplied encoded queries into the user,
+// group and role listings. NewClient rejects filters outside the grammar
+// parseFilterQuery accepts.
+func WithQueryFilters(filters QueryFilters) ClientOption {
+	return func(c *Client) {
+		c.Filters = filters
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for 429/5xx and transport
+// failures. MaxRetries 0 disables the retries.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
 }
 
 // Official documentation.
@@ -129,6 +181,7 @@ func NewClient(
 	allowedDomains []string,
 	customUserFields []string,
 	baseURLOverride string,
+	opts ...ClientOption,
 ) (*Client, error) {
 	var baseURL string
 	if baseURLOverride != "" {
@@ -158,7 +211,7 @@ func NewClient(
 			return nil, fmt.Errorf("invalid deployment %q: produced unusable instance host %q", deployment, baseURL)
 		}
 	}
-	return &Client{
+	c := &Client{
 		httpClient:          httpClient,
 		auth:                auth,
 		deployment:          deployment,
@@ -167,7 +220,46 @@ func NewClient(
 		TicketSchemaFilters: ticketSchemaFilters,
 		AllowedDomains:      allowedDomains,
 		CustomUserFields:    customUserFields,
-	}, nil
+		DelegationDuration:  DefaultDelegationDuration,
+		retryPolicy:         DefaultRetryPolicy,
+
+		ProvisionableGroupTypes: []string{AnyGroupType},
+
+		maxConcurrentRequests: DefaultMaxConcurrentRequests,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Filters are spliced into sysparm_query on every listing, so a bad one
+	// fails here rather than as a confusing 400 (or a silently widened
+	// listing) mid-sync.
+	if err := c.Filters.Validate(); err != nil {
+		return nil, err
+	}
+	if err := c.retryPolicy.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkQueryValue(c.SysDomain, ","); err != nil {
+		return nil, fmt.Errorf("invalid sys domain: %w", err)
+	}
+	if c.DelegationDuration <= 0 {
+		return nil, fmt.Errorf("invalid delegation duration %s: must be positive", c.DelegationDuration)
+	}
+	if err := c.validateGrantExpiry(); err != nil {
+		return nil, err
+	}
+	maxPause := c.retryPolicy.MaxDelay
+	if maxPause <= 0 {
+		maxPause = DefaultRetryPolicy.MaxDelay
+	}
+	limiter, err := newRequestLimiter(c.maxConcurrentRequests, maxPause)
+	if err != nil {
+		return nil, err
+	}
+	c.limiter = limiter
+
+	return c, nil
 }
 
 func (c *Client) GetBaseURL() string {
@@ -201,8 +293,13 @@ func getKeysetPage[T any](
 		return nil, "", nil, fmt.Errorf("keyset pagination called with Limit %d for %s", keysetVars.Limit, url)
 	}
 
+	reqOpts, err := buildKeysetReqOptions(filterVars, keysetVars)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("%s: %w", url, err)
+	}
+
 	var resp ListResponse[T]
-	header, annos, err := c.getKeyset(ctx, url, &resp, buildKeysetReqOptions(filterVars, keysetVars)...)
+	header, annos, err := c.getKeyset(ctx, url, &resp, reqOpts...)
 	if err != nil {
 		return nil, "", annos, err
 	}
@@ -311,12 +408,23 @@ func readTotalCount(header http.Header) (int, bool) {
 // cap (domainFilteredPageSize) always apply when AllowedDomains is
 // configured.
 func (c *Client) GetUsers(ctx context.Context, paginationVars KeysetPaginationVars) ([]User, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
 	paginationVars = cappedForDomainFilter("", c.AllowedDomains, paginationVars)
-	return getKeysetPage(ctx, c, c.apiURL(UsersBaseUrl, c.deployment),
-		prepareUserFilters(c.AllowedDomains, c.CustomUserFields), &paginationVars,
+	filter, err := prepareUserFilters(c.AllowedDomains, sysDomains, c.CustomUserFields, c.Filters.User)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	users, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(UsersBaseUrl, c.deployment),
+		filter, &paginationVars,
 		func(u User) string { return u.Id })
+	return users, next, append(pageAnnos, annos...), err
 }
 
+// GetUser reads one sys_user. A user outside the configured domain reads
+// as NotFound, the same as one the sync account can't see.
 func (c *Client) GetUser(ctx context.Context, userId string) (*User, annotations.Annotations, error) {
 	var userResponse UserResponse
 
@@ -331,16 +439,34 @@ func (c *Client) GetUser(ctx context.Context, userId string) (*User, annotations
 		return nil, annos, err
 	}
 
+	scopeAnnos, err := c.checkReadInSysDomain(ctx, userId, userResponse.Result.SysDomain)
+	annos = append(scopeAnnos, annos...)
+	if err != nil {
+		return nil, annos, err
+	}
+
 	return &userResponse.Result, annos, nil
 }
 
-// Table sys_user_group (Groups).
+// Table sys_user_group (Groups). Scoped by the configured domain and group
+// filter.
 func (c *Client) GetGroups(ctx context.Context, paginationVars KeysetPaginationVars, groupIDs []string) ([]Group, string, annotations.Annotations, error) {
-	return getKeysetPage(ctx, c, c.apiURL(GroupsBaseUrl, c.deployment),
-		prepareGroupFilters(groupIDs), &paginationVars,
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	filter, err := prepareGroupFilters(groupIDs, sysDomains, c.Filters.Group)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	groups, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(GroupsBaseUrl, c.deployment),
+		filter, &paginationVars,
 		func(g Group) string { return g.Id })
+	return groups, next, append(pageAnnos, annos...), err
 }
 
+// GetGroup reads one sys_user_group, NotFound outside the configured domain
+// (see GetUser).
 func (c *Client) GetGroup(ctx context.Context, groupId string) (*Group, annotations.Annotations, error) {
 	var groupResponse GroupResponse
 
@@ -355,27 +481,88 @@ func (c *Client) GetGroup(ctx context.Context, groupId string) (*Group, annotati
 		return nil, annos, err
 	}
 
+	scopeAnnos, err := c.checkReadInSysDomain(ctx, groupId, groupResponse.Result.SysDomain)
+	annos = append(scopeAnnos, annos...)
+	if err != nil {
+		return nil, annos, err
+	}
+
 	return &groupResponse.Result, annos, nil
 }
 
 // Table sys_user_grmember (Group Members). When userId is empty
-// (enumeration), results are scoped to allowed-domains via user.email and
-// the page size is capped (see domainFilteredPageSize).
+// (enumeration), results are scoped to allowed-domains via user.email, to
+// the configured domain via user.sys_domain and to the user filter via
+// user, and the page size is capped (see domainFilteredPageSize).
 func (c *Client) GetUserToGroup(ctx context.Context, userId string, groupId string, paginationVars KeysetPaginationVars) ([]GroupMember, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
 	paginationVars = cappedForDomainFilter(userId, c.AllowedDomains, paginationVars)
-	return getKeysetPage(ctx, c, c.apiURL(GroupMembersBaseUrl, c.deployment),
-		prepareUserToGroupFilter(userId, groupId, c.AllowedDomains), &paginationVars,
+	filter, err := prepareUserToGroupFilter(userId, groupId, c.AllowedDomains, sysDomains, c.Filters.User)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	members, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(GroupMembersBaseUrl, c.deployment),
+		filter, &paginationVars,
 		func(m GroupMember) string { return m.Id })
+	return members, next, append(pageAnnos, annos...), err
 }
 
-func (c *Client) AddUserToGroup(ctx context.Context, record GroupMemberPayload) (annotations.Annotations, error) {
-	return c.post(
+func (c *Client) CreateGroup(ctx context.Context, group GroupPayload) (*Group, annotations.Annotations, error) {
+	var response GroupResponse
+
+	annos, err := c.post(
 		ctx,
-		c.apiURL(GroupMembersBaseUrl, c.deployment),
-		nil,
-		&record,
+		c.apiURL(GroupsBaseUrl, c.deployment),
+		&response,
+		&group,
 		WithIncludeResponseBody(),
+		WithFields(GroupFields...),
 	)
+	if err != nil {
+		return nil, annos, fmt.Errorf("failed to create group in ServiceNow: %w", err)
+	}
+
+	return &response.Result, annos, nil
+}
+
+func (c *Client) DeleteGroup(ctx context.Context, groupId string) (annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, GroupBaseUrl, groupId); err != nil {
+		return annos, err
+	}
+	return c.delete(
+		ctx,
+		c.apiURL(GroupBaseUrl, c.deployment, groupId),
+		nil,
+	)
+}
+
+// GetGroupMembers lists every sys_user_grmember row of a group, ignoring the
+// allowed-domains and user filters (see prepareGroupMembersFilter).
+func (c *Client) GetGroupMembers(ctx context.Context, groupId string, paginationVars KeysetPaginationVars) ([]GroupMember, string, annotations.Annotations, error) {
+	filter, err := prepareGroupMembersFilter(groupId)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(GroupMembersBaseUrl, c.deployment),
+		filter, &paginationVars,
+		func(m GroupMember) string { return m.Id })
+}
+
+func (c *Client) AddUserToGroup(ctx context.Context, record GroupMemberPayload) (annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, record.User); err != nil {
+		return annos, err
+	}
+	if annos, err := c.requireInSysDomain(ctx, GroupBaseUrl, record.Group); err != nil {
+		return annos, err
+	}
+	return c.createMembership(ctx, c.apiURL(GroupMembersBaseUrl, c.deployment), &record,
+		func(ctx context.Context) (bool, annotations.Annotations, error) {
+			rows, _, annos, err := c.GetUserToGroup(ctx, record.User, record.Group, KeysetPaginationVars{Limit: 1})
+			return len(rows) > 0, annos, err
+		})
 }
 
 func (c *Client) RemoveUserFromGroup(ctx context.Context, id string) (annotations.Annotations, error) {
@@ -386,31 +573,51 @@ func (c *Client) RemoveUserFromGroup(ctx context.Context, id string) (annotation
 	)
 }
 
-// Table sys_user_role (Roles).
+// RemoveGroupMembers deletes sys_user_grmember rows through the Batch API.
+func (c *Client) RemoveGroupMembers(ctx context.Context, ids []string) (annotations.Annotations, error) {
+	return c.deleteRecords(ctx, GroupMemberDetailBaseUrl, ids)
+}
+
+// Table sys_user_role (Roles). Scoped by the configured role filter.
 func (c *Client) GetRoles(ctx context.Context, paginationVars KeysetPaginationVars) ([]Role, string, annotations.Annotations, error) {
+	filter, err := prepareRoleFilters(c.Filters.Role)
+	if err != nil {
+		return nil, "", nil, err
+	}
 	return getKeysetPage(ctx, c, c.apiURL(RolesBaseUrl, c.deployment),
-		prepareRoleFilters(), &paginationVars,
+		filter, &paginationVars,
 		func(r Role) string { return r.Id })
 }
 
 // Table sys_user_has_role (User to Role). When userId is empty
-// (enumeration), results are scoped to allowed-domains via user.email and
-// the page size is capped (see domainFilteredPageSize).
+// (enumeration), results are scoped to allowed-domains via user.email, to
+// the configured domain via user.sys_domain and to the user filter via
+// user, and the page size is capped (see domainFilteredPageSize).
 func (c *Client) GetUserToRole(ctx context.Context, userId string, roleId string, paginationVars KeysetPaginationVars) ([]UserToRole, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
 	paginationVars = cappedForDomainFilter(userId, c.AllowedDomains, paginationVars)
-	return getKeysetPage(ctx, c, c.apiURL(UserRolesBaseUrl, c.deployment),
-		prepareUserToRoleFilter(userId, roleId, c.AllowedDomains), &paginationVars,
+	filter, err := prepareUserToRoleFilter(userId, roleId, c.AllowedDomains, sysDomains, c.Filters.User)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(UserRolesBaseUrl, c.deployment),
+		filter, &paginationVars,
 		func(r UserToRole) string { return r.Id })
+	return rows, next, append(pageAnnos, annos...), err
 }
 
 func (c *Client) GrantRoleToUser(ctx context.Context, record UserToRolePayload) (annotations.Annotations, error) {
-	return c.post(
-		ctx,
-		c.apiURL(UserRolesBaseUrl, c.deployment),
-		nil,
-		&record,
-		WithIncludeResponseBody(),
-	)
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, record.User); err != nil {
+		return annos, err
+	}
+	return c.createMembership(ctx, c.apiURL(UserRolesBaseUrl, c.deployment), &record,
+		func(ctx context.Context) (bool, annotations.Annotations, error) {
+			rows, _, annos, err := c.GetUserToRole(ctx, record.User, record.Role, KeysetPaginationVars{Limit: 1})
+			return len(rows) > 0, annos, err
+		})
 }
 
 func (c *Client) RevokeRoleFromUser(ctx context.Context, id string) (annotations.Annotations, error) {
@@ -421,22 +628,38 @@ func (c *Client) RevokeRoleFromUser(ctx context.Context, id string) (annotations
 	)
 }
 
-// Table sys_group_has_role (Group to Role). No domain filter -- groups
-// don't have an email to scope by.
+// RevokeUserRoles deletes sys_user_has_role rows through the Batch API.
+func (c *Client) RevokeUserRoles(ctx context.Context, ids []string) (annotations.Annotations, error) {
+	return c.deleteRecords(ctx, UserRoleDetailBaseUrl, ids)
+}
+
+// Table sys_group_has_role (Group to Role). No allowed-domains filter --
+// groups don't have an email to scope by -- but when groupId is empty
+// (enumeration), the configured domain and group filter apply via group.
 func (c *Client) GetGroupToRole(ctx context.Context, groupId string, roleId string, paginationVars KeysetPaginationVars) ([]GroupToRole, string, annotations.Annotations, error) {
-	return getKeysetPage(ctx, c, c.apiURL(GroupRolesBaseUrl, c.deployment),
-		prepareGroupToRoleFilter(groupId, roleId), &paginationVars,
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	filter, err := prepareGroupToRoleFilter(groupId, roleId, sysDomains, c.Filters.Group)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(GroupRolesBaseUrl, c.deployment),
+		filter, &paginationVars,
 		func(r GroupToRole) string { return r.Id })
+	return rows, next, append(pageAnnos, annos...), err
 }
 
 func (c *Client) GrantRoleToGroup(ctx context.Context, record GroupToRolePayload) (annotations.Annotations, error) {
-	return c.post(
-		ctx,
-		c.apiURL(GroupRolesBaseUrl, c.deployment),
-		nil,
-		&record,
-		WithIncludeResponseBody(),
-	)
+	if annos, err := c.requireInSysDomain(ctx, GroupBaseUrl, record.Group); err != nil {
+		return annos, err
+	}
+	return c.createMembership(ctx, c.apiURL(GroupRolesBaseUrl, c.deployment), &record,
+		func(ctx context.Context) (bool, annotations.Annotations, error) {
+			rows, _, annos, err := c.GetGroupToRole(ctx, record.Group, record.Role, KeysetPaginationVars{Limit: 1})
+			return len(rows) > 0, annos, err
+		})
 }
 
 func (c *Client) RevokeRoleFromGroup(ctx context.Context, id string) (annotations.Annotations, error) {
@@ -447,6 +670,40 @@ func (c *Client) RevokeRoleFromGroup(ctx context.Context, id string) (annotation
 	)
 }
 
+// RevokeGroupRoles deletes sys_group_has_role rows through the Batch API.
+func (c *Client) RevokeGroupRoles(ctx context.Context, ids []string) (annotations.Annotations, error) {
+	return c.deleteRecords(ctx, GroupRoleDetailBaseUrl, ids)
+}
+
+// deleteRecords deletes the records with the given sys_ids, pattern being a
+// detail URL like GroupMemberDetailBaseUrl, in as few calls as the Batch API
+// allows. A record that is already gone (404) counts as deleted; any other
+// failure is returned, joined, after every delete has been attempted.
+func (c *Client) deleteRecords(ctx context.Context, pattern string, ids []string) (annotations.Annotations, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	batch := c.NewBatch()
+	items := make([]*BatchItem, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, batch.Delete(c.apiURL(pattern, c.deployment, id)))
+	}
+
+	annos, err := batch.Execute(ctx)
+	if err != nil {
+		return annos, err
+	}
+
+	var errs []error
+	for _, item := range items {
+		if err := item.Err(); err != nil && item.StatusCode() != http.StatusNotFound {
+			errs = append(errs, err)
+		}
+	}
+	return annos, errors.Join(errs...)
+}
+
 func (c *Client) get(ctx context.Context, urlAddress string, resourceResponse interface{}, reqOptions ...ReqOpt) (string, annotations.Annotations, error) {
 	return c.doRequestWithRetry(
 		ctx,
@@ -533,7 +790,7 @@ func (c *Client) delete(
 // offset-pagination token used by Service Catalog/ticketing callers. Keyset
 // callers use doRequestWithRetryKeyset instead.
 func (c *Client) doRequest(ctx context.Context, urlAddress string, method string, data any, resourceResponse any, reqOptions ...ReqOpt) (string, annotations.Annotations, error) {
-	header, annos, err := c.doHTTPRequest(ctx, urlAddress, method, data, resourceResponse, reqOptions...)
+	header, annos, err := c.doHTTPRequestWithBackoff(ctx, urlAddress, method, data, resourceResponse, reqOptions...)
 	if err != nil {
 		return "", annos, err
 	}
@@ -590,9 +847,18 @@ func (c *Client) doHTTPRequest(ctx context.Context, urlAddress string, method st
 	// Rate-limit data is captured for every response, success or failure.
 	// The success path is the one that matters: it lets the SDK's limiter
 	// pace upcoming requests and avoid the next 429, rather than only
-	// reacting once one has already been returned.
+	// reacting once one has already been returned. c.limiter reads it as
+	// well, holding back this instance's other in-flight callers.
 	var rlData v2.RateLimitDescription
+	if err := c.limiter.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
 	rawResponse, err := c.httpClient.Do(req, uhttp.WithRatelimitData(&rlData))
+	var header http.Header
+	if rawResponse != nil {
+		header = rawResponse.Header
+	}
+	c.limiter.release(&rlData, header)
 	if rawResponse != nil {
 		// uhttp has already drained and closed the network body, swapping in
 		// an in-memory buffer, so this close is a no-op today. Kept nil-guarded
@@ -607,14 +873,18 @@ func (c *Client) doHTTPRequest(ctx context.Context, urlAddress string, method st
 		switch {
 		case rawResponse == nil:
 			// Transport-level failure -- no response to salvage.
-			return nil, annos, err
+			return nil, annos, &responseError{err: err}
 
 		case rawResponse.StatusCode >= 300:
 			// Best-effort read: the body only enriches the message, so a
 			// read failure must not mask the status the caller needs. uhttp
 			// has already replaced Body with a re-readable buffer.
 			respBody, _ := io.ReadAll(rawResponse.Body)
-			return nil, annos, fmt.Errorf("request failed with status %d: %s: %w", rawResponse.StatusCode, string(respBody), err)
+			return nil, annos, &responseError{
+				statusCode: rawResponse.StatusCode,
+				header:     rawResponse.Header,
+				err:        fmt.Errorf("request failed with status %d: %s: %w", rawResponse.StatusCode, string(respBody), err),
+			}
 
 		default:
 			// A 2xx with a non-nil error means a DoOption failed, not the
@@ -704,7 +974,7 @@ func (c *Client) doRequestWithRetry(ctx context.Context, urlAddress string, meth
 func (c *Client) doRequestWithRetryKeyset(ctx context.Context, urlAddress string, method string, data any, resourceResponse any, reqOptions ...ReqOpt) (http.Header, annotations.Annotations, error) {
 	var header http.Header
 	_, annos, err := withAuthRetry(ctx, urlAddress, method, func() (string, annotations.Annotations, error) {
-		h, a, reqErr := c.doHTTPRequest(ctx, urlAddress, method, data, resourceResponse, reqOptions...)
+		h, a, reqErr := c.doHTTPRequestWithBackoff(ctx, urlAddress, method, data, resourceResponse, reqOptions...)
 		header = h
 		return "", a, reqErr
 	})
@@ -775,6 +1045,256 @@ func withAuthRetry(ctx context.Context, urlAddress string, method string, attemp
 	return "", lastAnnos, lastErr
 }
 
+// RetryPolicy governs replays of idempotent requests that fail with a 429, a
+// 5xx or a transport error. Delays grow exponentially from BaseDelay with
+// jitter unless the response says when to come back (Retry-After or
+// X-RateLimit-Reset); either way no single wait exceeds MaxDelay.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// Validate rejects policies that would retry without ever waiting.
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxRetries < 0:
+		return fmt.Errorf("invalid retry policy: max retries %d is negative", p.MaxRetries)
+	case p.MaxRetries > 0 && (p.BaseDelay <= 0 || p.MaxDelay <= 0):
+		return fmt.Errorf("invalid retry policy: retries need a positive base and max delay")
+	}
+	return nil
+}
+
+// responseError is a non-2xx response, keeping the status and headers the
+// retry policy needs, or a transport failure (statusCode 0, no headers). It
+// wraps the uhttp error, so status.Code still sees the gRPC code uhttp
+// mapped the status to. Errors that aren't one -- a body that won't decode,
+// say -- are never retried.
+type responseError struct {
+	statusCode int
+	header     http.Header
+	err        error
+}
+
+func (e *responseError) Error() string { return e.err.Error() }
+
+func (e *responseError) Unwrap() error { return e.err }
+
+// isIdempotentMethod reports whether a request can be replayed without
+// risking a second write. POST and PATCH are excluded: a 5xx or a dropped
+// connection doesn't say whether ServiceNow already applied them.
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryableStatus covers transport failures (0), rate limiting and the 5xx
+// a node failover or an overloaded instance produces. 501 and 505 won't
+// change on a replay.
+func isRetryableStatus(statusCode int) bool {
+	switch {
+	case statusCode == 0, statusCode == http.StatusTooManyRequests:
+		return true
+	case statusCode == http.StatusNotImplemented, statusCode == http.StatusHTTPVersionNotSupported:
+		return false
+	default:
+		return statusCode >= http.StatusInternalServerError
+	}
+}
+
+// serverRetryDelay reads how long the response asked us to wait: Retry-After
+// (delta-seconds or an HTTP date) first, then X-RateLimit-Reset, which
+// ServiceNow sends as Unix epoch seconds.
+func serverRetryDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if raw := strings.TrimSpace(header.Get("Retry-After")); raw != "" {
+		if seconds, err := strconv.Atoi(raw); err == nil {
+			return max(time.Duration(seconds)*time.Second, 0), true
+		}
+		if at, err := http.ParseTime(raw); err == nil {
+			return max(at.Sub(now), 0), true
+		}
+	}
+	if raw := strings.TrimSpace(header.Get("X-RateLimit-Reset")); raw != "" {
+		if epoch, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return max(time.Unix(epoch, 0).Sub(now), 0), true
+		}
+	}
+	return 0, false
+}
+
+// backoff returns the wait before replay number retry (1-based): the
+// server's hint when there is one, otherwise BaseDelay doubled per retry
+// with equal jitter, so concurrent syncs hitting the same limit spread out.
+func (p RetryPolicy) backoff(retry int, header http.Header, now time.Time) time.Duration {
+	if delay, ok := serverRetryDelay(header, now); ok {
+		return min(delay, p.MaxDelay)
+	}
+	delay := p.BaseDelay << min(retry-1, 30)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half+1)
+}
+
+// doHTTPRequestWithBackoff replays idempotent requests per c.retryPolicy.
+// The annotations returned hold every attempt's rate-limit description,
+// newest first: annotations.Pick reads the first match, so the SDK paces on
+// the current limit while the earlier ones stay on record.
+//
+// A DELETE replayed after an ambiguous failure that then 404s is treated as
+// done: the first attempt already removed the row.
+func (c *Client) doHTTPRequestWithBackoff(ctx context.Context, urlAddress string, method string, data any, resourceResponse any, reqOptions ...ReqOpt) (http.Header, annotations.Annotations, error) {
+	return c.replayHTTPRequest(ctx, isIdempotentMethod(method), urlAddress, method, data, resourceResponse, reqOptions...)
+}
+
+// replayHTTPRequest is doHTTPRequestWithBackoff for a caller that knows
+// better than the method whether the request is safe to replay, such as a
+// batch POST made only of GETs and DELETEs.
+func (c *Client) replayHTTPRequest(ctx context.Context, idempotent bool, urlAddress string, method string, data any, resourceResponse any, reqOptions ...ReqOpt) (http.Header, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	policy := c.retryPolicy
+
+	var history annotations.Annotations
+	for retry := 0; ; retry++ {
+		header, annos, err := c.doHTTPRequest(ctx, urlAddress, method, data, resourceResponse, reqOptions...)
+		annos = append(annos, history...)
+		if err == nil {
+			return header, annos, nil
+		}
+
+		var respErr *responseError
+		if !errors.As(err, &respErr) {
+			return header, annos, err
+		}
+		if retry > 0 && method == http.MethodDelete && respErr.statusCode == http.StatusNotFound {
+			l.Debug("baton-servicenow: replayed delete found the record already gone",
+				zap.String("url", urlAddress),
+				zap.Int("attempt", retry+1),
+			)
+			return respErr.header, annos, nil
+		}
+
+		if ctx.Err() != nil || !idempotent || retry >= policy.MaxRetries ||
+			!isRetryableStatus(respErr.statusCode) {
+			return header, annos, err
+		}
+
+		delay := policy.backoff(retry+1, respErr.header, time.Now())
+		l.Debug("baton-servicenow: retrying request after transient failure",
+			zap.String("url", urlAddress),
+			zap.String("method", method),
+			zap.Int("attempt", retry+2),
+			zap.Int("max_attempts", policy.MaxRetries+1),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return header, annos, ctx.Err()
+		}
+		history = annos
+	}
+}
+
+// isAmbiguousFailure reports whether a failed write may nonetheless have been
+// applied: the connection dropped or timed out before a response arrived, or
+// the instance answered with a 5xx after possibly committing. A 429 is not
+// ambiguous -- ServiceNow rejects rate-limited requests before running them.
+func isAmbiguousFailure(err error) bool {
+	var respErr *responseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	return respErr.statusCode != http.StatusTooManyRequests && isRetryableStatus(respErr.statusCode)
+}
+
+// createMembership POSTs a membership row without ever leaving a duplicate
+// behind. After an ambiguous failure it asks exists whether the row is there:
+// if so the write landed and the call succeeds; if not it was never applied,
+// so it's replayed per c.retryPolicy, as is a 429. Only a check that itself
+// fails leaves the outcome unknown, and that is reported as an error.
+//
+// Annotations follow doHTTPRequestWithBackoff: every request's, newest first.
+func (c *Client) createMembership(
+	ctx context.Context,
+	urlAddress string,
+	record any,
+	exists func(ctx context.Context) (bool, annotations.Annotations, error),
+) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+	policy := c.retryPolicy
+
+	var history annotations.Annotations
+	for replay := 0; ; replay++ {
+		annos, err := c.post(ctx, urlAddress, nil, record, WithIncludeResponseBody())
+		annos = append(annos, history...)
+		if err == nil {
+			return annos, nil
+		}
+
+		var respErr *responseError
+		if ctx.Err() != nil || !errors.As(err, &respErr) {
+			return annos, err
+		}
+
+		switch {
+		case isAmbiguousFailure(err):
+			found, checkAnnos, checkErr := exists(ctx)
+			annos = append(checkAnnos, annos...)
+			if checkErr != nil {
+				return annos, fmt.Errorf("write outcome unknown, membership check failed (%w): %w", checkErr, err)
+			}
+			if found {
+				l.Debug("baton-servicenow: membership found after ambiguous write failure",
+					zap.String("url", urlAddress),
+					zap.Int("attempt", replay+1),
+					zap.Error(err),
+				)
+				return annos, nil
+			}
+		case respErr.statusCode != http.StatusTooManyRequests:
+			return annos, err
+		}
+
+		if replay >= policy.MaxRetries {
+			return annos, err
+		}
+
+		delay := policy.backoff(replay+1, respErr.header, time.Now())
+		l.Debug("baton-servicenow: replaying write that was not applied",
+			zap.String("url", urlAddress),
+			zap.Int("attempt", replay+2),
+			zap.Int("max_attempts", policy.MaxRetries+1),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return annos, ctx.Err()
+		}
+		history = annos
+	}
+}
+
 func (c *Client) CreateUserAccount(ctx context.Context, user any) (*User, annotations.Annotations, error) {
 	var response UserResponse
 
@@ -793,7 +1313,23 @@ func (c *Client) CreateUserAccount(ctx context.Context, user any) (*User, annota
 	return &response.Result, annos, nil
 }
 
+// DeleteUser removes a sys_user. The connector only deletes users it just
+// created and couldn't finish setting up.
+func (c *Client) DeleteUser(ctx context.Context, userId string) (annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, userId); err != nil {
+		return annos, err
+	}
+	return c.delete(
+		ctx,
+		c.apiURL(UserBaseUrl, c.deployment, userId),
+		nil,
+	)
+}
+
 func (c *Client) UpdateUserActiveStatus(ctx context.Context, userId string, active bool) (*User, annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, userId); err != nil {
+		return nil, annos, err
+	}
 	payload := map[string]bool{
 		"active": active,
 	}
@@ -814,18 +1350,121 @@ func (c *Client) UpdateUserActiveStatus(ctx context.Context, userId string, acti
 	return &response.Result, annos, nil
 }
 
+// SetUserPassword sets a sys_user's local password. user_password is a
+// one-way encrypted column: written as an actual value, ServiceNow stores the
+// string as-is and the account can't log in with it, so this has to go
+// through sysparm_input_display_value. It's kept to its own PATCH because
+// that flag would also make reference columns expect display values.
+func (c *Client) SetUserPassword(ctx context.Context, userId string, password string, needsReset bool) (annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, userId); err != nil {
+		return annos, err
+	}
+	payload := map[string]string{
+		"user_password":        password,
+		"password_needs_reset": strconv.FormatBool(needsReset),
+	}
+
+	annos, err := c.patch(
+		ctx,
+		c.apiURL(UserBaseUrl, c.deployment, userId),
+		nil,
+		payload,
+		WithQueryParam("sysparm_input_display_value", "true"),
+		// doHTTPRequest always decodes a PATCH body; keep the echoed
+		// record down to its sys_id.
+		WithIncludeResponseBody(),
+		WithFields("sys_id"),
+	)
+	if err != nil {
+		return annos, fmt.Errorf("failed to set user password in ServiceNow: %w", err)
+	}
+
+	return annos, nil
+}
+
+// UpdateUser PATCHes the given sys_user columns and returns the updated
+// record, restricted to the fields a sync reads so the result can be turned
+// straight back into a resource.
+func (c *Client) UpdateUser(ctx context.Context, userId string, attributes map[string]string) (*User, annotations.Annotations, error) {
+	if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, userId); err != nil {
+		return nil, annos, err
+	}
+	var response UserResponse
+	annos, err := c.patch(
+		ctx,
+		c.apiURL(UserBaseUrl, c.deployment, userId),
+		&response,
+		attributes,
+		WithIncludeResponseBody(),
+		WithFields(userFields(c.CustomUserFields)...),
+	)
+
+	if err != nil {
+		return nil, annos, fmt.Errorf("failed to update user in ServiceNow: %w", err)
+	}
+
+	return &response.Result, annos, nil
+}
+
+// GetDictionaryEntries returns the sys_dictionary rows describing the given
+// columns of table. Columns that don't exist on the table are simply absent
+// from the result.
+func (c *Client) GetDictionaryEntries(ctx context.Context, table string, columns []string) ([]DictionaryEntry, annotations.Annotations, error) {
+	if len(columns) == 0 {
+		return nil, nil, nil
+	}
+
+	query, err := NewQuery().Equals("name", table).In("element", columns...).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp DictionaryEntriesResponse
+	_, annos, err := c.get(
+		ctx,
+		c.apiURL(DictionaryBaseUrl, c.deployment),
+		&resp,
+		WithQuery(query),
+		WithFields("sys_id", "name", "element", "internal_type", "read_only", "active"),
+		WithPageLimit(len(columns)),
+	)
+	if err != nil {
+		return nil, annos, err
+	}
+
+	return resp.Result, annos, nil
+}
+
 // Includes variables that come from variable sets (Table API -> item_option_new) and choices for those set variables.
+// Takes two Batch API calls: the item's variables and its set links, then the
+// sets' variables and their choices (matched through question.variable_set,
+// so they don't wait on the variable sys_ids).
 func (c *Client) GetCatalogItemVariablesPlusSets(ctx context.Context, itemSysID string) ([]CatalogItemVariable, annotations.Annotations, error) {
-	itemVars, annos, err := c.GetCatalogItemVariables(ctx, itemSysID)
+	linksOpts, err := variableSetLinksReqOpts(itemSysID, PaginationVars{Limit: 200})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	first := c.NewBatch()
+	itemVarsItem := first.Get(c.apiURL(ServiceCatalogItemVariablesUrl, c.deployment, itemSysID))
+	linksItem := first.Get(c.apiURL(VariableSetM2MBaseUrl, c.deployment), linksOpts...)
+	annos, err := first.Execute(ctx)
 	if err != nil {
 		return nil, annos, fmt.Errorf("failed to get item variables: %w", err)
 	}
 
+	var itemVarsResp CatalogItemVariablesResponse
+	if err := itemVarsItem.Decode(&itemVarsResp); err != nil {
+		return nil, annos, fmt.Errorf("failed to get item variables: %w", err)
+	}
+	itemVars := itemVarsResp.Result
+
 	// Find attached variable sets
-	links, _, annos, err := c.GetVariableSetLinksForItem(ctx, itemSysID, PaginationVars{Limit: 200})
-	if err != nil {
+	var linksResp VariableSetM2MResponse
+	if err := linksItem.Decode(&linksResp); err != nil {
 		return nil, annos, fmt.Errorf("failed to get variable set links: %w", err)
 	}
+	links := linksResp.Result
 	if len(links) == 0 {
 		return itemVars, annos, nil // nothing to add
 	}
@@ -835,23 +1474,38 @@ func (c *Client) GetCatalogItemVariablesPlusSets(ctx context.Context, itemSysID
 		setIDs = append(setIDs, l.VariableSet)
 	}
 
-	// Fetch variables that belong to those sets
-	setVars, _, annos, err := c.GetVariablesBySetIDs(ctx, setIDs, PaginationVars{Limit: 500})
+	// Fetch variables that belong to those sets, and their choices (so
+	// selects have options)
+	setVarsOpts, err := variablesBySetIDsReqOpts(setIDs, PaginationVars{Limit: 500})
+	if err != nil {
+		return nil, annos, err
+	}
+	choicesOpts, err := questionChoicesReqOpts(NewQuery().In("question.variable_set", setIDs...), PaginationVars{Limit: 1000})
+	if err != nil {
+		return nil, annos, err
+	}
+
+	second := c.NewBatch()
+	setVarsItem := second.Get(c.apiURL(ItemOptionNewBaseUrl, c.deployment), setVarsOpts...)
+	choicesItem := second.Get(c.apiURL(QuestionChoiceBaseUrl, c.deployment), choicesOpts...)
+	secondAnnos, err := second.Execute(ctx)
+	annos = append(secondAnnos, annos...)
 	if err != nil {
-		return nil, annos, fmt.Errorf("failde to get variables by set ids: %w", err)
+		return nil, annos, fmt.Errorf("failed to get variables by set ids: %w", err)
 	}
 
-	// Fetch choices for set variables (so selects have options)
-	varIDs := make([]string, 0, len(setVars))
-	for _, v := range setVars {
-		varIDs = append(varIDs, v.SysID)
+	var setVarsResp ItemOptionNewResponse
+	if err := setVarsItem.Decode(&setVarsResp); err != nil {
+		return nil, annos, fmt.Errorf("failed to get variables by set ids: %w", err)
 	}
-	choices, _, annos, err := c.GetChoicesForVariables(ctx, varIDs, PaginationVars{Limit: 1000})
-	if err != nil {
+	setVars := setVarsResp.Result
+
+	var choicesResp QuestionChoiceResponse
+	if err := choicesItem.Decode(&choicesResp); err != nil {
 		return nil, annos, fmt.Errorf("failed to get choices for set variables: %w", err)
 	}
-	choicesByQ := make(map[string][]QuestionChoice, len(varIDs))
-	for _, ch := range choices {
+	choicesByQ := make(map[string][]QuestionChoice, len(setVars))
+	for _, ch := range choicesResp.Result {
 		choicesByQ[ch.Question] = append(choicesByQ[ch.Question], ch)
 	}
 
@@ -877,54 +1531,84 @@ func (c *Client) GetCatalogItemVariablesPlusSets(ctx context.Context, itemSysID
 	return out, annos, nil
 }
 
-func (c *Client) GetVariableSetLinksForItem(ctx context.Context, itemSysID string, pg PaginationVars) ([]VariableSetM2M, string, annotations.Annotations, error) {
-	var resp VariableSetM2MResponse
+func variableSetLinksReqOpts(itemSysID string, pg PaginationVars) ([]ReqOpt, error) {
+	query, err := NewQuery().Equals("sc_cat_item", itemSysID).Build()
+	if err != nil {
+		return nil, err
+	}
 	req := []ReqOpt{
-		WithQueryParam("sysparm_query", fmt.Sprintf("sc_cat_item=%s", itemSysID)),
+		WithQueryParam("sysparm_query", query),
 		WithQueryParam("sysparm_fields", "sys_id,variable_set"),
 		WithQueryParam("sysparm_exclude_reference_link", "true"),
 	}
-	req = append(req, paginationVarsToReqOptions(&pg)...)
+	return append(req, paginationVarsToReqOptions(&pg)...), nil
+}
 
-	next, annos, err := c.get(ctx, c.apiURL(VariableSetM2MBaseUrl, c.deployment), &resp, req...)
+func (c *Client) GetVariableSetLinksForItem(ctx context.Context, itemSysID string, pg PaginationVars) ([]VariableSetM2M, string, annotations.Annotations, error) {
+	reqOpts, err := variableSetLinksReqOpts(itemSysID, pg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var resp VariableSetM2MResponse
+	next, annos, err := c.get(ctx, c.apiURL(VariableSetM2MBaseUrl, c.deployment), &resp, reqOpts...)
 	if err != nil {
 		return nil, "", annos, err
 	}
 	return resp.Result, next, annos, nil
 }
 
-func (c *Client) GetVariablesBySetIDs(ctx context.Context, setIDs []string, pg PaginationVars) ([]ItemOptionNew, string, annotations.Annotations, error) {
-	if len(setIDs) == 0 {
-		return nil, "", nil, nil
+func variablesBySetIDsReqOpts(setIDs []string, pg PaginationVars) ([]ReqOpt, error) {
+	query, err := NewQuery().In("variable_set", setIDs...).Build()
+	if err != nil {
+		return nil, err
 	}
-	var resp ItemOptionNewResponse
 	req := []ReqOpt{
-		WithQueryParam("sysparm_query", "variable_setIN"+strings.Join(setIDs, ",")),
+		WithQueryParam("sysparm_query", query),
 		WithQueryParam("sysparm_fields", "sys_id,name,question_text,type,mandatory,default_value,reference,attributes,active,cat_item,variable_set"),
 		WithQueryParam("sysparm_exclude_reference_link", "true"),
 	}
-	req = append(req, paginationVarsToReqOptions(&pg)...)
+	return append(req, paginationVarsToReqOptions(&pg)...), nil
+}
 
-	next, annos, err := c.get(ctx, c.apiURL(ItemOptionNewBaseUrl, c.deployment), &resp, req...)
+func (c *Client) GetVariablesBySetIDs(ctx context.Context, setIDs []string, pg PaginationVars) ([]ItemOptionNew, string, annotations.Annotations, error) {
+	if len(setIDs) == 0 {
+		return nil, "", nil, nil
+	}
+	reqOpts, err := variablesBySetIDsReqOpts(setIDs, pg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var resp ItemOptionNewResponse
+	next, annos, err := c.get(ctx, c.apiURL(ItemOptionNewBaseUrl, c.deployment), &resp, reqOpts...)
 	if err != nil {
 		return nil, "", annos, err
 	}
 	return resp.Result, next, annos, nil
 }
 
-func (c *Client) GetChoicesForVariables(ctx context.Context, varIDs []string, pg PaginationVars) ([]QuestionChoice, string, annotations.Annotations, error) {
-	if len(varIDs) == 0 {
-		return nil, "", nil, nil
+func questionChoicesReqOpts(q *Query, pg PaginationVars) ([]ReqOpt, error) {
+	query, err := q.Build()
+	if err != nil {
+		return nil, err
 	}
-	var resp QuestionChoiceResponse
 	req := []ReqOpt{
-		WithQueryParam("sysparm_query", "questionIN"+strings.Join(varIDs, ",")),
+		WithQueryParam("sysparm_query", query),
 		WithQueryParam("sysparm_fields", "sys_id,label,value,question"),
 		WithQueryParam("sysparm_exclude_reference_link", "true"),
 	}
-	req = append(req, paginationVarsToReqOptions(&pg)...)
+	return append(req, paginationVarsToReqOptions(&pg)...), nil
+}
 
-	next, annos, err := c.get(ctx, c.apiURL(QuestionChoiceBaseUrl, c.deployment), &resp, req...)
+func (c *Client) GetChoicesForVariables(ctx context.Context, varIDs []string, pg PaginationVars) ([]QuestionChoice, string, annotations.Annotations, error) {
+	if len(varIDs) == 0 {
+		return nil, "", nil, nil
+	}
+	reqOpts, err := questionChoicesReqOpts(NewQuery().In("question", varIDs...), pg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var resp QuestionChoiceResponse
+	next, annos, err := c.get(ctx, c.apiURL(QuestionChoiceBaseUrl, c.deployment), &resp, reqOpts...)
 	if err != nil {
 		return nil, "", annos, err
 	}
@@ -933,9 +1617,13 @@ func (c *Client) GetChoicesForVariables(ctx context.Context, varIDs []string, pg
 
 // Unused but consider switching to this to get both direct catalog item variables and variables from variable sets.
 func (c *Client) GetVariablesForItem(ctx context.Context, itemSysID string, pg PaginationVars) ([]ItemOptionNew, string, annotations.Annotations, error) {
+	query, err := NewQuery().Equals("cat_item", itemSysID).Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
 	var resp ItemOptionNewResponse
 	req := []ReqOpt{
-		WithQueryParam("sysparm_query", fmt.Sprintf("cat_item=%s", itemSysID)),
+		WithQueryParam("sysparm_query", query),
 		WithQueryParam("sysparm_fields", "sys_id,name,question_text,type,mandatory,default_value,reference,attributes,active,cat_item,variable_set"),
 		WithQueryParam("sysparm_exclude_reference_link", "true"),
 	}
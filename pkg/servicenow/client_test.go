@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -16,6 +18,7 @@ import (
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // TestGetRoles_DoesNotTruncateOnShortNonEmptyPage guards against treating a
@@ -310,6 +313,68 @@ func TestNewClientValidatesBaseURL(t *testing.T) {
 	}
 }
 
+// The grant expiry table is spliced into URL paths, and durations with
+// nowhere to record them would make grants silently permanent.
+func TestNewClientValidatesGrantExpiry(t *testing.T) {
+	cases := []struct {
+		name      string
+		table     string
+		durations map[string]time.Duration
+		wantErr   bool
+	}{
+		{"off", "", nil, false},
+		{"custom table", "u_grant_expiry", map[string]time.Duration{"Database Admins": 8 * time.Hour}, false},
+		{"scoped table without durations", "x_acme_jit_expiry", nil, false},
+		{"durations without a table", "", map[string]time.Duration{"itil": time.Hour}, true},
+		{"zero duration", "u_grant_expiry", map[string]time.Duration{"itil": 0}, true},
+		{"negative duration", "u_grant_expiry", map[string]time.Duration{"itil": -time.Hour}, true},
+		{"system table", "sys_user", map[string]time.Duration{"itil": time.Hour}, true},
+		{"path in table name", "u_x/../sys_user", map[string]time.Duration{"itil": time.Hour}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewClient(nil, "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, "", WithGrantExpiry(tc.table, tc.durations))
+			if tc.wantErr && err == nil {
+				t.Errorf("table=%q durations=%v: want an error at construction, got nil", tc.table, tc.durations)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("table=%q durations=%v: unexpected error %v", tc.table, tc.durations, err)
+			}
+		})
+	}
+}
+
+// Grant durations are set per group or role; a sys_id entry wins over a
+// name entry, and anything unlisted is permanent.
+func TestParseGrantDurations(t *testing.T) {
+	durations, err := ParseGrantDurations([]string{"Database Admins=8", " itil = 24 ", "a=b=2", "r-itil=1"})
+	if err != nil {
+		t.Fatalf("ParseGrantDurations: %v", err)
+	}
+	c := &Client{GrantDurations: durations}
+	for _, tc := range []struct {
+		id, name string
+		want     time.Duration
+	}{
+		{"g-db", "Database Admins", 8 * time.Hour},
+		{"r-other", "itil", 24 * time.Hour},
+		{"r-itil", "itil", time.Hour},
+		{"g-x", "a=b", 2 * time.Hour},
+		{"g-apollo", "Apollo", 0},
+	} {
+		if got := c.GrantDuration(tc.id, tc.name); got != tc.want {
+			t.Errorf("GrantDuration(%q, %q) = %s, want %s", tc.id, tc.name, got, tc.want)
+		}
+	}
+
+	for _, entry := range []string{"itil", "=8", "itil=", "itil=eight"} {
+		if _, err := ParseGrantDurations([]string{entry}); err == nil {
+			t.Errorf("ParseGrantDurations(%q): want an error, got nil", entry)
+		}
+	}
+}
+
 // TestAuthRetryRecoversFrom401 guards withAuthRetry against the error-plumbing
 // change underneath it: the retry only fires if status.Code() still resolves to
 // Unauthenticated, which now means resolving *through* uhttp's wrapped error and
@@ -433,7 +498,10 @@ func TestErrorCarriesRateLimitDescription(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL)
+	// Retries disabled: this is what the SDK sees once the client's own
+	// backoff has given up on the 429.
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{}))
 	if err != nil {
 		t.Fatalf("unexpected error creating client: %v", err)
 	}
@@ -492,7 +560,10 @@ func TestErrorCarriesRateLimitDescription_NoHeaders(t *testing.T) {
 	}))
 	defer server.Close()
 
-	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL)
+	// Retries disabled: this is what the SDK sees once the client's own
+	// backoff has given up on the 429.
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{}))
 	if err != nil {
 		t.Fatalf("unexpected error creating client: %v", err)
 	}
@@ -532,3 +603,442 @@ func TestErrorCarriesRateLimitDescription_NoHeaders(t *testing.T) {
 		t.Errorf("ResetAt is %v out, want the synthesized ~60s fallback", wait)
 	}
 }
+
+// user_password written as an actual value is stored verbatim and the
+// account can't log in with it. SetUserPassword must go through
+// sysparm_input_display_value, on its own request so the flag can't change
+// how any reference column in a create/update payload is interpreted.
+func TestSetUserPasswordUsesInputDisplayValue(t *testing.T) {
+	var gotQuery string
+	var gotBody map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.Query().Get("sysparm_input_display_value")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(SingleResponse[BaseResource]{Result: BaseResource{Id: "user-1"}}); err != nil {
+			t.Errorf("failed to encode test response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	if _, err := client.SetUserPassword(context.Background(), "user-1", "s3cret!Pass", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotQuery != "true" {
+		t.Errorf("sysparm_input_display_value = %q, want \"true\"", gotQuery)
+	}
+	if len(gotBody) != 2 || gotBody["user_password"] != "s3cret!Pass" || gotBody["password_needs_reset"] != "true" {
+		t.Errorf("request body = %v, want only user_password and password_needs_reset=true", gotBody)
+	}
+}
+
+// A 503 during node failover, or a 429 from a rate-limit rule, should cost a
+// short wait rather than the whole sync page -- and the limit reported by
+// every attempt stays on the annotations, the final one first.
+func TestTransientFailuresAreRetriedForIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "100")
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("X-RateLimit-Remaining", "2")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("X-RateLimit-Remaining", "50")
+			if err := json.NewEncoder(w).Encode(ListResponse[Role]{Result: []Role{}}); err != nil {
+				t.Errorf("failed to encode test response: %v", err)
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	_, _, annos, err := client.GetRoles(context.Background(), KeysetPaginationVars{Limit: 50})
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got: %v", err)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+
+	var remaining []int64
+	for _, a := range annos {
+		rl := &v2.RateLimitDescription{}
+		if a.MessageIs(rl) {
+			if err := a.UnmarshalTo(rl); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			remaining = append(remaining, rl.GetRemaining())
+		}
+	}
+	// The SDK reports a 429 as remaining 0 whatever the header says.
+	if fmt.Sprint(remaining) != "[50 0 2]" {
+		t.Errorf("rate limit remaining per attempt = %v, want [50 0 2] (newest first)", remaining)
+	}
+}
+
+// POST and PATCH aren't replayed blindly: a 5xx doesn't say whether the write
+// landed, and when the follow-up membership check can't say either, the
+// failure has to surface rather than risk a duplicate row.
+func TestTransientFailuresAreNotRetriedForWrites(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			calls.Add(1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	if _, err := client.AddUserToGroup(context.Background(), GroupMemberPayload{User: "u", Group: "g"}); err == nil {
+		t.Fatal("expected the 502 to surface")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d POSTs, want 1", got)
+	}
+}
+
+// A DELETE whose first response was lost and whose replay 404s already did
+// its job.
+func TestReplayedDeleteTreatsNotFoundAsDone(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	if _, err := client.RemoveUserFromGroup(context.Background(), "member-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2", got)
+	}
+}
+
+func TestRetryPolicyBackoffHonorsServerHints(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	cases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"retry-after seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"retry-after date", http.Header{"Retry-After": {now.Add(12 * time.Second).Format(http.TimeFormat)}}, 12 * time.Second},
+		{"ratelimit reset epoch", http.Header{"X-Ratelimit-Reset": {fmt.Sprint(now.Add(5 * time.Second).Unix())}}, 5 * time.Second},
+		{"hint capped at max delay", http.Header{"Retry-After": {"3600"}}, 30 * time.Second},
+		{"reset in the past", http.Header{"X-Ratelimit-Reset": {fmt.Sprint(now.Add(-time.Minute).Unix())}}, 0},
+	}
+	for _, tc := range cases {
+		if got := policy.backoff(1, tc.header, now); got != tc.want {
+			t.Errorf("%s: backoff = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// Without a hint: exponential with jitter, within [delay/2, delay].
+	for retry, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 30 * time.Second} {
+		got := policy.backoff(retry, nil, now)
+		if got < ceiling/2 || got > ceiling {
+			t.Errorf("retry %d: backoff = %v, want within [%v, %v]", retry, got, ceiling/2, ceiling)
+		}
+	}
+}
+
+// droppingMembershipServer is a fake Table API for the membership tables
+// that can commit a POST and then drop the connection without answering --
+// the timeout-after-commit case -- or drop it before committing.
+type droppingMembershipServer struct {
+	t *testing.T
+
+	mu   sync.Mutex
+	rows map[string][]map[string]string // table -> rows
+
+	// dropAfterCommit and dropBeforeCommit are how many upcoming POSTs to
+	// drop on each side of the commit.
+	dropAfterCommit  int
+	dropBeforeCommit int
+	posts            int
+}
+
+func (f *droppingMembershipServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	table := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		f.posts++
+		if f.dropBeforeCommit > 0 {
+			f.dropBeforeCommit--
+			f.drop(w)
+			return
+		}
+		var row map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&row); err != nil {
+			f.t.Errorf("failed to decode POST body: %v", err)
+		}
+		row["sys_id"] = fmt.Sprintf("row%d", f.posts)
+		f.rows[table] = append(f.rows[table], row)
+		if f.dropAfterCommit > 0 {
+			f.dropAfterCommit--
+			f.drop(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(SingleResponse[map[string]string]{Result: row})
+
+	case http.MethodGet:
+		var matched []map[string]string
+		for _, row := range f.rows[table] {
+			if matchesEqualityTerms(row, r.URL.Query().Get("sysparm_query")) {
+				matched = append(matched, row)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ListResponse[map[string]string]{Result: matched})
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// drop closes the connection without writing a response.
+func (f *droppingMembershipServer) drop(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		f.t.Fatalf("failed to hijack connection: %v", err)
+	}
+	conn.Close()
+}
+
+// matchesEqualityTerms applies the field=value terms of an encoded query,
+// ignoring the keyset ordering and cursor terms.
+func matchesEqualityTerms(row map[string]string, query string) bool {
+	for _, term := range strings.Split(query, "^") {
+		field, value, ok := strings.Cut(term, "=")
+		if !ok || strings.ContainsAny(field, "<>!") {
+			continue
+		}
+		if row[field] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMembershipWritesSurviveDroppedResponses(t *testing.T) {
+	cases := []struct {
+		name       string
+		table      string
+		call       func(c *Client) (annotations.Annotations, error)
+		dropAfter  int
+		dropBefore int
+		wantPosts  int
+	}{
+		{
+			name:  "group member committed, response dropped",
+			table: "sys_user_grmember",
+			call: func(c *Client) (annotations.Annotations, error) {
+				return c.AddUserToGroup(context.Background(), GroupMemberPayload{User: "u1", Group: "g1"})
+			},
+			dropAfter: 1,
+			wantPosts: 1,
+		},
+		{
+			name:  "user role committed, response dropped",
+			table: "sys_user_has_role",
+			call: func(c *Client) (annotations.Annotations, error) {
+				return c.GrantRoleToUser(context.Background(), UserToRolePayload{User: "u1", Role: "r1"})
+			},
+			dropAfter: 1,
+			wantPosts: 1,
+		},
+		{
+			name:  "group role committed, response dropped",
+			table: "sys_group_has_role",
+			call: func(c *Client) (annotations.Annotations, error) {
+				return c.GrantRoleToGroup(context.Background(), GroupToRolePayload{Group: "g1", Role: "r1"})
+			},
+			dropAfter: 1,
+			wantPosts: 1,
+		},
+		{
+			name:  "group member dropped before commit is replayed once",
+			table: "sys_user_grmember",
+			call: func(c *Client) (annotations.Annotations, error) {
+				return c.AddUserToGroup(context.Background(), GroupMemberPayload{User: "u1", Group: "g1"})
+			},
+			dropBefore: 1,
+			wantPosts:  2,
+		},
+		{
+			name:  "user role dropped before commit, then committed and dropped",
+			table: "sys_user_has_role",
+			call: func(c *Client) (annotations.Annotations, error) {
+				return c.GrantRoleToUser(context.Background(), UserToRolePayload{User: "u1", Role: "r1"})
+			},
+			dropBefore: 1,
+			dropAfter:  1,
+			wantPosts:  2,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &droppingMembershipServer{
+				t:                t,
+				rows:             map[string][]map[string]string{},
+				dropAfterCommit:  tc.dropAfter,
+				dropBeforeCommit: tc.dropBefore,
+			}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+
+			client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+				WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}))
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			if _, err := tc.call(client); err != nil {
+				t.Fatalf("expected the write to be confirmed, got: %v", err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if got := len(fake.rows[tc.table]); got != 1 {
+				t.Errorf("%s has %d rows, want exactly 1", tc.table, got)
+			}
+			if fake.posts != tc.wantPosts {
+				t.Errorf("server saw %d POSTs, want %d", fake.posts, tc.wantPosts)
+			}
+		})
+	}
+}
+
+// Callers sharing a Client never have more requests in flight than
+// WithMaxConcurrentRequests allows, however many of them fan out at once.
+func TestConcurrentRequestsAreBoundedPerInstance(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":[]}`))
+	}))
+	defer server.Close()
+
+	c, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithRetryPolicy(RetryPolicy{}), WithMaxConcurrentRequests(2))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, _, err := c.GetRoles(context.Background(), KeysetPaginationVars{Limit: 10}); err != nil {
+				t.Errorf("GetRoles: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != 2 {
+		t.Errorf("peak in-flight requests = %d, want 2", got)
+	}
+
+	if _, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL,
+		WithMaxConcurrentRequests(0)); err == nil {
+		t.Error("expected a max of 0 concurrent requests to be rejected")
+	}
+}
+
+// Once a response says no requests remain, the instance's next request
+// waits for the reset it named -- but a made-up reset (uhttp's default for
+// a 429 without headers) doesn't pause anything.
+func TestRequestLimiterPausesUntilTheNamedReset(t *testing.T) {
+	exhausted := func(resetAt time.Time) *v2.RateLimitDescription {
+		return v2.RateLimitDescription_builder{
+			Status:  v2.RateLimitDescription_STATUS_OVERLIMIT,
+			Limit:   100,
+			ResetAt: timestamppb.New(resetAt),
+		}.Build()
+	}
+	acquireWithin := func(l *requestLimiter, d time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), d)
+		defer cancel()
+		return l.acquire(ctx)
+	}
+
+	l, err := newRequestLimiter(2, time.Minute)
+	if err != nil {
+		t.Fatalf("newRequestLimiter: %v", err)
+	}
+	if err := acquireWithin(l, time.Second); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	l.release(exhausted(time.Now().Add(time.Minute)), nil)
+	if err := acquireWithin(l, time.Second); err != nil {
+		t.Fatalf("a reset the response didn't name paused the next request: %v", err)
+	}
+
+	resetAt := time.Now().Add(300 * time.Millisecond)
+	l.release(exhausted(resetAt), http.Header{"X-Ratelimit-Reset": []string{strconv.FormatInt(resetAt.Unix()+1, 10)}})
+	if err := acquireWithin(l, 100*time.Millisecond); err == nil {
+		t.Fatal("expected the request to wait for the named reset")
+	}
+	if err := acquireWithin(l, time.Second); err != nil {
+		t.Fatalf("acquire after the reset: %v", err)
+	}
+	if wait := time.Until(resetAt); wait > 0 {
+		t.Errorf("acquired %v before the reset", wait)
+	}
+}
@@ -0,0 +1,97 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// CMDB: cmdb_ci_business_app (Business Applications) and cmdb_ci_service
+// (Services, business services among them). Both extend cmdb_ci, which holds
+// the ownership columns: owned_by and managed_by reference sys_user,
+// support_group references sys_user_group.
+const (
+	BusinessApplicationsTable = "cmdb_ci_business_app"
+	BusinessServicesTable     = "cmdb_ci_service"
+)
+
+// ConfigurationItemFields are the CI columns a business application or
+// service is built from. Columns one of the two tables lacks come back
+// empty.
+var ConfigurationItemFields = []string{
+	"sys_id", "name", "number", "short_description", "sys_class_name",
+	"owned_by", "managed_by", "support_group",
+	"operational_status", "install_status", "business_criticality", "used_for", "version",
+}
+
+// WithCMDB turns on syncing business applications and services. It's off
+// by default: CMDB read access is often granted separately from user
+// administration, and the tables can be large.
+func WithCMDB(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncCMDB = enabled
+	}
+}
+
+// GetConfigurationItems lists one of the CMDB tables above.
+func (c *Client) GetConfigurationItems(ctx context.Context, table string, paginationVars KeysetPaginationVars) ([]ConfigurationItem, string, annotations.Annotations, error) {
+	return getKeysetPage(ctx, c, c.apiURL(TableAPIBaseURL+"/%s", c.deployment, table),
+		&FilterVars{Fields: ConfigurationItemFields}, &paginationVars,
+		func(ci ConfigurationItem) string { return ci.Id })
+}
+
+// SyncedUserIDs returns which of userIds a sync would list: the allowed
+// domains, the configured domain and the user filter apply as they do to
+// GetUsers.
+func (c *Client) SyncedUserIDs(ctx context.Context, userIds ...string) (map[string]bool, annotations.Annotations, error) {
+	if len(userIds) == 0 {
+		return nil, nil, nil
+	}
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, annos, err
+	}
+	getAnnos, synced, err := c.syncedIDs(ctx, c.apiURL(UsersBaseUrl, c.deployment),
+		NewQuery().In("sys_id", userIds...).And(userQuery(c.AllowedDomains, sysDomains, c.Filters.User)), len(userIds))
+	return synced, append(getAnnos, annos...), err
+}
+
+// SyncedGroupIDs is SyncedUserIDs for groups, scoped like GetGroups.
+func (c *Client) SyncedGroupIDs(ctx context.Context, groupIds ...string) (map[string]bool, annotations.Annotations, error) {
+	if len(groupIds) == 0 {
+		return nil, nil, nil
+	}
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, annos, err
+	}
+	getAnnos, synced, err := c.syncedIDs(ctx, c.apiURL(GroupsBaseUrl, c.deployment),
+		NewQuery().In("sys_id", groupIds...).And(groupQuery(sysDomains, c.Filters.Group)), len(groupIds))
+	return synced, append(getAnnos, annos...), err
+}
+
+func (c *Client) syncedIDs(ctx context.Context, urlAddress string, q *Query, limit int) (annotations.Annotations, map[string]bool, error) {
+	query, err := q.Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resp ListResponse[BaseResource]
+	_, annos, err := c.get(
+		ctx,
+		urlAddress,
+		&resp,
+		WithQuery(query),
+		WithFields("sys_id"),
+		WithPageLimit(limit),
+	)
+	if err != nil {
+		return annos, nil, err
+	}
+
+	synced := make(map[string]bool, len(resp.Result))
+	for _, row := range resp.Result {
+		synced[row.Id] = true
+	}
+	return annos, synced, nil
+}
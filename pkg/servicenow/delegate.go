@@ -0,0 +1,123 @@
+package servicenow
+
+import (
+	"context"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// Table sys_user_delegate (Delegates): delegate acts for user on approvals,
+// assignments, notifications and/or meeting invitations from starts until
+// ends. Both times are GlideDateTimes, read and written in UTC.
+const (
+	DelegatesBaseUrl      = TableAPIBaseURL + "/sys_user_delegate"
+	DelegateDetailBaseUrl = DelegatesBaseUrl + "/%s"
+)
+
+var DelegateFields = []string{"sys_id", "user", "delegate", "starts", "ends", "approvals", "assignments", "notifications", "invitations"}
+
+// DefaultDelegationDuration is how long a delegation the connector creates
+// lasts.
+const DefaultDelegationDuration = 30 * 24 * time.Hour
+
+// WithDelegationDuration replaces DefaultDelegationDuration.
+func WithDelegationDuration(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.DelegationDuration = d
+	}
+}
+
+// delegationQuery is the sys_user_delegate condition. When userId and
+// delegateId are both empty (enumeration), both ends of a delegation are
+// scoped like userToGroupQuery scopes a member, so grants only name users
+// the sync lists.
+func delegationQuery(userId string, delegateId string, domains []string, sysDomains []string, userFilter string) *Query {
+	q := NewQuery()
+	if userId != "" {
+		q.Equals("user", userId)
+	}
+	if delegateId != "" {
+		q.Equals("delegate", delegateId)
+	}
+	if userId == "" && delegateId == "" {
+		for _, reference := range []string{"user", "delegate"} {
+			q.And(buildDomainQuery(reference+".email", domains)).
+				And(sysDomainQuery(reference+".sys_domain", sysDomains)).
+				FilterVia(reference, userFilter)
+		}
+	}
+	return q
+}
+
+// GetDelegations lists sys_user_delegate rows, of one user to one delegate
+// or, with both empty, every delegation between synced users. Expired
+// delegations are listed too; see Delegation.Expired.
+func (c *Client) GetDelegations(ctx context.Context, userId string, delegateId string, paginationVars KeysetPaginationVars) ([]Delegation, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	query, err := delegationQuery(userId, delegateId, c.AllowedDomains, sysDomains, c.Filters.User).Build()
+	if err != nil {
+		return nil, "", annos, err
+	}
+	rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(DelegatesBaseUrl, c.deployment),
+		&FilterVars{Fields: DelegateFields, Query: query}, &paginationVars,
+		func(d Delegation) string { return d.Id })
+	return rows, next, append(pageAnnos, annos...), err
+}
+
+// CreateDelegation creates a delegation of user to delegate, refusing
+// either user outside the configured domain. Like the membership writes,
+// it never leaves a duplicate behind (see createMembership).
+func (c *Client) CreateDelegation(ctx context.Context, record DelegationPayload) (annotations.Annotations, error) {
+	for _, id := range []string{record.User, record.Delegate} {
+		if annos, err := c.requireInSysDomain(ctx, UserBaseUrl, id); err != nil {
+			return annos, err
+		}
+	}
+	return c.createMembership(ctx, c.apiURL(DelegatesBaseUrl, c.deployment), &record,
+		func(ctx context.Context) (bool, annotations.Annotations, error) {
+			rows, annos, err := c.GetActiveDelegations(ctx, record.User, record.Delegate)
+			return len(rows) > 0, annos, err
+		})
+}
+
+// GetActiveDelegations returns every delegation of userId to delegateId
+// that hasn't expired. Expiry is checked here rather than in the query:
+// ServiceNow reads a date-time in an encoded query in the sync account's
+// time zone, which the connector doesn't know.
+func (c *Client) GetActiveDelegations(ctx context.Context, userId string, delegateId string) ([]Delegation, annotations.Annotations, error) {
+	now := time.Now()
+	var active []Delegation
+	var annos annotations.Annotations
+	page := KeysetPaginationVars{Limit: delegationPageSize}
+	for {
+		rows, next, pageAnnos, err := c.GetDelegations(ctx, userId, delegateId, page)
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return nil, annos, err
+		}
+		for _, row := range rows {
+			if !row.Expired(now) {
+				active = append(active, row)
+			}
+		}
+		if next == "" {
+			return active, annos, nil
+		}
+		if page.LastID, page.Offset, err = ParseKeysetToken(next); err != nil {
+			return nil, annos, err
+		}
+	}
+}
+
+// delegationPageSize is the page size of GetActiveDelegations. One pair of
+// users rarely has more than a couple of rows.
+const delegationPageSize = 50
+
+// RemoveDelegations deletes sys_user_delegate rows through the Batch API.
+func (c *Client) RemoveDelegations(ctx context.Context, ids []string) (annotations.Annotations, error) {
+	return c.deleteRecords(ctx, DelegateDetailBaseUrl, ids)
+}
@@ -0,0 +1,177 @@
+package servicenow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Table domain (Domains), on domain-separated instances. Records of
+// separated tables carry the domain they belong to in sys_domain.
+const (
+	DomainsBaseUrl = TableAPIBaseURL + "/domain"
+	DomainBaseUrl  = DomainsBaseUrl + "/%s"
+)
+
+// DomainFields are the domain columns the scope walk reads.
+var DomainFields = []string{"sys_id", "name", "parent"}
+
+// WithSysDomain scopes the client to a domain of a domain-separated
+// instance: users, groups and memberships are only listed when they belong
+// to it or to a domain below it, and writes to a user or group outside it
+// are refused. sysID is the domain's sys_id. Roles aren't domain separated
+// and are listed as before.
+func WithSysDomain(sysID string) ClientOption {
+	return func(c *Client) {
+		c.SysDomain = sysID
+	}
+}
+
+// SysDomainScope returns the configured domain's sys_id followed by those of
+// every domain below it, or nil when no domain is configured. The walk runs
+// once per Client; until it succeeds, each caller retries it. A domain that
+// doesn't exist is an error rather than an empty scope, which would make a
+// sync silently list nothing.
+func (c *Client) SysDomainScope(ctx context.Context) ([]string, annotations.Annotations, error) {
+	if c.SysDomain == "" {
+		return nil, nil, nil
+	}
+
+	c.domainMu.Lock()
+	defer c.domainMu.Unlock()
+	if c.domainScope != nil {
+		return c.domainScope, nil, nil
+	}
+
+	var root SingleResponse[Domain]
+	_, annos, err := c.get(ctx, c.apiURL(DomainBaseUrl, c.deployment, c.SysDomain), &root, WithFields(DomainFields...))
+	if err != nil {
+		return nil, annos, fmt.Errorf("failed to read domain %s: %w", c.SysDomain, err)
+	}
+
+	scope := []string{c.SysDomain}
+	seen := map[string]bool{c.SysDomain: true}
+	// Each round lists the children of the domains the previous one found.
+	// seen guards against a parent cycle, which ServiceNow doesn't prevent.
+	for parents := scope; len(parents) > 0; {
+		children, childAnnos, err := c.childDomains(ctx, parents)
+		annos = append(childAnnos, annos...)
+		if err != nil {
+			return nil, annos, fmt.Errorf("failed to list the domains under %s: %w", c.SysDomain, err)
+		}
+
+		parents = nil
+		for _, child := range children {
+			if !seen[child.Id] {
+				seen[child.Id] = true
+				scope = append(scope, child.Id)
+				parents = append(parents, child.Id)
+			}
+		}
+	}
+
+	c.domainScope = scope
+	return scope, annos, nil
+}
+
+// childDomains lists every domain whose parent is one of parents.
+func (c *Client) childDomains(ctx context.Context, parents []string) ([]Domain, annotations.Annotations, error) {
+	query, err := NewQuery().In("parent", parents...).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := &FilterVars{Fields: DomainFields, Query: query}
+
+	var domains []Domain
+	var annos annotations.Annotations
+	page := KeysetPaginationVars{Limit: domainPageSize}
+	for {
+		rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(DomainsBaseUrl, c.deployment),
+			filter, &page,
+			func(d Domain) string { return d.Id })
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return nil, annos, err
+		}
+		domains = append(domains, rows...)
+		if next == "" {
+			return domains, annos, nil
+		}
+		if page.LastID, page.Offset, err = ParseKeysetToken(next); err != nil {
+			return nil, annos, err
+		}
+	}
+}
+
+// domainPageSize is the page size of the domain walk.
+const domainPageSize = 200
+
+// inSysDomain reports whether a record's sys_domain is in scope. Without a
+// configured domain everything is.
+func (c *Client) inSysDomain(ctx context.Context, sysDomain string) (bool, annotations.Annotations, error) {
+	scope, annos, err := c.SysDomainScope(ctx)
+	if err != nil || scope == nil {
+		return scope == nil, annos, err
+	}
+	return slices.Contains(scope, sysDomain), annos, nil
+}
+
+// requireInSysDomain fails with PermissionDenied unless the sys_user or
+// sys_user_group record at pattern (UserBaseUrl, GroupBaseUrl) belongs to
+// the configured domain scope. Writes call it first, so a connector scoped
+// to one customer's domain can't change another's records; revokes, which
+// delete rows by sys_id, call it through RequireUserInSysDomain and
+// RequireGroupInSysDomain.
+func (c *Client) requireInSysDomain(ctx context.Context, pattern string, id string) (annotations.Annotations, error) {
+	if c.SysDomain == "" {
+		return nil, nil
+	}
+
+	var record SingleResponse[struct {
+		SysDomain string `json:"sys_domain"`
+	}]
+	_, annos, err := c.get(ctx, c.apiURL(pattern, c.deployment, id), &record, WithFields("sys_id", "sys_domain"))
+	if err != nil {
+		return annos, fmt.Errorf("failed to read the domain of %s: %w", id, err)
+	}
+
+	ok, scopeAnnos, err := c.inSysDomain(ctx, record.Result.SysDomain)
+	annos = append(scopeAnnos, annos...)
+	if err != nil {
+		return annos, err
+	}
+	if !ok {
+		return annos, status.Errorf(codes.PermissionDenied, "%s is in domain %q, outside the configured domain %s", id, record.Result.SysDomain, c.SysDomain)
+	}
+	return annos, nil
+}
+
+// RequireUserInSysDomain fails with PermissionDenied unless sys_user userId
+// belongs to the configured domain scope.
+func (c *Client) RequireUserInSysDomain(ctx context.Context, userId string) (annotations.Annotations, error) {
+	return c.requireInSysDomain(ctx, UserBaseUrl, userId)
+}
+
+// RequireGroupInSysDomain fails with PermissionDenied unless sys_user_group
+// groupId belongs to the configured domain scope.
+func (c *Client) RequireGroupInSysDomain(ctx context.Context, groupId string) (annotations.Annotations, error) {
+	return c.requireInSysDomain(ctx, GroupBaseUrl, groupId)
+}
+
+// checkReadInSysDomain fails with NotFound when a record just read belongs
+// to a domain outside the configured scope: to a connector scoped to one
+// domain, another's records don't exist.
+func (c *Client) checkReadInSysDomain(ctx context.Context, id string, sysDomain string) (annotations.Annotations, error) {
+	ok, annos, err := c.inSysDomain(ctx, sysDomain)
+	if err != nil {
+		return annos, err
+	}
+	if !ok {
+		return annos, status.Errorf(codes.NotFound, "%s is outside the configured domain %s", id, c.SysDomain)
+	}
+	return annos, nil
+}
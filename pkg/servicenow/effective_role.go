@@ -0,0 +1,73 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// Every role a user holds has a sys_user_has_role row, inherited ones
+// included, and the row says where the role came from: granted_by is the
+// group it came through and included_in_role the role that contains it.
+// Effective roles are read from there.
+var EffectiveRoleFields = []string{
+	"sys_id", "role", "role.name", "inherited",
+	"granted_by", "granted_by.name", "included_in_role", "included_in_role.name",
+}
+
+// The ways a user comes to hold a role.
+const (
+	RolePathDirect = "direct"
+	RolePathGroup  = "group"
+	RolePathRole   = "role"
+)
+
+// effectiveRolePageSize is the page size of GetEffectiveRoles.
+const effectiveRolePageSize = 200
+
+// WithEffectiveRoles turns on adding each user's effective roles to their
+// profile during sync. It's off by default: it costs a request per user.
+func WithEffectiveRoles(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncEffectiveRoles = enabled
+	}
+}
+
+// GetEffectiveRoles returns every role userId holds, with how they hold it.
+// Unlike GetUserToRole, it isn't limited to grantable roles or the role
+// filter: it answers why a user has a role, not what the sync lists.
+//
+// It reads sys_user_has_role rather than /api/global/user_role_inheritance.
+// That endpoint isn't a documented ServiceNow API and isn't on every
+// instance, while the table already says where each role came from and is
+// read with the ACLs, domain scoping and paging the rest of the sync uses.
+func (c *Client) GetEffectiveRoles(ctx context.Context, userId string) ([]EffectiveRole, annotations.Annotations, error) {
+	annos, err := c.requireInSysDomain(ctx, UserBaseUrl, userId)
+	if err != nil {
+		return nil, annos, err
+	}
+
+	query, err := NewQuery().Equals("user", userId).Build()
+	if err != nil {
+		return nil, annos, err
+	}
+
+	var roles []EffectiveRole
+	page := KeysetPaginationVars{Limit: effectiveRolePageSize}
+	for {
+		pageRoles, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(UserRolesBaseUrl, c.deployment),
+			&FilterVars{Fields: EffectiveRoleFields, Query: query}, &page,
+			func(r EffectiveRole) string { return r.Id })
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return nil, annos, err
+		}
+		roles = append(roles, pageRoles...)
+		if next == "" {
+			return roles, annos, nil
+		}
+		if page.LastID, page.Offset, err = ParseKeysetToken(next); err != nil {
+			return nil, annos, err
+		}
+	}
+}
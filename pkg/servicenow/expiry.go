@@ -0,0 +1,203 @@
+package servicenow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// ServiceNow has no expiry on sys_user_grmember or sys_user_has_role, so
+// the expiries of time-bound grants are kept in a table the operator
+// creates, one row per grant:
+//
+//	u_table   string             sys_user_grmember or sys_user_has_role
+//	u_user    string             the user's sys_id
+//	u_target  string             the group's or role's sys_id
+//	u_expires glide_date_time    when the grant ends, in UTC
+const (
+	GrantExpiryGroupMember = "sys_user_grmember"
+	GrantExpiryUserRole    = "sys_user_has_role"
+)
+
+var GrantExpiryFields = []string{"sys_id", "u_table", "u_user", "u_target", "u_expires"}
+
+// grantExpiryTablePattern matches a custom (u_) or scoped application (x_)
+// table name; anything else is spliced into a URL path, so it's rejected.
+var grantExpiryTablePattern = regexp.MustCompile(`^[ux]_[a-z0-9_]+$`)
+
+// WithGrantExpiry records an expiry in table for every group membership and
+// role the connector grants a user whose group or role is in durations,
+// keyed by sys_id or name, that long after the grant. Grants of anything
+// else stay permanent, but all grants are still synced with the expiries
+// already in table.
+func WithGrantExpiry(table string, durations map[string]time.Duration) ClientOption {
+	return func(c *Client) {
+		c.GrantExpiryTable = table
+		c.GrantDurations = durations
+	}
+}
+
+// ParseGrantDurations reads name=hours entries, such as "Database
+// Admins=8", into durations for WithGrantExpiry. The name is a group's or
+// role's name or sys_id, and may itself contain "=": the hours follow the
+// last one.
+func ParseGrantDurations(entries []string) (map[string]time.Duration, error) {
+	durations := make(map[string]time.Duration, len(entries))
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid grant duration %q: want name=hours", entry)
+		}
+		name := strings.TrimSpace(entry[:i])
+		hours, err := strconv.Atoi(strings.TrimSpace(entry[i+1:]))
+		if name == "" || err != nil {
+			return nil, fmt.Errorf("invalid grant duration %q: want name=hours", entry)
+		}
+		durations[name] = time.Duration(hours) * time.Hour
+	}
+	return durations, nil
+}
+
+// GrantDuration returns how long a grant of the group or role with sys_id
+// targetId and name targetName lasts, or 0 for a permanent grant. An entry
+// for the sys_id wins over one for the name.
+func (c *Client) GrantDuration(targetId string, targetName string) time.Duration {
+	if d, ok := c.GrantDurations[targetId]; ok {
+		return d
+	}
+	return c.GrantDurations[targetName]
+}
+
+func (c *Client) validateGrantExpiry() error {
+	for name, d := range c.GrantDurations {
+		if d <= 0 {
+			return fmt.Errorf("invalid grant duration %s for %q: must be positive", d, name)
+		}
+	}
+	if c.GrantExpiryTable == "" {
+		if len(c.GrantDurations) > 0 {
+			return fmt.Errorf("invalid grant durations: need a grant expiry table to record expiries in")
+		}
+		return nil
+	}
+	if !grantExpiryTablePattern.MatchString(c.GrantExpiryTable) {
+		return fmt.Errorf("invalid grant expiry table %q: must be a u_ or x_ table name", c.GrantExpiryTable)
+	}
+	return nil
+}
+
+func (c *Client) grantExpiryURL() string {
+	return c.apiURL(TableAPIBaseURL+"/%s", c.deployment, c.GrantExpiryTable)
+}
+
+// GetGrantExpiries lists the grant expiry table, expired rows included.
+func (c *Client) GetGrantExpiries(ctx context.Context, paginationVars KeysetPaginationVars) ([]GrantExpiry, string, annotations.Annotations, error) {
+	return getKeysetPage(ctx, c, c.grantExpiryURL(),
+		&FilterVars{Fields: GrantExpiryFields}, &paginationVars,
+		func(e GrantExpiry) string { return e.Id })
+}
+
+// grantExpiryPageSize is the page size of grantExpiriesOf.
+const grantExpiryPageSize = 50
+
+// grantExpiriesOf returns every expiry row of one grant. There's normally
+// one, but nothing stops an operator from adding more.
+func (c *Client) grantExpiriesOf(ctx context.Context, table string, userId string, targetId string) ([]GrantExpiry, annotations.Annotations, error) {
+	query, err := NewQuery().Equals("u_table", table).Equals("u_user", userId).Equals("u_target", targetId).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.grantExpiriesMatching(ctx, query)
+}
+
+// grantExpiriesMatching returns every expiry row matching query.
+func (c *Client) grantExpiriesMatching(ctx context.Context, query string) ([]GrantExpiry, annotations.Annotations, error) {
+	var rows []GrantExpiry
+	var annos annotations.Annotations
+	page := KeysetPaginationVars{Limit: grantExpiryPageSize}
+	for {
+		pageRows, next, pageAnnos, err := getKeysetPage(ctx, c, c.grantExpiryURL(),
+			&FilterVars{Fields: GrantExpiryFields, Query: query}, &page,
+			func(e GrantExpiry) string { return e.Id })
+		annos = append(pageAnnos, annos...)
+		if err != nil {
+			return nil, annos, err
+		}
+		rows = append(rows, pageRows...)
+		if next == "" {
+			return rows, annos, nil
+		}
+		if page.LastID, page.Offset, err = ParseKeysetToken(next); err != nil {
+			return nil, annos, err
+		}
+	}
+}
+
+// SetGrantExpiry records that userId's grant of targetId in table ends at
+// expires, replacing whatever expiry the grant had.
+func (c *Client) SetGrantExpiry(ctx context.Context, table string, userId string, targetId string, expires time.Time) (annotations.Annotations, error) {
+	previous, annos, err := c.grantExpiriesOf(ctx, table, userId, targetId)
+	if err != nil {
+		return annos, err
+	}
+
+	postAnnos, err := c.post(ctx, c.grantExpiryURL(), nil, &GrantExpiryPayload{
+		Table:   table,
+		User:    userId,
+		Target:  targetId,
+		Expires: expires.UTC().Format(time.DateTime),
+	}, WithIncludeResponseBody())
+	annos = append(postAnnos, annos...)
+	if err != nil {
+		return annos, fmt.Errorf("failed to record grant expiry: %w", err)
+	}
+
+	// The old rows go only once the new one is in, so a failure here never
+	// leaves the grant without an expiry.
+	removeAnnos, err := c.RemoveGrantExpiries(ctx, grantExpiryIDs(previous))
+	return append(removeAnnos, annos...), err
+}
+
+// ClearGrantExpiry removes the expiry of userId's grant of targetId in
+// table, once the grant itself is gone.
+func (c *Client) ClearGrantExpiry(ctx context.Context, table string, userId string, targetId string) (annotations.Annotations, error) {
+	rows, annos, err := c.grantExpiriesOf(ctx, table, userId, targetId)
+	if err != nil {
+		return annos, err
+	}
+	removeAnnos, err := c.RemoveGrantExpiries(ctx, grantExpiryIDs(rows))
+	return append(removeAnnos, annos...), err
+}
+
+// ClearGrantExpiriesOfTarget removes the expiries of every grant of
+// targetId in table, once the group or role itself is gone.
+func (c *Client) ClearGrantExpiriesOfTarget(ctx context.Context, table string, targetId string) (annotations.Annotations, error) {
+	query, err := NewQuery().Equals("u_table", table).Equals("u_target", targetId).Build()
+	if err != nil {
+		return nil, err
+	}
+	rows, annos, err := c.grantExpiriesMatching(ctx, query)
+	if err != nil {
+		return annos, err
+	}
+	removeAnnos, err := c.RemoveGrantExpiries(ctx, grantExpiryIDs(rows))
+	return append(removeAnnos, annos...), err
+}
+
+// RemoveGrantExpiries deletes grant expiry rows through the Batch API.
+func (c *Client) RemoveGrantExpiries(ctx context.Context, rowIds []string) (annotations.Annotations, error) {
+	return c.deleteRecords(ctx, TableAPIBaseURL+"/"+c.GrantExpiryTable+"/%s", rowIds)
+}
+
+func grantExpiryIDs(rows []GrantExpiry) []string {
+	rv := make([]string, 0, len(rows))
+	for _, row := range rows {
+		rv = append(rv, row.Id)
+	}
+	return rv
+}
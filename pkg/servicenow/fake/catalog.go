@@ -0,0 +1,238 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Service Catalog items are sc_cat_item rows (sys_id, name,
+// short_description, description, sc_catalogs as a comma-separated list of
+// sc_catalog sys_ids, category as an sc_category sys_id, active). Their
+// variables are item_option_new rows with cat_item set, and a variable's
+// choices are question_choice rows.
+func (s *Server) serveCatalogItems(w http.ResponseWriter, r *http.Request, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		s.listCatalogItems(w, r)
+	case len(rest) == 1 && r.Method == http.MethodGet:
+		s.getCatalogItem(w, r, rest[0])
+	case len(rest) == 2 && rest[1] == "variables" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.find("sc_cat_item", rest[0]) == nil {
+			writeError(w, http.StatusNotFound, "Catalog item not found", rest[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"result": s.catalogVariables(rest[0])})
+	case len(rest) == 2 && rest[1] == "order_now" && r.Method == http.MethodPost:
+		s.orderNow(w, r, rest[0])
+	default:
+		writeError(w, http.StatusBadRequest, "Requested URI does not represent any resource", r.URL.Path)
+	}
+}
+
+func (s *Server) listCatalogItems(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	limit, offset, err := window(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+	catalog, category := params.Get("sysparm_catalog"), params.Get("sysparm_category")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var items []Record
+	for _, row := range s.tables["sc_cat_item"] {
+		if row["active"] == "false" {
+			continue
+		}
+		if catalog != "" && !inList(catalog, row["sc_catalogs"]) {
+			continue
+		}
+		if category != "" && row["category"] != category {
+			continue
+		}
+		items = append(items, row)
+	}
+
+	total := len(items)
+	result := make([]map[string]any, 0, limit)
+	for _, row := range items[min(offset, total):min(offset+limit, total)] {
+		result = append(result, s.catalogItem(row))
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Link", pageLinks(r, limit, offset, total))
+	writeJSON(w, http.StatusOK, map[string]any{"result": result})
+}
+
+func (s *Server) getCatalogItem(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row := s.find("sc_cat_item", id)
+	if row == nil {
+		writeError(w, http.StatusNotFound, "Catalog item not found", id)
+		return
+	}
+	item := s.catalogItem(row)
+	item["variables"] = s.catalogVariables(id)
+	writeJSON(w, http.StatusOK, map[string]any{"result": item})
+}
+
+func (s *Server) catalogItem(row Record) map[string]any {
+	catalogs := []map[string]string{}
+	for _, id := range strings.Split(row["sc_catalogs"], ",") {
+		if catalog := s.find("sc_catalog", id); catalog != nil {
+			catalogs = append(catalogs, map[string]string{"sys_id": id, "title": catalog["title"]})
+		}
+	}
+	category := map[string]string{}
+	if row["category"] != "" {
+		category["sys_id"] = row["category"]
+		if c := s.find("sc_category", row["category"]); c != nil {
+			category["title"] = c["title"]
+		}
+	}
+
+	return map[string]any{
+		"sys_id":            row["sys_id"],
+		"name":              row["name"],
+		"short_description": row["short_description"],
+		"description":       row["description"],
+		"sys_class_name":    "sc_cat_item",
+		"type":              "item",
+		"catalogs":          catalogs,
+		"category":          category,
+	}
+}
+
+// catalogVariables renders an item's own variables as the Service Catalog
+// API does. Variables from variable sets aren't included; the connector
+// reads those through the Table API.
+func (s *Server) catalogVariables(itemID string) []map[string]any {
+	var rows []Record
+	for _, row := range s.tables["item_option_new"] {
+		if row["cat_item"] == itemID && row["active"] != "false" {
+			rows = append(rows, row)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return compareValues(rows[i]["order"], rows[j]["order"]) < 0
+	})
+
+	variables := make([]map[string]any, 0, len(rows))
+	for _, row := range rows {
+		choices := []map[string]any{}
+		for _, choice := range s.tables["question_choice"] {
+			if choice["question"] == row["sys_id"] {
+				index, _ := strconv.Atoi(choice["order"])
+				choices = append(choices, map[string]any{"index": index, "label": choice["text"], "value": choice["value"]})
+			}
+		}
+
+		var varType any = row["type"]
+		if n, err := strconv.Atoi(row["type"]); err == nil {
+			varType = n
+		}
+		order, _ := strconv.Atoi(row["order"])
+
+		variables = append(variables, map[string]any{
+			"id":           row["sys_id"],
+			"name":         row["name"],
+			"label":        row["question_text"],
+			"type":         varType,
+			"mandatory":    row["mandatory"] == "true",
+			"active":       true,
+			"read_only":    row["read_only"] == "true",
+			"order":        order,
+			"value":        row["default_value"],
+			"reference":    row["reference"],
+			"help_text":    row["help_text"],
+			"choices":      choices,
+			"displayvalue": row["default_value"],
+		})
+	}
+	return variables
+}
+
+// orderNow places an order for one item: an sc_request and an sc_req_item
+// referencing it, with each submitted variable stored on the requested item
+// as variables.<name>. Missing mandatory variables fail the order, as in
+// ServiceNow.
+func (s *Server) orderNow(w http.ResponseWriter, r *http.Request, itemID string) {
+	var payload struct {
+		Quantity     int            `json:"sysparm_quantity"`
+		RequestedFor string         `json:"sysparm_requested_for"`
+		Variables    map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Exception while reading request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := s.find("sc_cat_item", itemID)
+	if item == nil {
+		writeError(w, http.StatusNotFound, "Catalog item not found", itemID)
+		return
+	}
+	for _, variable := range s.catalogVariables(itemID) {
+		name, _ := variable["name"].(string)
+		if mandatory, _ := variable["mandatory"].(bool); mandatory {
+			if value, ok := payload.Variables[name]; !ok || value == nil || value == "" {
+				writeError(w, http.StatusBadRequest, "Mandatory Variables are required", name)
+				return
+			}
+		}
+	}
+
+	requestedFor := payload.RequestedFor
+	if requestedFor == "" {
+		requestedFor = s.currentUser
+	}
+	requestNumber := s.nextNumber("REQ")
+	requestID := s.insert("sc_request", Record{
+		"number":        requestNumber,
+		"requested_for": requestedFor,
+		"opened_by":     s.currentUser,
+		"request_state": "requested",
+		"state":         "1",
+		"approval":      "requested",
+	})
+
+	requestedItem := Record{
+		"number":            s.nextNumber("RITM"),
+		"request":           requestID,
+		"cat_item":          itemID,
+		"requested_for":     requestedFor,
+		"short_description": item["short_description"],
+		"state":             "1",
+		"active":            "true",
+		"approval":          "requested",
+	}
+	for name, value := range payload.Variables {
+		if str, ok := value.(string); ok {
+			requestedItem["variables."+name] = str
+			continue
+		}
+		encoded, _ := json.Marshal(value)
+		requestedItem["variables."+name] = string(encoded)
+	}
+	s.insert("sc_req_item", requestedItem)
+
+	writeJSON(w, http.StatusOK, map[string]any{"result": map[string]string{
+		"sys_id":         requestID,
+		"number":         requestNumber,
+		"request_number": requestNumber,
+		"request_id":     requestID,
+		"table":          "sc_request",
+	}})
+}
@@ -0,0 +1,299 @@
+// Package fake is an in-memory ServiceNow instance for hermetic tests. It
+// serves the parts of the REST API the connector uses -- the Table API with
+// encoded queries, X-Total-Count and Link headers, the Aggregate and Batch
+// APIs, and the Service Catalog item, variable and order_now endpoints -- over
+// tables the test seeds. Point a client at it with the base URL override
+// (--base-url) set to the httptest server's URL.
+//
+// Row-level read ACLs are simulated the way ServiceNow applies them: after
+// the page window is cut, so a page can come back short or empty while
+// X-Total-Count still counts the hidden rows.
+package fake
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is a table row. Like the Table API, every value is a string, and a
+// reference column holds the referenced row's sys_id.
+type Record map[string]string
+
+// defaultReferences are the reference columns of the tables the connector
+// reads, for dot-walking (user.email) and reference links.
+var defaultReferences = map[string]map[string]string{
+	"sys_user":                          {"manager": "sys_user", "sys_domain": "domain"},
+	"sys_user_group":                    {"manager": "sys_user", "parent": "sys_user_group", "sys_domain": "domain", "cost_center": "cmn_cost_center"},
+	"domain":                            {"parent": "domain"},
+	"sys_user_grmember":                 {"user": "sys_user", "group": "sys_user_group"},
+	"sys_user_role":                     {"sys_scope": "sys_scope"},
+	"sys_user_has_role":                 {"user": "sys_user", "role": "sys_user_role", "granted_by": "sys_user_group", "included_in_role": "sys_user_role"},
+	"sys_group_has_role":                {"group": "sys_user_group", "role": "sys_user_role"},
+	"license_has_user":                  {"license": "license_details", "user": "sys_user"},
+	"sys_user_delegate":                 {"user": "sys_user", "delegate": "sys_user"},
+	"kb_uc_can_read_mtom":               {"user_criteria": "user_criteria", "kb_knowledge_base": "kb_knowledge_base"},
+	"kb_uc_can_contribute_mtom":         {"user_criteria": "user_criteria", "kb_knowledge_base": "kb_knowledge_base"},
+	"kb_uc_cannot_read_mtom":            {"user_criteria": "user_criteria", "kb_knowledge_base": "kb_knowledge_base"},
+	"sc_cat_item_user_criteria_mtom":    {"user_criteria": "user_criteria", "sc_cat_item": "sc_cat_item"},
+	"sc_cat_item_user_criteria_no_mtom": {"user_criteria": "user_criteria", "sc_cat_item": "sc_cat_item"},
+	"sys_security_acl":                  {"operation": "sys_security_operation", "type": "sys_security_type"},
+	"sys_security_acl_role":             {"sys_security_acl": "sys_security_acl", "sys_user_role": "sys_user_role"},
+	"cmdb_ci_business_app":              {"owned_by": "sys_user", "managed_by": "sys_user", "support_group": "sys_user_group"},
+	"cmdb_ci_service":                   {"owned_by": "sys_user", "managed_by": "sys_user", "support_group": "sys_user_group"},
+	"sc_request":                        {"requested_for": "sys_user", "opened_by": "sys_user"},
+	"sc_req_item":                       {"request": "sc_request", "cat_item": "sc_cat_item", "requested_for": "sys_user"},
+	"item_option_new":                   {"cat_item": "sc_cat_item", "variable_set": "item_option_new_set"},
+	"io_set_item":                       {"sc_cat_item": "sc_cat_item", "variable_set": "item_option_new_set"},
+	"question_choice":                   {"question": "item_option_new"},
+	"label_entry":                       {"label": "label"},
+}
+
+// defaultValues are the dictionary defaults the instance fills in for
+// columns a row is inserted without.
+var defaultValues = map[string]Record{
+	"sys_user_role": {"sys_scope": "global"},
+}
+
+// Server is the fake instance. Its methods are safe to call while requests
+// are in flight.
+type Server struct {
+	mu          sync.Mutex
+	tables      map[string][]Record
+	references  map[string]map[string]string
+	hidden      map[string]func(Record) bool
+	denied      map[string]map[string]bool
+	missing     map[string]bool
+	currentUser string
+	sequence    int
+	requests    []string
+}
+
+// New returns an empty instance authenticated as currentUser, the sys_id
+// javascript:gs.getUserID() resolves to.
+func New(currentUser string) *Server {
+	references := make(map[string]map[string]string, len(defaultReferences))
+	for table, fields := range defaultReferences {
+		references[table] = make(map[string]string, len(fields))
+		for field, target := range fields {
+			references[table][field] = target
+		}
+	}
+
+	return &Server{
+		tables:      make(map[string][]Record),
+		references:  references,
+		hidden:      make(map[string]func(Record) bool),
+		denied:      make(map[string]map[string]bool),
+		missing:     make(map[string]bool),
+		currentUser: currentUser,
+	}
+}
+
+// Start serves the instance on a local httptest server. Close it when done.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// Insert adds a row and returns its sys_id, generating one unless the row
+// has it already.
+func (s *Server) Insert(table string, row Record) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insert(table, row)
+}
+
+func (s *Server) insert(table string, row Record) string {
+	stored := make(Record, len(row)+3)
+	for k, v := range defaultValues[table] {
+		stored[k] = v
+	}
+	for k, v := range row {
+		stored[k] = v
+	}
+	if stored["sys_id"] == "" {
+		stored["sys_id"] = newSysID()
+	}
+	now := time.Now().UTC().Format(time.DateTime)
+	stored["sys_created_on"] = now
+	stored["sys_updated_on"] = now
+	s.tables[table] = append(s.tables[table], stored)
+	return stored["sys_id"]
+}
+
+// Rows returns a copy of every row of table matching the encoded query, in
+// its ORDERBY order, ACLs ignored.
+func (s *Server) Rows(table string, encodedQuery string) ([]Record, error) {
+	q, err := parseQuery(encodedQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matched := s.match(table, q)
+	rows := make([]Record, 0, len(matched))
+	for _, row := range matched {
+		rows = append(rows, copyRecord(row))
+	}
+	return rows, nil
+}
+
+// SetReference declares field of table a reference to target, for
+// dot-walking it in queries and sysparm_fields.
+func (s *Server) SetReference(table string, field string, target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.references[table] == nil {
+		s.references[table] = make(map[string]string)
+	}
+	s.references[table][field] = target
+}
+
+// HideRows simulates a row-level read ACL on table: rows for which hide
+// returns true are left out of reads, but still counted in X-Total-Count
+// and the Aggregate API, as ServiceNow does.
+func (s *Server) HideRows(table string, hide func(Record) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hidden[table] = hide
+}
+
+// Deny simulates a table-level ACL denying method on table: every such
+// request fails with 403.
+func (s *Server) Deny(table string, method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.denied[table] == nil {
+		s.denied[table] = make(map[string]bool)
+	}
+	s.denied[table][method] = true
+}
+
+// Uninstall simulates an instance without the plugin that provides table:
+// every Table and Aggregate API request for it fails with 400, as ServiceNow
+// answers for an invalid table.
+func (s *Server) Uninstall(table string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missing[table] = true
+}
+
+// Requests returns "METHOD path" for every request served so far, Batch API
+// sub-requests included.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// A base URL override stands in for https://<instance>/api, so paths
+	// arrive with or without the /api prefix.
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) >= 3 && parts[0] == "now" && (parts[1] == "table" || parts[1] == "stats") {
+		s.mu.Lock()
+		missing := s.missing[parts[2]]
+		s.mu.Unlock()
+		if missing {
+			writeError(w, http.StatusBadRequest, "Invalid table "+parts[2], "")
+			return
+		}
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "now" && parts[1] == "v1" && parts[2] == "batch" && r.Method == http.MethodPost:
+		s.serveBatch(w, r)
+	case len(parts) == 3 && parts[0] == "now" && parts[1] == "stats" && r.Method == http.MethodGet:
+		s.serveStats(w, r, parts[2])
+	case len(parts) == 3 && parts[0] == "now" && parts[1] == "table":
+		s.serveTable(w, r, parts[2])
+	case len(parts) == 4 && parts[0] == "now" && parts[1] == "table":
+		s.serveRecord(w, r, parts[2], parts[3])
+	case len(parts) >= 3 && parts[0] == "sn_sc" && parts[1] == "servicecatalog" && parts[2] == "items":
+		s.serveCatalogItems(w, r, parts[3:])
+	default:
+		writeError(w, http.StatusBadRequest, "Requested URI does not represent any resource", path)
+	}
+}
+
+func (s *Server) lookupFunc(table string, row Record) func(field string) string {
+	return func(field string) string {
+		return s.lookup(table, row, field)
+	}
+}
+
+// lookup resolves field on row, following references for each dot. A
+// column whose name itself has a dot (variables.<name> on requested items)
+// wins over dot-walking.
+func (s *Server) lookup(table string, row Record, field string) string {
+	for {
+		if value, ok := row[field]; ok {
+			return value
+		}
+		head, rest, dotted := strings.Cut(field, ".")
+		if !dotted {
+			return row[field]
+		}
+		target := s.references[table][head]
+		if target == "" {
+			return ""
+		}
+		next := s.find(target, row[head])
+		if next == nil {
+			return ""
+		}
+		table, row, field = target, next, rest
+	}
+}
+
+func (s *Server) find(table string, id string) Record {
+	if id == "" {
+		return nil
+	}
+	for _, row := range s.tables[table] {
+		if row["sys_id"] == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func (s *Server) isHidden(table string, row Record) bool {
+	hide := s.hidden[table]
+	return hide != nil && hide(row)
+}
+
+func (s *Server) isDenied(table string, method string) bool {
+	return s.denied[table][method]
+}
+
+func (s *Server) nextNumber(prefix string) string {
+	s.sequence++
+	return fmt.Sprintf("%s%07d", prefix, 10000+s.sequence)
+}
+
+func newSysID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func copyRecord(row Record) Record {
+	c := make(Record, len(row))
+	for k, v := range row {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,104 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestQueryMatching(t *testing.T) {
+	s := New("u-admin")
+	alice := s.Insert("sys_user", Record{"sys_id": "u1", "user_name": "alice", "email": "Alice@Example.com", "active": "true", "age": "9"})
+	s.Insert("sys_user", Record{"sys_id": "u2", "user_name": "bob", "email": "bob@other.com", "active": "false", "age": "10"})
+	group := s.Insert("sys_user_group", Record{"sys_id": "g1", "name": "Apollo", "type": "itil"})
+	s.Insert("sys_user_grmember", Record{"sys_id": "m1", "user": alice, "group": group})
+	s.Insert("sys_user_grmember", Record{"sys_id": "m2", "user": "u2", "group": group})
+
+	tests := []struct {
+		table string
+		query string
+		want  string
+	}{
+		{"sys_user", "", "u1,u2"},
+		{"sys_user", "active=true", "u1"},
+		{"sys_user", "emailENDSWITH@example.com", "u1"},
+		{"sys_user", "emailENDSWITH@example.com^ORemailENDSWITH@other.com", "u1,u2"},
+		{"sys_user", "active=true^ORactive=false^user_nameSTARTSWITHb", "u2"},
+		{"sys_user", "sys_idINu2,u3", "u2"},
+		{"sys_user", "sys_idNOT INu2", "u1"},
+		{"sys_user", "sys_id>u1^ORDERBYsys_id", "u2"},
+		{"sys_user", "age>9", "u2"},
+		{"sys_user", "ORDERBYDESCsys_id", "u2,u1"},
+		{"sys_user", "user_name=alice^NQuser_name=bob", "u1,u2"},
+		{"sys_user", "sys_id=javascript:gs.getUserID()", ""},
+		{"sys_user_grmember", "user.emailENDSWITH@example.com^group.type=itil", "m1"},
+		{"sys_user_grmember", "user.active=false", "m2"},
+	}
+	for _, tc := range tests {
+		rows, err := s.Rows(tc.table, tc.query)
+		if err != nil {
+			t.Errorf("%s %q: %v", tc.table, tc.query, err)
+			continue
+		}
+
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row["sys_id"])
+		}
+		if got := strings.Join(ids, ","); got != tc.want {
+			t.Errorf("%s %q = %q, want %q", tc.table, tc.query, got, tc.want)
+		}
+	}
+
+	if _, err := s.Rows("sys_user", "javascript:gs.getUserID()"); err == nil {
+		t.Error("expected an unsupported query to fail")
+	}
+}
+
+// Hidden rows are cut from the page after the window, so the page comes back
+// empty while X-Total-Count still counts them -- the case keyset pagination
+// has to step past.
+func TestListingAppliesRowACLsAfterTheWindow(t *testing.T) {
+	s := New("u-admin")
+	for _, id := range []string{"a", "b", "c", "d"} {
+		s.Insert("sys_user_role", Record{"sys_id": id, "name": id})
+	}
+	s.HideRows("sys_user_role", func(row Record) bool { return row["sys_id"] < "c" })
+
+	server := s.Start()
+	defer server.Close()
+
+	get := func(params url.Values) (*http.Response, []Record) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/api/now/table/sys_user_role?" + params.Encode())
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Result []Record `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode failed: %v", err)
+		}
+		return resp, body.Result
+	}
+
+	resp, rows := get(url.Values{"sysparm_query": {"ORDERBYsys_id"}, "sysparm_limit": {"2"}})
+	if len(rows) != 0 || resp.Header.Get("X-Total-Count") != "4" {
+		t.Errorf("first window: %d rows, X-Total-Count %q; want 0 rows and 4", len(rows), resp.Header.Get("X-Total-Count"))
+	}
+	if link := resp.Header.Get("Link"); !strings.Contains(link, `sysparm_offset=2&sysparm_query=ORDERBYsys_id>;rel="next"`) {
+		t.Errorf("Link %q has no next page at offset 2", link)
+	}
+
+	resp, rows = get(url.Values{"sysparm_query": {"ORDERBYsys_id"}, "sysparm_limit": {"2"}, "sysparm_offset": {"2"}})
+	if len(rows) != 2 || rows[0]["sys_id"] != "c" {
+		t.Errorf("second window = %v, want c and d", rows)
+	}
+	if link := resp.Header.Get("Link"); strings.Contains(link, `rel="next"`) {
+		t.Errorf("Link %q has a next page after the last window", link)
+	}
+}
@@ -0,0 +1,225 @@
+package fake
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// operators in match order: a longer operator must come before any operator
+// it starts with, so NOT IN isn't read as NOT and IN, or >= as >.
+var operators = []string{
+	"ISNOTEMPTY", "ISEMPTY", "ANYTHING",
+	"NOT IN", "NOT LIKE", "STARTSWITH", "ENDSWITH", "LIKE", "IN",
+	"!=", ">=", "<=", "=", ">", "<",
+}
+
+var fieldPattern = regexp.MustCompile(`^[a-z0-9_.]+`)
+
+type condition struct {
+	field string
+	op    string
+	value string
+}
+
+// clause is one AND-ed term of a query: a condition, or several joined by
+// ^OR, which binds tighter than ^.
+type clause []condition
+
+type ordering struct {
+	field string
+	desc  bool
+}
+
+// query is a parsed encoded query. ^NQ starts a new query whose rows are
+// OR-ed with the previous one's.
+type query struct {
+	alternatives [][]clause
+	orderBy      []ordering
+}
+
+// parseQuery parses the subset of ServiceNow's encoded-query grammar the
+// connector and its filters use. Anything else is an error, so a test that
+// sends an unsupported query fails instead of silently matching everything.
+func parseQuery(raw string) (*query, error) {
+	q := &query{alternatives: [][]clause{nil}}
+	if raw == "" {
+		return q, nil
+	}
+
+	for _, alternative := range strings.Split(raw, "^NQ") {
+		if len(q.alternatives[len(q.alternatives)-1]) > 0 {
+			q.alternatives = append(q.alternatives, nil)
+		}
+		clauses := &q.alternatives[len(q.alternatives)-1]
+
+		for _, term := range strings.Split(alternative, "^") {
+			switch {
+			case term == "" || term == "EQ":
+				continue
+			case strings.HasPrefix(term, "ORDERBYDESC"):
+				q.orderBy = append(q.orderBy, ordering{field: strings.TrimPrefix(term, "ORDERBYDESC"), desc: true})
+				continue
+			case strings.HasPrefix(term, "ORDERBY"):
+				q.orderBy = append(q.orderBy, ordering{field: strings.TrimPrefix(term, "ORDERBY")})
+				continue
+			}
+
+			or := strings.HasPrefix(term, "OR")
+			if or {
+				term = strings.TrimPrefix(term, "OR")
+			}
+			cond, err := parseCondition(term)
+			if err != nil {
+				return nil, err
+			}
+			if or {
+				if len(*clauses) == 0 {
+					return nil, fmt.Errorf("fake: query %q starts with OR", raw)
+				}
+				last := &(*clauses)[len(*clauses)-1]
+				*last = append(*last, cond)
+				continue
+			}
+			*clauses = append(*clauses, clause{cond})
+		}
+	}
+
+	return q, nil
+}
+
+func parseCondition(term string) (condition, error) {
+	field := fieldPattern.FindString(term)
+	if field == "" {
+		return condition{}, fmt.Errorf("fake: unsupported query term %q", term)
+	}
+	rest := term[len(field):]
+	for _, op := range operators {
+		if strings.HasPrefix(rest, op) {
+			return condition{field: field, op: op, value: rest[len(op):]}, nil
+		}
+	}
+	return condition{}, fmt.Errorf("fake: unsupported operator in query term %q", term)
+}
+
+// matches reports whether the row satisfies the query. lookup resolves a
+// possibly dot-walked field of the row.
+func (q *query) matches(lookup func(field string) string, currentUser string) bool {
+	for _, alternative := range q.alternatives {
+		if matchesAll(alternative, lookup, currentUser) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAll(clauses []clause, lookup func(field string) string, currentUser string) bool {
+	for _, c := range clauses {
+		matched := false
+		for _, cond := range c {
+			if cond.matches(lookup(cond.field), currentUser) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matches compares like ServiceNow does for string columns: without regard
+// to case, and numerically when both sides are numbers.
+func (c condition) matches(actual string, currentUser string) bool {
+	value := c.value
+	if value == "javascript:gs.getUserID()" {
+		value = currentUser
+	}
+
+	a, v := strings.ToLower(actual), strings.ToLower(value)
+	switch c.op {
+	case "ISEMPTY":
+		return actual == ""
+	case "ISNOTEMPTY":
+		return actual != ""
+	case "ANYTHING":
+		return true
+	case "=":
+		return a == v
+	case "!=":
+		return a != v
+	case "STARTSWITH":
+		return strings.HasPrefix(a, v)
+	case "ENDSWITH":
+		return strings.HasSuffix(a, v)
+	case "LIKE":
+		return strings.Contains(a, v)
+	case "NOT LIKE":
+		return !strings.Contains(a, v)
+	case "IN":
+		return inList(a, v)
+	case "NOT IN":
+		return !inList(a, v)
+	}
+
+	cmp := compareValues(actual, value)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+func inList(actual string, list string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if actual == item {
+			return true
+		}
+	}
+	return false
+}
+
+func compareValues(a string, b string) int {
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// sort orders rows by the query's ORDERBY terms; without any, rows keep
+// their insertion order.
+func (q *query) sort(rows []Record, lookup func(row Record, field string) string) {
+	if len(q.orderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range q.orderBy {
+			cmp := compareValues(lookup(rows[i], o.field), lookup(rows[j], o.field))
+			if cmp == 0 {
+				continue
+			}
+			if o.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
@@ -0,0 +1,367 @@
+package fake
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultLimit is the Table API's row cap when sysparm_limit isn't sent.
+const defaultLimit = 10000
+
+func (s *Server) serveTable(w http.ResponseWriter, r *http.Request, table string) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listRecords(w, r, table)
+	case http.MethodPost:
+		s.createRecord(w, r, table)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not Supported", r.Method)
+	}
+}
+
+func (s *Server) serveRecord(w http.ResponseWriter, r *http.Request, table string, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isDenied(table, r.Method) {
+		writeACLError(w, table)
+		return
+	}
+
+	row := s.find(table, id)
+	if row == nil || (r.Method == http.MethodGet && s.isHidden(table, row)) {
+		writeError(w, http.StatusNotFound, "No Record found", "Record doesn't exist or ACL restricts the record retrieval")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]any{"result": s.render(r, table, row)})
+	case http.MethodPatch, http.MethodPut:
+		fields, err := decodeRecord(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Exception while reading request", err.Error())
+			return
+		}
+		for k, v := range fields {
+			if k != "sys_id" {
+				row[k] = v
+			}
+		}
+		s.writeRecord(w, r, http.StatusOK, table, row)
+	case http.MethodDelete:
+		rows := s.tables[table]
+		for i := range rows {
+			if rows[i]["sys_id"] == id {
+				s.tables[table] = append(rows[:i:i], rows[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not Supported", r.Method)
+	}
+}
+
+// listRecords serves a Table API GET. The window (sysparm_offset,
+// sysparm_limit) is cut from every matching row before row-level ACLs
+// drop what the caller can't read, which is why ServiceNow can return a
+// short or empty page in the middle of a listing.
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request, table string) {
+	params := r.URL.Query()
+	q, err := parseQuery(params.Get("sysparm_query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid query", err.Error())
+		return
+	}
+	limit, offset, err := window(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isDenied(table, http.MethodGet) {
+		writeACLError(w, table)
+		return
+	}
+
+	matched := s.match(table, q)
+	total := len(matched)
+	var page []Record
+	if offset < total {
+		page = matched[offset:min(offset+limit, total)]
+	}
+
+	result := make([]map[string]any, 0, len(page))
+	for _, row := range page {
+		if !s.isHidden(table, row) {
+			result = append(result, s.render(r, table, row))
+		}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if links := pageLinks(r, limit, offset, total); links != "" {
+		w.Header().Set("Link", links)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"result": result})
+}
+
+func (s *Server) match(table string, q *query) []Record {
+	var matched []Record
+	for _, row := range s.tables[table] {
+		if q.matches(s.lookupFunc(table, row), s.currentUser) {
+			matched = append(matched, row)
+		}
+	}
+	q.sort(matched, func(row Record, field string) string {
+		return s.lookup(table, row, field)
+	})
+	return matched
+}
+
+func window(params url.Values) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	if raw := params.Get("sysparm_limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("sysparm_limit %q", raw)
+		}
+		limit = n
+	}
+	if raw := params.Get("sysparm_offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("sysparm_offset %q", raw)
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// pageLinks builds the Link header ServiceNow sends with a Table API page:
+// first, prev and next where they exist, and last.
+func pageLinks(r *http.Request, limit int, offset int, total int) string {
+	link := func(rel string, at int) string {
+		u := *r.URL
+		u.Scheme, u.Host = "http", r.Host
+		params := u.Query()
+		params.Set("sysparm_limit", strconv.Itoa(limit))
+		params.Set("sysparm_offset", strconv.Itoa(at))
+		u.RawQuery = params.Encode()
+		return fmt.Sprintf("<%s>;rel=%q", u.String(), rel)
+	}
+
+	links := []string{link("first", 0)}
+	if offset > 0 {
+		links = append(links, link("prev", max(offset-limit, 0)))
+	}
+	if offset+limit < total {
+		links = append(links, link("next", offset+limit))
+	}
+	last := 0
+	if total > 0 {
+		last = (total - 1) / limit * limit
+	}
+	links = append(links, link("last", last))
+	return strings.Join(links, ",")
+}
+
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request, table string) {
+	fields, err := decodeRecord(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Exception while reading request", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isDenied(table, http.MethodPost) {
+		writeACLError(w, table)
+		return
+	}
+	delete(fields, "sys_id")
+	id := s.insert(table, fields)
+	s.writeRecord(w, r, http.StatusCreated, table, s.find(table, id))
+}
+
+// writeRecord answers a write, with the record unless the caller asked for
+// no response body.
+func (s *Server) writeRecord(w http.ResponseWriter, r *http.Request, status int, table string, row Record) {
+	if r.Header.Get("X-no-response-body") == "true" {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, map[string]any{"result": s.render(r, table, row)})
+}
+
+// render shapes a row the way the Table API returns it: only sysparm_fields
+// when given, dot-walked fields resolved, and reference columns as
+// {link, value} unless sysparm_exclude_reference_link is true.
+func (s *Server) render(r *http.Request, table string, row Record) map[string]any {
+	params := r.URL.Query()
+	referenceLinks := params.Get("sysparm_exclude_reference_link") == "false"
+
+	var fields []string
+	if raw := params.Get("sysparm_fields"); raw != "" {
+		fields = strings.Split(raw, ",")
+	} else {
+		for field := range row {
+			fields = append(fields, field)
+		}
+	}
+
+	out := make(map[string]any, len(fields))
+	for _, field := range fields {
+		value := s.lookup(table, row, field)
+		target, isReference := s.references[table][field]
+		if referenceLinks && isReference && value != "" {
+			out[field] = map[string]string{
+				"link":  fmt.Sprintf("http://%s/api/now/table/%s/%s", r.Host, target, value),
+				"value": value,
+			}
+			continue
+		}
+		out[field] = value
+	}
+	return out
+}
+
+// decodeRecord reads a JSON object body as a row, turning the non-string
+// values clients send (booleans, numbers) into the strings the Table API
+// stores.
+func decodeRecord(r *http.Request) (Record, error) {
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	row := make(Record, len(body))
+	for k, v := range body {
+		switch v := v.(type) {
+		case nil:
+			row[k] = ""
+		case string:
+			row[k] = v
+		default:
+			row[k] = fmt.Sprint(v)
+		}
+	}
+	return row, nil
+}
+
+// serveStats is the Aggregate API's row count. Like X-Total-Count, it counts
+// rows row-level ACLs would hide.
+func (s *Server) serveStats(w http.ResponseWriter, r *http.Request, table string) {
+	q, err := parseQuery(r.URL.Query().Get("sysparm_query"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid query", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isDenied(table, http.MethodGet) {
+		writeACLError(w, table)
+		return
+	}
+	count := len(s.match(table, q))
+	writeJSON(w, http.StatusOK, map[string]any{
+		"result": map[string]any{"stats": map[string]string{"count": strconv.Itoa(count)}},
+	})
+}
+
+type batchHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// serveBatch runs each Batch API sub-request against the instance in order
+// and returns every result, failures included.
+func (s *Server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		BatchRequestID string `json:"batch_request_id"`
+		RestRequests   []struct {
+			ID      string        `json:"id"`
+			Method  string        `json:"method"`
+			URL     string        `json:"url"`
+			Headers []batchHeader `json:"headers"`
+			Body    string        `json:"body"`
+		} `json:"rest_requests"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Exception while reading request", err.Error())
+		return
+	}
+
+	type servicedRequest struct {
+		ID         string        `json:"id"`
+		Body       string        `json:"body"`
+		StatusCode int           `json:"status_code"`
+		StatusText string        `json:"status_text"`
+		Headers    []batchHeader `json:"headers"`
+	}
+	serviced := make([]servicedRequest, 0, len(payload.RestRequests))
+	for _, sub := range payload.RestRequests {
+		body, err := base64.StdEncoding.DecodeString(sub.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid sub-request body", err.Error())
+			return
+		}
+		req := httptest.NewRequest(sub.Method, sub.URL, bytes.NewReader(body))
+		req.Host = r.Host
+		for _, h := range sub.Headers {
+			req.Header.Add(h.Name, h.Value)
+		}
+
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		var headers []batchHeader
+		for name, values := range rec.Header() {
+			for _, value := range values {
+				headers = append(headers, batchHeader{Name: name, Value: value})
+			}
+		}
+		serviced = append(serviced, servicedRequest{
+			ID:         sub.ID,
+			Body:       base64.StdEncoding.EncodeToString(rec.Body.Bytes()),
+			StatusCode: rec.Code,
+			StatusText: http.StatusText(rec.Code),
+			Headers:    headers,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"batch_request_id":    payload.BatchRequestID,
+		"serviced_requests":   serviced,
+		"unserviced_requests": []string{},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string, detail string) {
+	writeJSON(w, status, map[string]any{
+		"error":  map[string]string{"message": message, "detail": detail},
+		"status": "failure",
+	})
+}
+
+func writeACLError(w http.ResponseWriter, table string) {
+	writeError(w, http.StatusForbidden, "User Not Authorized", fmt.Sprintf("ACL restricts access to %s", table))
+}
@@ -0,0 +1,98 @@
+package servicenow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// QueryFilters are operator-supplied encoded queries ANDed into the
+// identity listings (see prepareUserFilters, prepareGroupFilters and
+// prepareRoleFilters). The user and group filters are also dot-walked onto
+// the membership tables, so grants stay consistent with which principals
+// actually get synced -- the same reasoning as the allowed-domains filter.
+type QueryFilters struct {
+	User  string
+	Group string
+	Role  string
+}
+
+// Validate checks every configured filter against the encoded-query grammar
+// parseFilterQuery accepts.
+func (f QueryFilters) Validate() error {
+	for name, query := range map[string]string{"user": f.User, "group": f.Group, "role": f.Role} {
+		if _, err := parseFilterQuery(query); err != nil {
+			return fmt.Errorf("invalid %s filter %q: %w", name, query, err)
+		}
+	}
+	return nil
+}
+
+// filterCondition is one "field<op>value" term of a filter, optionally OR'd
+// onto the term before it.
+type filterCondition struct {
+	or    bool
+	field string
+	op    string
+	value string
+}
+
+// filterConditionPattern is deliberately narrower than what ServiceNow
+// accepts. Field names are lowercase (as every ServiceNow column is), which
+// is what keeps the uppercase keywords -- NQ, ORDERBY, GROUPBY, RLQUERY, EQ --
+// from ever parsing as a condition: any of those would let a filter escape
+// the AND it's composed into, or reorder the keyset listing. The operator
+// alternation lists longer operators first so ">=" isn't read as ">".
+var filterConditionPattern = regexp.MustCompile(
+	`^(OR)?(` + fieldNamePattern + `)` +
+		`(!=|>=|<=|=|>|<|NOT IN|IN|STARTSWITH|ENDSWITH|NOT LIKE|LIKE|ISNOTEMPTY|ISEMPTY|ANYTHING)` +
+		`([^\x00-\x1f\x7f]*)$`,
+)
+
+// Operators that take no value.
+var unaryFilterOps = map[string]bool{
+	"ISEMPTY":    true,
+	"ISNOTEMPTY": true,
+	"ANYTHING":   true,
+}
+
+// parseFilterQuery splits an encoded query into its conditions, rejecting
+// anything outside the injection-safe grammar. An empty query parses to no
+// conditions.
+func parseFilterQuery(query string) ([]filterCondition, error) {
+	if query == "" {
+		return nil, nil
+	}
+
+	segments := strings.Split(query, "^")
+	conditions := make([]filterCondition, 0, len(segments))
+	for i, segment := range segments {
+		match := filterConditionPattern.FindStringSubmatch(segment)
+		if match == nil {
+			return nil, fmt.Errorf("condition %q is not a supported field<operator>value term", segment)
+		}
+
+		cond := filterCondition{
+			or:    match[1] != "",
+			field: match[2],
+			op:    match[3],
+			value: match[4],
+		}
+		// A leading OR would attach to whatever condition the filter is
+		// ANDed after, widening that condition instead of narrowing the
+		// listing.
+		if i == 0 && cond.or {
+			return nil, fmt.Errorf("filter cannot start with an OR condition")
+		}
+		if unaryFilterOps[cond.op] && cond.value != "" {
+			return nil, fmt.Errorf("operator %s in %q takes no value", cond.op, segment)
+		}
+		// ServiceNow evaluates javascript: values server-side.
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(cond.value)), "javascript:") {
+			return nil, fmt.Errorf("condition %q uses a script value", segment)
+		}
+		conditions = append(conditions, cond)
+	}
+
+	return conditions, nil
+}
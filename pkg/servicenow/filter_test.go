@@ -0,0 +1,62 @@
+package servicenow
+
+import (
+	"testing"
+)
+
+func TestQueryFilters_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr bool
+	}{
+		{name: "empty filter", query: ""},
+		{name: "single condition", query: "active=true"},
+		{name: "AND and OR conditions", query: "active=true^web_service_access_only=false^ORlocked_out=false"},
+		{name: "dot-walked field", query: "department.name=Engineering"},
+		{name: "IN list", query: "typeINitil,catalog"},
+		{name: "NOT IN list", query: "typeNOT INitil,catalog"},
+		{name: "unary operator", query: "emailISNOTEMPTY"},
+		{name: "comparison operator", query: "sys_created_on>=2024-01-01 00:00:00"},
+		{name: "new query escapes the AND", query: "active=true^NQactive=false", wantErr: true},
+		{name: "ORDERBY would reorder the keyset listing", query: "active=true^ORDERBYname", wantErr: true},
+		{name: "leading OR widens the preceding condition", query: "ORactive=true", wantErr: true},
+		{name: "empty condition", query: "active=true^^name=x", wantErr: true},
+		{name: "uppercase field", query: "Active=true", wantErr: true},
+		{name: "unknown operator", query: "active~true", wantErr: true},
+		{name: "unary operator with a value", query: "emailISEMPTYx", wantErr: true},
+		{name: "script value", query: "manager=javascript:gs.getUserID()", wantErr: true},
+		{name: "control character in value", query: "name=a\nb", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, filters := range []QueryFilters{{User: tc.query}, {Group: tc.query}, {Role: tc.query}} {
+				err := filters.Validate()
+				if (err != nil) != tc.wantErr {
+					t.Errorf("%+v.Validate() error = %v, wantErr %v", filters, err, tc.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryFilterVia(t *testing.T) {
+	got, err := NewQuery().FilterVia("user", "active=true^ORlocked_out=false^department.nameSTARTSWITHEng").Build()
+	want := "user.active=true^ORuser.locked_out=false^user.department.nameSTARTSWITHEng"
+	if err != nil || got != want {
+		t.Errorf("FilterVia() = %q, %v, want %q", got, err, want)
+	}
+
+	if got, err := NewQuery().FilterVia("user", "").Build(); err != nil || got != "" {
+		t.Errorf("FilterVia(empty) = %q, %v, want empty", got, err)
+	}
+}
+
+func TestNewClientRejectsInvalidFilter(t *testing.T) {
+	_, err := NewClient(nil, "", "dev0", nil, nil, nil, "",
+		WithQueryFilters(QueryFilters{User: "active=true^NQactive=false"}))
+	if err == nil {
+		t.Fatal("expected NewClient to reject a filter with a new-query clause")
+	}
+}
@@ -0,0 +1,132 @@
+package fixture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordingIsSanitizedAndReplays(t *testing.T) {
+	batchBody := base64.StdEncoding.EncodeToString([]byte(`{"result":[{"sys_id":"u1","email":"alice@acme.com"}]}`))
+	var serverURL string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "JSESSIONID=secret")
+		switch r.URL.Path {
+		case "/api/now/table/sys_user":
+			w.Header().Set("X-Total-Count", "1")
+			w.Header().Set("Link", "<"+serverURL+"/api/now/table/sys_user?sysparm_offset=0>;rel=\"first\"")
+			_, _ = io.WriteString(w, `{"result":[{"sys_id":"AbC123","user_name":"alice","email":"Alice@acme.com","active":"true","manager":{"link":"`+serverURL+`/api/now/table/sys_user/m1","value":"m1"},"department":{"link":"`+serverURL+`/api/now/table/cmn_department/d1","value":"d1","display_value":"Payroll Team"},"u_badge":"B-4471","x_corp_nickname":"Ally"}]}`)
+		case "/api/now/v1/batch":
+			_, _ = io.WriteString(w, `{"batch_request_id":"1","serviced_requests":[{"id":"1","body":"`+batchBody+`","status_code":200}],"unserviced_requests":[]}`)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(server.Client().Transport, dir, "x_corp_nickname")
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	client := &http.Client{Transport: recorder}
+
+	do := func(client *http.Client, method string, target string, body string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Basic dGVzdDp0ZXN0")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp, string(data)
+	}
+
+	listing := server.URL + "/api/now/table/sys_user?sysparm_query=emailENDSWITH@acme.com"
+	if _, body := do(client, http.MethodGet, listing, ""); !strings.Contains(body, "Alice@acme.com") {
+		t.Fatalf("the recorder changed the live response: %s", body)
+	}
+	do(client, http.MethodPost, server.URL+"/api/now/v1/batch", `{"rest_requests":[{"id":"1","method":"GET","url":"/api/now/table/sys_user?sysparm_query=user_name=alice"}]}`)
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(names) != 2 {
+		t.Fatalf("recorded %d fixtures, want 2", len(names))
+	}
+	var recorded strings.Builder
+	for _, name := range names {
+		data, _ := os.ReadFile(name)
+		recorded.Write(data)
+	}
+	fixtures, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	serviced := fixtures[1].Response.Body
+	var batch struct {
+		ServicedRequests []struct {
+			Body string `json:"body"`
+		} `json:"serviced_requests"`
+	}
+	if err := json.Unmarshal(serviced, &batch); err != nil || len(batch.ServicedRequests) != 1 {
+		t.Fatalf("recorded batch response %s doesn't decode: %v", serviced, err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(batch.ServicedRequests[0].Body)
+	recorded.Write(decoded)
+
+	for _, leak := range []string{"acme", "alice", "Alice", "Payroll", "B-4471", "Ally", "dGVzdDp0ZXN0", "JSESSIONID", strings.TrimPrefix(server.URL, "http://")} {
+		if strings.Contains(recorded.String(), leak) {
+			t.Errorf("fixtures contain %q:\n%s", leak, recorded.String())
+		}
+	}
+	for _, kept := range []string{`"AbC123"`, `"m1"`, `"d1"`, instanceHost} {
+		if !strings.Contains(recorded.String(), kept) {
+			t.Errorf("fixtures lost %s:\n%s", kept, recorded.String())
+		}
+	}
+
+	// One recording pseudonymizes a domain the same way everywhere, so the
+	// listing still matches the filter that produced it.
+	var users struct {
+		Result []struct {
+			Email string `json:"email"`
+		} `json:"result"`
+	}
+	_ = json.Unmarshal(fixtures[0].Response.Body, &users)
+	_, domain, _ := strings.Cut(users.Result[0].Email, "@")
+	if query := fixtures[0].Request.Query["sysparm_query"][0]; query != "emailENDSWITH@"+domain {
+		t.Errorf("recorded query %q doesn't use the listing's domain %q", query, domain)
+	}
+
+	replayer := NewReplayer(fixtures)
+	replayed := &http.Client{Transport: replayer}
+	resp, body := do(replayed, http.MethodGet, "http://localhost/now/table/sys_user?sysparm_query=anything", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Total-Count") != "1" || resp.Header.Get("Set-Cookie") != "" || !strings.Contains(body, `"AbC123"`) {
+		t.Errorf("replayed %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+	if got := replayer.Queries()[0].Get("sysparm_query"); got != "anything" {
+		t.Errorf("Queries()[0] = %q, want the query the client sent", got)
+	}
+
+	if _, err := replayed.Get("http://localhost/now/table/sys_user_group"); err == nil {
+		t.Error("expected a request that doesn't match the next fixture to fail")
+	}
+	do(replayed, http.MethodPost, "http://localhost/api/now/v1/batch", "{}")
+	if replayer.Remaining() != 0 {
+		t.Errorf("Remaining() = %d, want 0", replayer.Remaining())
+	}
+	if _, err := replayed.Get("http://localhost/now/table/sys_user"); err == nil {
+		t.Error("expected a request past the last fixture to fail")
+	}
+
+	if _, err := NewRecorder(nil, dir); err == nil {
+		t.Error("expected recording into a directory with fixtures to fail")
+	}
+}
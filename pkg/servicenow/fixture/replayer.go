@@ -0,0 +1,96 @@
+package fixture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Replayer is an http.RoundTripper that answers requests from fixtures, in
+// recording order, without touching the network. Each request must have
+// the method and path of the next fixture; queries aren't compared,
+// since the recorded ones are sanitized -- tests assert on Queries instead.
+// A request that doesn't match, or that comes after the last fixture, fails
+// the round trip.
+type Replayer struct {
+	mu       sync.Mutex
+	fixtures []Fixture
+	next     int
+	queries  []url.Values
+}
+
+// NewReplayer returns a Replayer serving fixtures in order.
+func NewReplayer(fixtures []Fixture) *Replayer {
+	return &Replayer{fixtures: fixtures}
+}
+
+// LoadReplayer returns a Replayer serving the fixtures recorded in dir.
+func LoadReplayer(dir string) (*Replayer, error) {
+	fixtures, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("fixture: no fixtures in %s", dir)
+	}
+	return NewReplayer(fixtures), nil
+}
+
+// Remaining is how many fixtures haven't been served yet. A test that
+// replays a whole recording expects 0 at the end.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.fixtures) - r.next
+}
+
+// Queries returns the query of every request served so far, as the client
+// sent it.
+func (r *Replayer) Queries() []url.Values {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]url.Values(nil), r.queries...)
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_, _ = io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := normalizePath(req.URL.Path)
+	if r.next >= len(r.fixtures) {
+		return nil, fmt.Errorf("fixture: unexpected request %s %s after the last of %d fixtures", req.Method, path, len(r.fixtures))
+	}
+	f := r.fixtures[r.next]
+	if f.Request.Method != req.Method || f.Request.Path != path {
+		return nil, fmt.Errorf("fixture: request %d is %s %s, but %s %s was recorded", r.next+1, req.Method, path, f.Request.Method, f.Request.Path)
+	}
+	r.next++
+	r.queries = append(r.queries, req.URL.Query())
+
+	header := make(http.Header, len(f.Response.Header))
+	for name, values := range f.Response.Header {
+		for _, v := range values {
+			header.Add(name, v)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.StatusCode, http.StatusText(f.Response.StatusCode)),
+		StatusCode:    f.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(f.Response.Body)),
+		ContentLength: int64(len(f.Response.Body)),
+		Request:       req,
+	}, nil
+}
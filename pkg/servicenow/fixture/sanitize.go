@@ -0,0 +1,272 @@
+package fixture
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// piiFields are the record fields whose values are replaced with
+// pseudonyms, along with every custom (u_) field, every configured custom
+// user field and the display value of every reference. sys_ids, references,
+// flags and timestamps are kept as recorded: they're what pagination and
+// decoding bugs depend on.
+var piiFields = map[string]bool{
+	"user_name":         true,
+	"name":              true,
+	"first_name":        true,
+	"middle_name":       true,
+	"last_name":         true,
+	"email":             true,
+	"phone":             true,
+	"mobile_phone":      true,
+	"home_phone":        true,
+	"title":             true,
+	"employee_number":   true,
+	"user_password":     true,
+	"street":            true,
+	"city":              true,
+	"zip":               true,
+	"description":       true,
+	"short_description": true,
+	"comments":          true,
+	"work_notes":        true,
+	"sys_created_by":    true,
+	"sys_updated_by":    true,
+}
+
+// queryTerm splits an encoded query condition into its field, operator and
+// value. Field names are lower case and operators upper case or symbols, so
+// the field is the longest lower-case prefix.
+var queryTerm = regexp.MustCompile(`^(OR|NQ)?([a-z0-9_.]+)(NOT IN|NOT LIKE|STARTSWITH|ENDSWITH|LIKE|IN|!=|>=|<=|=|>|<)(.*)$`)
+
+// linkURL matches the URLs in a Link header.
+var linkURL = regexp.MustCompile(`<([^>]*)>`)
+
+// emailDomain matches the domain of an email address, or of a bare
+// @domain the way allowed-domain filters put it in sysparm_query.
+var emailDomain = regexp.MustCompile(`@([A-Za-z0-9-]+\.)+[A-Za-z]{2,}`)
+
+// sanitizer pseudonymizes values with a keyed hash. The key is random per
+// recording, so pseudonyms are consistent across the fixtures of one
+// recording -- a user's email reads the same in the listing and in the
+// query that filtered it -- but can't be reversed by hashing guesses.
+type sanitizer struct {
+	key  []byte
+	host string
+	// customFields are the configured custom user fields, redacted even
+	// when they don't carry the u_ prefix.
+	customFields map[string]bool
+}
+
+func (s *sanitizer) pseudonym(prefix string, value string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.ToLower(value)))
+	return prefix + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// email keeps an address looking like one, so domain filtering still
+// behaves the same on replay.
+func (s *sanitizer) email(value string) string {
+	local, domain, ok := strings.Cut(value, "@")
+	if !ok {
+		return s.pseudonym("redacted-", value)
+	}
+	return s.pseudonym("user-", local) + s.domain(domain)
+}
+
+func (s *sanitizer) domain(domain string) string {
+	return "@" + s.pseudonym("domain-", strings.TrimPrefix(domain, "@")) + ".example"
+}
+
+// text rewrites the instance host and email domains inside free-form
+// strings: URLs, Link headers, encoded queries.
+func (s *sanitizer) text(value string) string {
+	if s.host != "" {
+		value = strings.ReplaceAll(value, s.host, instanceHost)
+	}
+	return emailDomain.ReplaceAllStringFunc(value, s.domain)
+}
+
+func (s *sanitizer) query(values url.Values) map[string][]string {
+	if len(values) == 0 {
+		return nil
+	}
+	sanitized := make(map[string][]string, len(values))
+	for key, vs := range values {
+		out := make([]string, len(vs))
+		for i, v := range vs {
+			if key == "sysparm_query" {
+				out[i] = s.encodedQuery(v)
+			} else {
+				out[i] = s.text(v)
+			}
+		}
+		sanitized[key] = out
+	}
+	return sanitized
+}
+
+// encodedQuery pseudonymizes the values compared against PII fields
+// (user_name=alice, emailENDSWITH@acme.com) and keeps everything else --
+// cursors, flags, ordering -- as recorded.
+func (s *sanitizer) encodedQuery(query string) string {
+	terms := strings.Split(query, "^")
+	for i, term := range terms {
+		m := queryTerm.FindStringSubmatch(term)
+		if m == nil {
+			terms[i] = s.text(term)
+			continue
+		}
+		field, value := m[2], m[4]
+		if !s.isPIIField(field) || value == "" {
+			terms[i] = s.text(term)
+			continue
+		}
+		values := []string{value}
+		if strings.HasSuffix(m[3], "IN") {
+			values = strings.Split(value, ",")
+		}
+		for j, v := range values {
+			if strings.HasPrefix(v, "@") {
+				values[j] = s.domain(v)
+			} else {
+				values[j] = s.field(field, v)
+			}
+		}
+		terms[i] = m[1] + field + m[3] + strings.Join(values, ",")
+	}
+	return strings.Join(terms, "^")
+}
+
+// url rewrites the host of a URL and sanitizes its query.
+func (s *sanitizer) url(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return s.text(raw)
+	}
+	if s.host != "" && u.Host == s.host {
+		u.Host = instanceHost
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = url.Values(s.query(u.Query())).Encode()
+	}
+	return u.String()
+}
+
+func (s *sanitizer) link(header string) string {
+	return linkURL.ReplaceAllStringFunc(header, func(m string) string {
+		return "<" + s.url(m[1:len(m)-1]) + ">"
+	})
+}
+
+// isPIIField reports whether field, or the field it dot-walks to, holds
+// PII. Custom fields are assumed to: what they hold is up to each instance.
+func (s *sanitizer) isPIIField(field string) bool {
+	if field == "" {
+		return false
+	}
+	if s.customFields[field] {
+		return true
+	}
+	for _, part := range strings.Split(field, ".") {
+		if strings.HasPrefix(part, "u_") || s.customFields[part] {
+			return true
+		}
+	}
+	return piiFields[field[strings.LastIndex(field, ".")+1:]]
+}
+
+// body sanitizes a JSON body. A body that isn't JSON (an HTML error page,
+// say) is kept only as a redacted placeholder string, since nothing can be
+// said about what it contains.
+func (s *sanitizer) body(data []byte) json.RawMessage {
+	if len(data) == 0 {
+		return nil
+	}
+	// UseNumber keeps numbers exactly as sent rather than as float64.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		out, _ := json.Marshal(s.pseudonym("redacted-non-json-", string(data)))
+		return out
+	}
+	out, err := json.Marshal(s.value("", v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (s *sanitizer) value(field string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		// A reference reads {link, value, display_value}, and any field
+		// read with sysparm_display_value=all {value, display_value}. A
+		// reference's display value is the referenced record's name, so
+		// it's redacted whatever field it's under.
+		_, reference := v["link"]
+		for k, item := range v {
+			switch {
+			case k == "display_value" && (reference || s.isPIIField(field)):
+				v[k] = s.redact(item)
+			case k == "value" && s.isPIIField(field):
+				v[k] = s.value(field, item)
+			default:
+				v[k] = s.value(k, item)
+			}
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = s.value(field, item)
+		}
+		return v
+	case string:
+		return s.field(field, v)
+	default:
+		return v
+	}
+}
+
+func (s *sanitizer) redact(v any) any {
+	str, ok := v.(string)
+	if !ok || str == "" {
+		return v
+	}
+	return s.pseudonym("redacted-", str)
+}
+
+func (s *sanitizer) field(field string, v string) string {
+	switch {
+	case v == "":
+		return v
+	case field == "email" || strings.HasSuffix(field, ".email"):
+		return s.email(v)
+	case s.isPIIField(field):
+		return s.pseudonym("redacted-", v)
+	case field == "body":
+		// Batch API requests and responses carry their sub-requests'
+		// bodies base64-encoded, and their URLs in the clear.
+		return s.batchBody(v)
+	case field == "url" || field == "link":
+		return s.url(v)
+	default:
+		return s.text(v)
+	}
+}
+
+func (s *sanitizer) batchBody(v string) string {
+	decoded, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return s.text(v)
+	}
+	return base64.StdEncoding.EncodeToString(s.body(decoded))
+}
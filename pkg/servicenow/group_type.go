@@ -0,0 +1,54 @@
+package servicenow
+
+import (
+	"context"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+const GroupTypesBaseUrl = TableAPIBaseURL + "/sys_user_group_type"
+
+var GroupTypeFields = []string{"sys_id", "name"}
+
+// AnyGroupType in ProvisionableGroupTypes makes groups of every type
+// provisionable.
+const AnyGroupType = "*"
+
+// WithProvisionableGroupTypes lists the group types, by name, whose groups
+// the connector may add members to. Groups without a type are always
+// provisionable; a group with types is provisionable only when all of them
+// are listed. Without this option every type is (AnyGroupType), as before
+// group types were checked; an empty list keeps the connector out of every
+// typed group, such as the itil and catalog assignment groups that route
+// tickets.
+func WithProvisionableGroupTypes(types []string) ClientOption {
+	return func(c *Client) {
+		c.ProvisionableGroupTypes = types
+	}
+}
+
+// GroupTypesProvisionable reports whether a group with the named types may
+// have members added (see WithProvisionableGroupTypes).
+func (c *Client) GroupTypesProvisionable(typeNames []string) bool {
+	allowed := make(map[string]bool, len(c.ProvisionableGroupTypes))
+	for _, name := range c.ProvisionableGroupTypes {
+		allowed[strings.TrimSpace(name)] = true
+	}
+	if allowed[AnyGroupType] {
+		return true
+	}
+	for _, name := range typeNames {
+		if !allowed[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetGroupTypes lists sys_user_group_type.
+func (c *Client) GetGroupTypes(ctx context.Context, paginationVars KeysetPaginationVars) ([]GroupType, string, annotations.Annotations, error) {
+	return getKeysetPage(ctx, c, c.apiURL(GroupTypesBaseUrl, c.deployment),
+		&FilterVars{Fields: GroupTypeFields}, &paginationVars,
+		func(t GroupType) string { return t.Id })
+}
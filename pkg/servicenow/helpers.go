@@ -21,6 +21,18 @@ func GenerateURL(baseURL string, params URLParams) (string, error) {
 	return urlBuilder.String(), nil
 }
 
+// ListIDs splits a glide_list value, such as sys_user_group's type or
+// user_criteria's user, into its sys_ids.
+func ListIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func ConvertPageToken(token string) (int, error) {
 	if token == "" {
 		return 0, nil
@@ -0,0 +1,82 @@
+package servicenow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// HR Service Delivery ships as the sn_hr_core plugin and its siblings. Its
+// roles are named after their scope (sn_hr_core.case_reader,
+// sn_hr_le.admin, ...), and every instance with the plugin has HR profiles,
+// so sn_hr_core_profile tells whether it's installed.
+const (
+	HRProfilesTable = "sn_hr_core_profile"
+	HRRolePrefix    = "sn_hr"
+)
+
+// WithHRSD turns on syncing HR roles and the groups that hold them. On an
+// instance without HR Service Delivery they're skipped, not an error.
+func WithHRSD(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncHRSD = enabled
+	}
+}
+
+// HRSDInstalled reports whether the instance has HR Service Delivery: the
+// Table API answers 400 (invalid table) or 404 for a table whose plugin
+// isn't installed. Any other failure, such as a 403 from an ACL, is an
+// error. The answer is kept for the client's lifetime.
+func (c *Client) HRSDInstalled(ctx context.Context) (bool, annotations.Annotations, error) {
+	c.hrsdMu.Lock()
+	defer c.hrsdMu.Unlock()
+	if c.hrsdInstalled != nil {
+		return *c.hrsdInstalled, nil, nil
+	}
+
+	annos, err := c.ProbeTableRead(ctx, HRProfilesTable)
+	var respErr *responseError
+	if errors.As(err, &respErr) && (respErr.statusCode == http.StatusBadRequest || respErr.statusCode == http.StatusNotFound) {
+		installed := false
+		c.hrsdInstalled = &installed
+		return false, annos, nil
+	}
+	if err != nil {
+		return false, annos, err
+	}
+	installed := true
+	c.hrsdInstalled = &installed
+	return true, annos, nil
+}
+
+// GetHRRoles lists the HR Service Delivery roles, grantable or not: the
+// restricted roles that open HR cases and profiles are often not grantable,
+// and they're the ones worth reviewing.
+func (c *Client) GetHRRoles(ctx context.Context, paginationVars KeysetPaginationVars) ([]Role, string, annotations.Annotations, error) {
+	query, err := NewQuery().Where("name", OpStartsWith, HRRolePrefix).Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(RolesBaseUrl, c.deployment),
+		&FilterVars{Fields: RoleFields, Query: query}, &paginationVars,
+		func(r Role) string { return r.Id })
+}
+
+// GetHRGroupRoles lists the sys_group_has_role rows of HR roles, scoped to
+// the configured domain and group filter like GetGroupToRole.
+func (c *Client) GetHRGroupRoles(ctx context.Context, paginationVars KeysetPaginationVars) ([]HRGroupRole, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	query, err := NewQuery().Where("role.name", OpStartsWith, HRRolePrefix).And(groupToRoleQuery("", "", sysDomains, c.Filters.Group)).Build()
+	if err != nil {
+		return nil, "", annos, err
+	}
+	rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(GroupRolesBaseUrl, c.deployment),
+		&FilterVars{Fields: []string{"sys_id", "group", "role", "role.name"}, Query: query}, &paginationVars,
+		func(r HRGroupRole) string { return r.Id })
+	return rows, next, append(pageAnnos, annos...), err
+}
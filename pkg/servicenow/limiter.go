@@ -0,0 +1,108 @@
+package servicenow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+)
+
+// DefaultMaxConcurrentRequests bounds how many requests a Client has in
+// flight to its instance at once. ServiceNow rate limits per user across
+// all of that user's sessions, so more parallelism mostly moves the wait
+// from round-trips to 429s.
+const DefaultMaxConcurrentRequests = 4
+
+// WithMaxConcurrentRequests replaces DefaultMaxConcurrentRequests. 1 makes
+// every request wait for the previous one, the way the client behaved
+// before requests could overlap.
+func WithMaxConcurrentRequests(n int) ClientOption {
+	return func(c *Client) {
+		c.maxConcurrentRequests = n
+	}
+}
+
+// requestLimiter is the per-instance semaphore every request of a Client
+// goes through -- listings, prefetched pages and writes alike -- so
+// fanning out can't exceed the configured limit however many callers
+// share the Client. It also reads the rate-limit description doHTTPRequest
+// collects from each response: once the instance reports no requests
+// remaining, new requests hold off until its reset time rather than
+// spending the rest of the window on 429s.
+type requestLimiter struct {
+	slots    chan struct{}
+	maxPause time.Duration
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+func newRequestLimiter(n int, maxPause time.Duration) (*requestLimiter, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid max concurrent requests %d: must be at least 1", n)
+	}
+	return &requestLimiter{
+		slots:    make(chan struct{}, n),
+		maxPause: maxPause,
+	}, nil
+}
+
+// acquire takes a slot, then waits out any rate-limit pause. The slot is
+// held while waiting: every other request would have to wait too.
+func (l *requestLimiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for {
+		l.mu.Lock()
+		wait := time.Until(l.pausedUntil)
+		l.mu.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			// The pause may have been extended meanwhile; check again.
+		case <-ctx.Done():
+			timer.Stop()
+			<-l.slots
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot taken by acquire, pausing the instance's requests
+// when rl says none remain. uhttp makes up a reset a minute out for a 429
+// that named none, so a pause also needs the response's own Retry-After or
+// X-RateLimit-Reset: without one, the retry backoff alone decides the wait.
+func (l *requestLimiter) release(rl *v2.RateLimitDescription, header http.Header) {
+	defer func() { <-l.slots }()
+
+	if rl.GetResetAt() == nil || rl.GetRemaining() > 0 ||
+		(rl.GetLimit() <= 0 && rl.GetStatus() != v2.RateLimitDescription_STATUS_OVERLIMIT) {
+		return
+	}
+	if _, named := serverRetryDelay(header, time.Now()); !named {
+		return
+	}
+	// The reset time is capped like a retry delay: a clock skewed against
+	// the instance's must not stall the sync for longer than a retry would.
+	until := rl.GetResetAt().AsTime()
+	if limit := time.Now().Add(l.maxPause); until.After(limit) {
+		until = limit
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
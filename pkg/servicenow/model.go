@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
@@ -27,6 +28,7 @@ type User struct {
 	UserName     string            `json:"user_name"`
 	Roles        string            `json:"roles"`
 	Active       string            `json:"active"`
+	SysDomain    string            `json:"sys_domain"`
 	CustomFields map[string]string `json:"-"`
 }
 
@@ -66,13 +68,249 @@ type Role struct {
 	BaseResource
 	Name      string `json:"name"`
 	Grantable string `json:"grantable"`
+	SysScope  string `json:"sys_scope"`
 }
 
+// Application is a row of sys_scope: a scoped application. CreatedBy is the
+// user_name of whoever created the record, often admin or system; ServiceNow
+// keeps no owner for an application.
+type Application struct {
+	BaseResource
+	Name             string `json:"name"`
+	Scope            string `json:"scope"`
+	Version          string `json:"version"`
+	Vendor           string `json:"vendor"`
+	ShortDescription string `json:"short_description"`
+	Active           string `json:"active"`
+	Class            string `json:"sys_class_name"`
+	CreatedBy        string `json:"sys_created_by"`
+}
+
+// Group is a row of sys_user_group. Type is a comma-separated list of
+// sys_user_group_type sys_ids; CostCenter is a cmn_cost_center sys_id.
 type Group struct {
 	BaseResource
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Roles          string `json:"roles"`
+	SysDomain      string `json:"sys_domain"`
+	Type           string `json:"type"`
+	Active         string `json:"active"`
+	Email          string `json:"email"`
+	CostCenter     string `json:"cost_center"`
+	CostCenterName string `json:"cost_center.name"`
+}
+
+// GroupType is a row of sys_user_group_type, such as itil or catalog.
+type GroupType struct {
+	BaseResource
+	Name string `json:"name"`
+}
+
+// GroupPayload is the sys_user_group record written on group creation.
+// Manager, Parent and SysDomain are sys_ids; Type is a comma-separated list
+// of sys_user_group_type sys_ids.
+type GroupPayload struct {
 	Name        string `json:"name"`
-	Description string `json:"description"`
-	Roles       string `json:"roles"`
+	Description string `json:"description,omitempty"`
+	Manager     string `json:"manager,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Parent      string `json:"parent,omitempty"`
+	SysDomain   string `json:"sys_domain,omitempty"`
+}
+
+// Subscription is a row of license_details. Purchased and Allocated are
+// counts of user allocations.
+type Subscription struct {
+	BaseResource
+	Name      string `json:"name"`
+	Purchased string `json:"count"`
+	Allocated string `json:"allocated"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// SubscriptionUser is a row of license_has_user: a user's allocation of a
+// subscription.
+type SubscriptionUser struct {
+	BaseResource
+	License string `json:"license"`
+	User    string `json:"user"`
+}
+
+// Delegation is a row of sys_user_delegate. Starts and Ends are UTC
+// GlideDateTimes ("2006-01-02 15:04:05"); an empty Ends never expires.
+type Delegation struct {
+	BaseResource
+	User          string `json:"user"`
+	Delegate      string `json:"delegate"`
+	Starts        string `json:"starts"`
+	Ends          string `json:"ends"`
+	Approvals     string `json:"approvals"`
+	Assignments   string `json:"assignments"`
+	Notifications string `json:"notifications"`
+	Invitations   string `json:"invitations"`
+}
+
+// Expired reports whether the delegation ended before now (see endedBefore).
+func (d *Delegation) Expired(now time.Time) bool {
+	return endedBefore(d.Ends, now)
+}
+
+// endedBefore reports whether a UTC GlideDateTime end is before now. An end
+// that's empty or doesn't parse counts as not ended: the row is still synced
+// rather than silently dropped.
+func endedBefore(end string, now time.Time) bool {
+	if end == "" {
+		return false
+	}
+	t, err := time.Parse(time.DateTime, end)
+	return err == nil && t.Before(now)
+}
+
+// DelegationPayload is the sys_user_delegate record a grant creates. The
+// scope flags are "true" or "false".
+type DelegationPayload struct {
+	User          string `json:"user"`
+	Delegate      string `json:"delegate"`
+	Starts        string `json:"starts"`
+	Ends          string `json:"ends"`
+	Approvals     string `json:"approvals"`
+	Assignments   string `json:"assignments"`
+	Notifications string `json:"notifications"`
+	Invitations   string `json:"invitations"`
+}
+
+// ConfigurationItem is a business application (cmdb_ci_business_app) or
+// service (cmdb_ci_service) CI.
+type ConfigurationItem struct {
+	BaseResource
+	Name                string `json:"name"`
+	Number              string `json:"number"`
+	ShortDescription    string `json:"short_description"`
+	Class               string `json:"sys_class_name"`
+	OwnedBy             string `json:"owned_by"`
+	ManagedBy           string `json:"managed_by"`
+	SupportGroup        string `json:"support_group"`
+	OperationalStatus   string `json:"operational_status"`
+	InstallStatus       string `json:"install_status"`
+	BusinessCriticality string `json:"business_criticality"`
+	UsedFor             string `json:"used_for"`
+	Version             string `json:"version"`
+}
+
+// ACL is a sys_security_acl row. OperationName and TypeName are empty on a
+// release where operation and type are plain choices rather than references.
+type ACL struct {
+	BaseResource
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Active         string `json:"active"`
+	Operation      string `json:"operation"`
+	OperationName  string `json:"operation.name"`
+	Type           string `json:"type"`
+	TypeName       string `json:"type.name"`
+	Condition      string `json:"condition"`
+	Advanced       string `json:"advanced"`
+	AdminOverrides string `json:"admin_overrides"`
+}
+
+// Op is the operation the ACL guards, such as read or write.
+func (a ACL) Op() string {
+	if a.OperationName != "" {
+		return a.OperationName
+	}
+	return a.Operation
+}
+
+// Kind is the ACL's type, such as record.
+func (a ACL) Kind() string {
+	if a.TypeName != "" {
+		return a.TypeName
+	}
+	return a.Type
+}
+
+// TableAndField splits a record ACL's name into the table and the field it
+// guards; field is empty for a table-level ACL and "*" for every field.
+func (a ACL) TableAndField() (table string, field string) {
+	table, field, _ = strings.Cut(a.Name, ".")
+	return table, field
+}
+
+// ACLRole is a sys_security_acl_role row: acl requires role.
+type ACLRole struct {
+	BaseResource
+	ACL      string `json:"sys_security_acl"`
+	Role     string `json:"sys_user_role"`
+	RoleName string `json:"sys_user_role.name"`
+}
+
+// GrantExpiry is a row of the grant expiry table (see WithGrantExpiry):
+// user's membership of target in table ends at expires.
+type GrantExpiry struct {
+	BaseResource
+	Table   string `json:"u_table"`
+	User    string `json:"u_user"`
+	Target  string `json:"u_target"`
+	Expires string `json:"u_expires"`
+}
+
+// Expired reports whether the grant expired before now (see endedBefore).
+func (e *GrantExpiry) Expired(now time.Time) bool {
+	return endedBefore(e.Expires, now)
+}
+
+type GrantExpiryPayload struct {
+	Table   string `json:"u_table"`
+	User    string `json:"u_user"`
+	Target  string `json:"u_target"`
+	Expires string `json:"u_expires"`
+}
+
+// UserCriteria is a row of user_criteria. User, Group, Role, Department,
+// Company and Location are comma-separated sys_ids.
+type UserCriteria struct {
+	BaseResource
+	Name       string `json:"name"`
+	Active     string `json:"active"`
+	User       string `json:"user"`
+	Group      string `json:"group"`
+	Role       string `json:"role"`
+	Department string `json:"department"`
+	Company    string `json:"company"`
+	Location   string `json:"location"`
+	MatchAll   string `json:"match_all"`
+	Advanced   string `json:"advanced"`
+}
+
+// UserCriteriaLink is a row of one of the tables that apply user criteria
+// to a knowledge base or a catalog item; only one of the two is set.
+type UserCriteriaLink struct {
+	BaseResource
+	UserCriteria      string `json:"user_criteria"`
+	KnowledgeBase     string `json:"kb_knowledge_base"`
+	KnowledgeBaseName string `json:"kb_knowledge_base.title"`
+	CatalogItem       string `json:"sc_cat_item"`
+	CatalogItemName   string `json:"sc_cat_item.name"`
+}
+
+// TargetName is the name of the knowledge base or catalog item, or its
+// sys_id when the name couldn't be read.
+func (l UserCriteriaLink) TargetName() string {
+	for _, name := range []string{l.KnowledgeBaseName, l.CatalogItemName, l.KnowledgeBase, l.CatalogItem} {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Domain is a row of the domain table.
+type Domain struct {
+	BaseResource
+	Name   string `json:"name"`
+	Parent string `json:"parent"`
 }
 
 type GroupMember struct {
@@ -93,6 +331,33 @@ type UserToRole struct {
 	Role      string `json:"role"`
 }
 
+// EffectiveRole is a sys_user_has_role row read for its inheritance path
+// (see GetEffectiveRoles). The names are dot-walked and empty when the
+// account can't read the referenced record.
+type EffectiveRole struct {
+	BaseResource
+	Role           string `json:"role"`
+	RoleName       string `json:"role.name"`
+	Inherited      string `json:"inherited"`
+	GrantedBy      string `json:"granted_by"`
+	GrantedByName  string `json:"granted_by.name"`
+	IncludedIn     string `json:"included_in_role"`
+	IncludedInName string `json:"included_in_role.name"`
+}
+
+// Path says how the role is held: contained in another role (which may
+// itself come from a group), through a group, or assigned directly.
+func (r EffectiveRole) Path() string {
+	switch {
+	case r.IncludedIn != "":
+		return RolePathRole
+	case r.GrantedBy != "" || r.Inherited == "true":
+		return RolePathGroup
+	default:
+		return RolePathDirect
+	}
+}
+
 type UserToRolePayload struct {
 	User string `json:"user"`
 	Role string `json:"role"`
@@ -105,11 +370,30 @@ type GroupToRole struct {
 	Role     string `json:"role"`
 }
 
+// HRGroupRole is a sys_group_has_role row of an HR role, with the role's
+// name.
+type HRGroupRole struct {
+	BaseResource
+	Group    string `json:"group"`
+	Role     string `json:"role"`
+	RoleName string `json:"role.name"`
+}
+
 type GroupToRolePayload struct {
 	Group string `json:"group"`
 	Role  string `json:"role"`
 }
 
+// DictionaryEntry is a sys_dictionary row: the definition of one column.
+type DictionaryEntry struct {
+	BaseResource
+	Table        string `json:"name"`
+	Element      string `json:"element"`
+	InternalType string `json:"internal_type"`
+	ReadOnly     string `json:"read_only"`
+	Active       string `json:"active"`
+}
+
 // TODO(lauren) remove unecessary fields.
 // Service Catalog request models.
 type ResourceRefLink struct {
@@ -0,0 +1,67 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// ProbeTableRead reads at most one row of table, to tell whether the
+// account can read it at all. A table-level read ACL that denies the account
+// fails with 403; one that only hides rows doesn't, and isn't detectable
+// this way.
+func (c *Client) ProbeTableRead(ctx context.Context, table string) (annotations.Annotations, error) {
+	var response ListResponse[BaseResource]
+
+	_, annos, err := c.get(
+		ctx,
+		c.apiURL(TableAPIBaseURL+"/%s", c.deployment, table),
+		&response,
+		WithPageLimit(1),
+		WithFields("sys_id"),
+	)
+	return annos, err
+}
+
+// GetAccountRoles lists the roles the account the client authenticates as
+// holds, directly or inherited.
+func (c *Client) GetAccountRoles(ctx context.Context, paginationVars KeysetPaginationVars) ([]EffectiveRole, string, annotations.Annotations, error) {
+	query, err := NewQuery().IsCurrentUser("user").Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(UserRolesBaseUrl, c.deployment),
+		&FilterVars{Fields: []string{"sys_id", "role", "role.name"}, Query: query}, &paginationVars,
+		func(r EffectiveRole) string { return r.Id })
+}
+
+// GetTableACLs lists the active record ACLs named one of tables that guard
+// one of operations: the rules a write to those tables' rows has to pass.
+// Include "*" in tables for the ACLs that apply to tables without their own.
+func (c *Client) GetTableACLs(ctx context.Context, tables []string, operations []string, paginationVars KeysetPaginationVars) ([]ACL, string, annotations.Annotations, error) {
+	query, err := NewQuery().
+		Equals("active", "true").
+		Equals("type.name", "record").
+		In("name", tables...).
+		In("operation.name", operations...).
+		Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(TableAPIBaseURL+"/%s", c.deployment, ACLTable),
+		&FilterVars{Fields: ACLFields, Query: query}, &paginationVars,
+		func(a ACL) string { return a.Id })
+}
+
+// GetRolesOfACLs lists the roles acls require. Unlike GetACLRoles it keeps
+// roles that aren't grantable or are filtered out of a sync: holding any of
+// them passes the ACL.
+func (c *Client) GetRolesOfACLs(ctx context.Context, acls []string, paginationVars KeysetPaginationVars) ([]ACLRole, string, annotations.Annotations, error) {
+	query, err := NewQuery().In("sys_security_acl", acls...).Build()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return getKeysetPage(ctx, c, c.apiURL(TableAPIBaseURL+"/%s", c.deployment, ACLRoleTable),
+		&FilterVars{Fields: []string{"sys_id", "sys_security_acl", "sys_user_role", "sys_user_role.name"}, Query: query}, &paginationVars,
+		func(r ACLRole) string { return r.Id })
+}
@@ -0,0 +1,275 @@
+package servicenow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operator is an encoded-query comparison operator.
+type Operator string
+
+const (
+	OpEquals         Operator = "="
+	OpNotEquals      Operator = "!="
+	OpGreaterThan    Operator = ">"
+	OpGreaterOrEqual Operator = ">="
+	OpLessThan       Operator = "<"
+	OpLessOrEqual    Operator = "<="
+	OpStartsWith     Operator = "STARTSWITH"
+	OpEndsWith       Operator = "ENDSWITH"
+	OpLike           Operator = "LIKE"
+	OpNotLike        Operator = "NOT LIKE"
+)
+
+// fieldNamePattern is a column, or a dot-walk through references to one.
+// ServiceNow column names are lowercase, which keeps a field from ever
+// reading as one of the uppercase keywords (NQ, ORDERBY, ...).
+const fieldNamePattern = `[a-z][a-z0-9_]*(?:\.[a-z][a-z0-9_]*)*`
+
+var fieldNameRegexp = regexp.MustCompile(`^` + fieldNamePattern + `$`)
+
+// currentUserValue is the one script value queries may use: ServiceNow
+// resolves it to the authenticated user's sys_id.
+const currentUserValue = "javascript:gs.getUserID()"
+
+// Query builds a sysparm_query encoded query. Conditions are ANDed in the
+// order they're added; AnyOf adds an OR group. The zero value is the empty
+// query.
+//
+// Encoded queries have no escaping that ServiceNow applies consistently,
+// so values that can't be placed in a condition verbatim are rejected, not
+// escaped: a ^ would end the condition (and let the rest of the value add
+// conditions of its own, or an ORDERBY or NQ), a comma would split an IN
+// list, and a javascript: value is evaluated server-side. The first such
+// value makes Build fail.
+type Query struct {
+	terms   []string
+	orderBy []string
+	err     error
+}
+
+// NewQuery returns an empty query.
+func NewQuery() *Query {
+	return &Query{}
+}
+
+// Where ANDs "field<op>value".
+func (q *Query) Where(field string, op Operator, value string) *Query {
+	if term, ok := q.condition(field, op, value); ok {
+		q.terms = append(q.terms, term)
+	}
+	return q
+}
+
+// Equals ANDs "field=value".
+func (q *Query) Equals(field string, value string) *Query {
+	return q.Where(field, OpEquals, value)
+}
+
+// AnyOf ANDs an OR group matching field against any of values, e.g.
+// "emailENDSWITH@a.com^ORemailENDSWITH@b.com". OR binds tighter than AND in
+// an encoded query, so the group needs no parentheses. No values adds
+// nothing.
+func (q *Query) AnyOf(field string, op Operator, values ...string) *Query {
+	terms := make([]string, 0, len(values))
+	for _, value := range values {
+		term, ok := q.condition(field, op, value)
+		if !ok {
+			return q
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) > 0 {
+		q.terms = append(q.terms, strings.Join(terms, "^OR"))
+	}
+	return q
+}
+
+// In ANDs "fieldINv1,v2,...". An empty list is an error: whether it
+// matches everything or nothing isn't something to leave to the instance.
+func (q *Query) In(field string, values ...string) *Query {
+	return q.list(field, "IN", values)
+}
+
+// NotIn ANDs "fieldNOT INv1,v2,...".
+func (q *Query) NotIn(field string, values ...string) *Query {
+	return q.list(field, "NOT IN", values)
+}
+
+// IsCurrentUser ANDs "field=javascript:gs.getUserID()", matching the user
+// the client authenticates as.
+func (q *Query) IsCurrentUser(field string) *Query {
+	if q.checkField(field) {
+		q.terms = append(q.terms, field+"="+currentUserValue)
+	}
+	return q
+}
+
+// Filter ANDs an operator-supplied encoded query (see QueryFilters),
+// rejecting anything outside parseFilterQuery's grammar.
+func (q *Query) Filter(filter string) *Query {
+	return q.FilterVia("", filter)
+}
+
+// FilterVia ANDs filter with every field reached through reference, e.g.
+// ("user", "active=true") adds "user.active=true", so a sys_user filter can
+// scope sys_user_grmember rows.
+func (q *Query) FilterVia(reference string, filter string) *Query {
+	if q.err != nil {
+		return q
+	}
+	if reference != "" && !q.checkField(reference) {
+		return q
+	}
+	conditions, err := parseFilterQuery(filter)
+	if err != nil {
+		q.err = fmt.Errorf("encoded query: %w", err)
+		return q
+	}
+
+	for _, cond := range conditions {
+		var b strings.Builder
+		if cond.or {
+			b.WriteString("OR")
+		}
+		if reference != "" {
+			b.WriteString(reference)
+			b.WriteString(".")
+		}
+		b.WriteString(cond.field)
+		b.WriteString(cond.op)
+		b.WriteString(cond.value)
+		q.terms = append(q.terms, b.String())
+	}
+	return q
+}
+
+// And ANDs every condition of other. Its ordering is dropped; only this
+// query's applies.
+func (q *Query) And(other *Query) *Query {
+	if q.err != nil {
+		return q
+	}
+	if other.err != nil {
+		q.err = other.err
+		return q
+	}
+	q.terms = append(q.terms, other.terms...)
+	return q
+}
+
+// Union ORs other onto this query as a whole ("^NQ"): rows matching either
+// are returned. Ordering added to either applies to the result.
+func (q *Query) Union(other *Query) *Query {
+	if q.err != nil {
+		return q
+	}
+	if other.err != nil {
+		q.err = other.err
+		return q
+	}
+	if len(other.terms) == 0 {
+		return q
+	}
+	joined := strings.Join(other.terms, "^")
+	if len(q.terms) > 0 {
+		joined = "NQ" + joined
+	}
+	q.terms = append(q.terms, joined)
+	q.orderBy = append(q.orderBy, other.orderBy...)
+	return q
+}
+
+// OrderBy sorts ascending by field, after any ordering added before it.
+func (q *Query) OrderBy(field string) *Query {
+	if q.checkField(field) {
+		q.orderBy = append(q.orderBy, "ORDERBY"+field)
+	}
+	return q
+}
+
+// OrderByDesc sorts descending by field.
+func (q *Query) OrderByDesc(field string) *Query {
+	if q.checkField(field) {
+		q.orderBy = append(q.orderBy, "ORDERBYDESC"+field)
+	}
+	return q
+}
+
+// Build returns the encoded query, or the first invalid field or value
+// added to it.
+func (q *Query) Build() (string, error) {
+	if q.err != nil {
+		return "", q.err
+	}
+	return strings.Join(append(append([]string(nil), q.terms...), q.orderBy...), "^"), nil
+}
+
+func (q *Query) condition(field string, op Operator, value string) (string, bool) {
+	if !q.checkField(field) {
+		return "", false
+	}
+	switch op {
+	case OpEquals, OpNotEquals, OpGreaterThan, OpGreaterOrEqual, OpLessThan, OpLessOrEqual,
+		OpStartsWith, OpEndsWith, OpLike, OpNotLike:
+	default:
+		q.err = fmt.Errorf("encoded query: unsupported operator %q for %s", op, field)
+		return "", false
+	}
+	if err := checkQueryValue(value, ""); err != nil {
+		q.err = fmt.Errorf("encoded query: %s: %w", field, err)
+		return "", false
+	}
+	return field + string(op) + value, true
+}
+
+func (q *Query) list(field string, op string, values []string) *Query {
+	if !q.checkField(field) {
+		return q
+	}
+	if len(values) == 0 {
+		q.err = fmt.Errorf("encoded query: %s%s needs at least one value", field, op)
+		return q
+	}
+	for _, value := range values {
+		if value == "" {
+			q.err = fmt.Errorf("encoded query: %s%s has an empty value", field, op)
+			return q
+		}
+		if err := checkQueryValue(value, ","); err != nil {
+			q.err = fmt.Errorf("encoded query: %s%s: %w", field, op, err)
+			return q
+		}
+	}
+	q.terms = append(q.terms, field+op+strings.Join(values, ","))
+	return q
+}
+
+func (q *Query) checkField(field string) bool {
+	if q.err != nil {
+		return false
+	}
+	if !fieldNameRegexp.MatchString(field) {
+		q.err = fmt.Errorf("encoded query: invalid field name %q", field)
+		return false
+	}
+	return true
+}
+
+// checkQueryValue rejects a value that can't appear verbatim in a
+// condition; also lists characters that are unsafe in this position.
+func checkQueryValue(value string, also string) error {
+	if i := strings.IndexAny(value, "^"+also); i >= 0 {
+		return fmt.Errorf("value %q contains %q", value, value[i])
+	}
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("value %q contains a control character", value)
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "javascript:") {
+		return fmt.Errorf("value %q is a script", value)
+	}
+	return nil
+}
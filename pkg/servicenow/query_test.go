@@ -0,0 +1,98 @@
+package servicenow
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+)
+
+func TestQueryBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		want  string
+	}{
+		{"empty", NewQuery(), ""},
+		{"conditions are ANDed in order", NewQuery().Equals("active", "true").Where("sys_id", OpGreaterThan, "abc"), "active=true^sys_id>abc"},
+		{"AnyOf is an OR group", NewQuery().Equals("role", "R1").AnyOf("user.email", OpEndsWith, "@a.com", "@b.com"), "role=R1^user.emailENDSWITH@a.com^ORuser.emailENDSWITH@b.com"},
+		{"AnyOf with no values adds nothing", NewQuery().AnyOf("sys_id", OpEquals), ""},
+		{"IN and NOT IN lists", NewQuery().In("element", "email", "title").NotIn("sys_id", "x"), "elementINemail,title^sys_idNOT INx"},
+		{"ordering goes last", NewQuery().OrderBy("sys_id").Equals("active", "true").OrderByDesc("name"), "active=true^ORDERBYsys_id^ORDERBYDESCname"},
+		{"current user", NewQuery().IsCurrentUser("user").In("role.name", "admin"), "user=javascript:gs.getUserID()^role.nameINadmin"},
+		{"filters are validated and dot-walked", NewQuery().Equals("group", "G1").FilterVia("user", "active=true^ORlocked_out=false"), "group=G1^user.active=true^ORuser.locked_out=false"},
+		{"Union starts a new query", NewQuery().Equals("a", "1").Union(NewQuery().Equals("b", "2")).OrderBy("sys_id"), "a=1^NQb=2^ORDERBYsys_id"},
+		{"And merges another query's conditions", NewQuery().Equals("a", "1").And(NewQuery().Equals("b", "2")), "a=1^b=2"},
+		{"commas and equals signs are fine outside lists", NewQuery().Equals("name", "on,boarding=yes"), "name=on,boarding=yes"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.query.Build()
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Build() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// A value that would end its condition, split its list or run as a script is
+// refused rather than sent, and the first one wins over anything after it.
+func TestQueryRejectsUnsafeValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+	}{
+		{"caret in a value", NewQuery().Equals("name", "x^NQactive=false")},
+		{"caret in an OR group", NewQuery().AnyOf("sys_id", OpEquals, "a", "b^ORDERBYname")},
+		{"comma in a list value", NewQuery().In("variable_set", "a,b")},
+		{"empty list", NewQuery().In("question")},
+		{"empty list value", NewQuery().In("question", "a", "")},
+		{"control character", NewQuery().Equals("name", "a\nb")},
+		{"script value", NewQuery().Equals("user", " JavaScript:gs.getUserID()")},
+		{"invalid field", NewQuery().Equals("NQname", "x")},
+		{"invalid dot-walk reference", NewQuery().FilterVia("User", "active=true")},
+		{"invalid filter", NewQuery().Filter("active=true^NQactive=false")},
+		{"unsupported operator", NewQuery().Where("name", Operator("ORDERBY"), "x")},
+		{"error carried through And", NewQuery().And(NewQuery().Equals("name", "^"))},
+		{"first error wins", NewQuery().Equals("name", "a^b").Equals("active", "true")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := tc.query.Build(); err == nil {
+				t.Errorf("Build() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestGetLabelRejectsUnsafeNameWithoutARequest(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":[]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(uhttp.NewBaseHttpClient(server.Client()), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil, server.URL)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if _, _, err := client.GetLabel(context.Background(), "onboarding^NQname=admin"); err == nil {
+		t.Error("expected a label with a ^ to be rejected")
+	}
+	if _, err := client.AddLabelsToRequest(context.Background(), "RITM1", []string{"ok", "bad^one"}); err == nil {
+		t.Error("expected AddLabelsToRequest to reject a label with a ^")
+	}
+	if requests != 0 {
+		t.Errorf("%d requests were sent with an unsafe label", requests)
+	}
+}
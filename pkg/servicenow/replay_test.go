@@ -0,0 +1,72 @@
+package servicenow
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/uhttp"
+	"github.com/conductorone/baton-servicenow/pkg/servicenow/fixture"
+)
+
+// replayClient returns a client answered by the fixtures recorded in
+// testdata/fixtures/<name> (see pkg/servicenow/fixture).
+func replayClient(t *testing.T, name string) (*Client, *fixture.Replayer) {
+	t.Helper()
+	replayer, err := fixture.LoadReplayer("testdata/fixtures/" + name)
+	if err != nil {
+		t.Fatalf("loading fixtures: %v", err)
+	}
+	c, err := NewClient(uhttp.NewBaseHttpClient(&http.Client{Transport: replayer}), "Basic dGVzdDp0ZXN0", "dev0", nil, nil, nil,
+		"https://instance.service-now.com/api", WithRetryPolicy(RetryPolicy{}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return c, replayer
+}
+
+// The role listing of an instance with mixed-case and non-hex sys_ids, and
+// an ACL-emptied window after one of them: every id must come back exactly
+// once, and each cursor must be sent with the case it was read with.
+func TestGetRoles_ReplaysMixedCaseSysIDs(t *testing.T) {
+	c, replayer := replayClient(t, "mixed-case-role-ids")
+
+	var ids []string
+	vars := KeysetPaginationVars{Limit: 2}
+	for {
+		roles, next, _, err := c.GetRoles(context.Background(), vars)
+		if err != nil {
+			t.Fatalf("GetRoles: %v", err)
+		}
+		for _, role := range roles {
+			ids = append(ids, role.Id)
+		}
+		if next == "" {
+			break
+		}
+		lastID, offset, err := ParseKeysetToken(next)
+		if err != nil {
+			t.Fatalf("ParseKeysetToken(%q): %v", next, err)
+		}
+		vars = KeysetPaginationVars{Limit: 2, LastID: lastID, Offset: offset}
+	}
+
+	want := "0c5f3cece0a2010e8d9bbe8a2b2f1a56,Glean_User_Role,Glean_User_Role2,a7e8d0f1c0a8016400bd6c1a3b9e0d8A,z2b3"
+	if got := strings.Join(ids, ","); got != want {
+		t.Errorf("role ids = %s, want %s", got, want)
+	}
+	if replayer.Remaining() != 0 {
+		t.Errorf("%d recorded requests were never made", replayer.Remaining())
+	}
+
+	queries := replayer.Queries()
+	for i, cursor := range map[int]string{2: "Glean_User_Role", 3: "a7e8d0f1c0a8016400bd6c1a3b9e0d8A", 4: "a7e8d0f1c0a8016400bd6c1a3b9e0d8A"} {
+		if query := queries[i].Get("sysparm_query"); !strings.Contains(query, "sys_id>"+cursor+"^") {
+			t.Errorf("request %d query = %s, want the cursor %s as read", i+1, query, cursor)
+		}
+	}
+	if offset := queries[4].Get("sysparm_offset"); offset != "2" {
+		t.Errorf("request 5 offset = %q, want 2 to step past the emptied window", offset)
+	}
+}
@@ -9,20 +9,21 @@ import (
 )
 
 var (
-	UserFields  = []string{"sys_id", "name", "roles", "user_name", "email", "first_name", "last_name", "active"}
-	RoleFields  = []string{"sys_id", "grantable", "name"}
-	GroupFields = []string{"sys_id", "description", "name"}
-)
-
-func queryMultipleIDs(ids []string) string {
-	var preparedIDs []string
-
-	for _, id := range ids {
-		preparedIDs = append(preparedIDs, fmt.Sprintf("sys_id=%s", id))
+	UserFields  = []string{"sys_id", "name", "roles", "user_name", "email", "first_name", "last_name", "active", "sys_domain"}
+	RoleFields  = []string{"sys_id", "grantable", "name", "sys_scope"}
+	GroupFields = []string{"sys_id", "description", "name", "sys_domain", "type", "active", "email", "cost_center", "cost_center.name"}
+
+	// UpdatableUserFields are the standard sys_user columns the
+	// update_user_profile action may write. Configured custom (u_) fields
+	// are allowed on top of these. Identity columns like user_name and
+	// security columns like locked_out, user_password and roles are
+	// deliberately absent.
+	UpdatableUserFields = []string{
+		"email", "first_name", "last_name", "middle_name", "title", "department",
+		"manager", "phone", "mobile_phone", "company", "location", "cost_center",
+		"employee_number", "time_zone",
 	}
-
-	return strings.Join(preparedIDs, "^OR")
-}
+)
 
 var emptyOpt = func(_ *http.Request) {}
 
@@ -130,30 +131,38 @@ func cappedForDomainFilter(userId string, domains []string, vars KeysetPaginatio
 // seek condition onto sysparm_query (must run after filterToReqOptions), and
 // carries the skip offset. X-Total-Count is left on: nextSkipToken needs it to
 // tell an ACL-emptied window from the end of the table.
-func keysetPaginationVarsToReqOptions(vars *KeysetPaginationVars) []ReqOpt {
+func keysetPaginationVarsToReqOptions(vars *KeysetPaginationVars) ([]ReqOpt, error) {
+	cursor, err := keysetCursorFragment(vars.LastID)
+	if err != nil {
+		return nil, err
+	}
 	reqOpts := make([]ReqOpt, 0, 3)
 	reqOpts = append(reqOpts, WithPageLimit(vars.Limit))
-	reqOpts = append(reqOpts, WithQueryAppend(keysetCursorFragment(vars.LastID)))
+	reqOpts = append(reqOpts, WithQueryAppend(cursor))
 	reqOpts = append(reqOpts, WithOffset(vars.Offset))
-	return reqOpts
+	return reqOpts, nil
 }
 
 // buildKeysetReqOptions composes a filter with keyset pagination in the
 // only valid order: the seek condition must be appended after the filter
 // sets sysparm_query.
-func buildKeysetReqOptions(filterVars *FilterVars, keysetVars *KeysetPaginationVars) []ReqOpt {
-	reqOpts := filterToReqOptions(filterVars)
-	return append(reqOpts, keysetPaginationVarsToReqOptions(keysetVars)...)
+func buildKeysetReqOptions(filterVars *FilterVars, keysetVars *KeysetPaginationVars) ([]ReqOpt, error) {
+	keysetOpts, err := keysetPaginationVarsToReqOptions(keysetVars)
+	if err != nil {
+		return nil, err
+	}
+	return append(filterToReqOptions(filterVars), keysetOpts...), nil
 }
 
 // keysetCursorFragment builds the sysparm_query fragment that seeks past
 // lastID. ORDERBYsys_id is required on every page, including the first,
 // so the cursor stays consistent with how the page is ordered.
-func keysetCursorFragment(lastID string) string {
+func keysetCursorFragment(lastID string) (string, error) {
+	q := NewQuery()
 	if lastID != "" {
-		return fmt.Sprintf("sys_id>%s^ORDERBYsys_id", lastID)
+		q.Where("sys_id", OpGreaterThan, lastID)
 	}
-	return "ORDERBYsys_id"
+	return q.OrderBy("sys_id").Build()
 }
 
 // nextKeysetToken derives the seek cursor from a page that returned rows. Never
@@ -174,9 +183,10 @@ func nextKeysetToken[T any](items []T, idFn func(T) string) (string, error) {
 // human-chosen ids like "glean_user_role", or hex with a stray trailing
 // character. This is widened to admit that real-world variance while still
 // excluding characters (^, =, >, whitespace, quotes, ...) that would let a
-// cursor value escape the sysparm_query fragment it's interpolated into
-// unescaped (see keysetCursorFragment) -- this regex is a query-injection
-// guard, not just a format check.
+// cursor value escape the sysparm_query fragment it's placed in -- this
+// regex is a query-injection guard, not just a format check. Query rejects
+// a ^ in the cursor too (see keysetCursorFragment), but only when the next
+// page is requested, without the row's context.
 const cursorCharset = `[0-9A-Za-z_.\-]{1,32}`
 
 // Matches "cursor" or "cursor:offset". The cursor is optional: the first window
@@ -268,131 +278,209 @@ type FilterVars struct {
 }
 
 // buildDomainQuery builds an OR'd ENDSWITH condition over emailField for
-// each domain (e.g. "emailENDSWITH@a.com^ORemailENDSWITH@b.com"). Returns
-// "" when domains is empty.
-func buildDomainQuery(emailField string, domains []string) string {
-	var queries []string
-
+// each domain (e.g. "emailENDSWITH@a.com^ORemailENDSWITH@b.com"). The query
+// is empty when domains is.
+func buildDomainQuery(emailField string, domains []string) *Query {
+	suffixes := make([]string, 0, len(domains))
 	for _, domain := range domains {
 		d := strings.TrimSpace(strings.ToLower(domain))
 		if d != "" {
-			queries = append(queries, fmt.Sprintf("%sENDSWITH@%s", emailField, d))
+			suffixes = append(suffixes, "@"+d)
 		}
 	}
 
-	return strings.Join(queries, "^OR")
+	return NewQuery().AnyOf(emailField, OpEndsWith, suffixes...)
+}
+
+// sysDomainQuery limits field, a sys_domain column or a dot-walk to one, to
+// sysDomains (see Client.SysDomainScope). The query is empty when sysDomains
+// is, i.e. when no domain is configured.
+func sysDomainQuery(field string, sysDomains []string) *Query {
+	q := NewQuery()
+	if len(sysDomains) > 0 {
+		q.In(field, sysDomains...)
+	}
+	return q
+}
+
+// userQuery is the sys_user listing condition: the allowed-domains
+// condition, the configured domain and the configured user filter.
+func userQuery(domains []string, sysDomains []string, userFilter string) *Query {
+	return buildDomainQuery("email", domains).And(sysDomainQuery("sys_domain", sysDomains)).Filter(userFilter)
 }
 
-func prepareUserFilters(domains []string, customFields []string) *FilterVars {
+// prepareUserFilters builds the sys_user listing filter (see userQuery).
+func prepareUserFilters(domains []string, sysDomains []string, customFields []string, userFilter string) (*FilterVars, error) {
+	query, err := userQuery(domains, sysDomains, userFilter).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &FilterVars{
+		Fields: userFields(customFields),
+		Query:  query,
+	}, nil
+}
+
+// userFields is UserFields plus the configured custom (u_) fields.
+func userFields(customFields []string) []string {
 	fields := UserFields
 	for _, f := range customFields {
 		if strings.HasPrefix(f, "u_") {
 			fields = append(fields, f)
 		}
 	}
+	return fields
+}
 
-	return &FilterVars{
-		Fields: fields,
-		Query:  buildDomainQuery("email", domains),
-	}
+// roleQuery is the sys_user_role listing condition. Only grantable roles
+// are synced; the configured role filter narrows that further.
+func roleQuery(roleFilter string) *Query {
+	return NewQuery().Equals("grantable", "true").Filter(roleFilter)
 }
 
-func prepareRoleFilters() *FilterVars {
+// prepareRoleFilters builds the sys_user_role listing filter (see roleQuery).
+func prepareRoleFilters(roleFilter string) (*FilterVars, error) {
+	query, err := roleQuery(roleFilter).Build()
+	if err != nil {
+		return nil, err
+	}
 	return &FilterVars{
 		Fields: RoleFields,
-		Query:  "grantable=true",
-	}
+		Query:  query,
+	}, nil
 }
 
-func prepareGroupFilters(ids []string) *FilterVars {
-	var query string
+// groupQuery is the sys_user_group listing condition: the configured domain
+// and group filter.
+func groupQuery(sysDomains []string, groupFilter string) *Query {
+	return sysDomainQuery("sys_domain", sysDomains).Filter(groupFilter)
+}
 
-	if ids != nil {
-		query = queryMultipleIDs(ids)
+// prepareGroupFilters builds the sys_user_group listing filter (see
+// groupQuery), narrowed to ids when there are any.
+func prepareGroupFilters(ids []string, sysDomains []string, groupFilter string) (*FilterVars, error) {
+	query, err := NewQuery().AnyOf("sys_id", OpEquals, ids...).And(groupQuery(sysDomains, groupFilter)).Build()
+	if err != nil {
+		return nil, err
 	}
-
 	return &FilterVars{
 		Fields: GroupFields,
 		Query:  query,
-	}
+	}, nil
 }
 
-// prepareUserToGroupFilter builds the sys_user_grmember filter. When userId
-// is empty (enumerating all members, not checking one user for
-// provisioning), it also scopes user.email to the allowed domains, so
+// userToGroupQuery is the sys_user_grmember condition. When userId is empty
+// (enumerating all members, not checking one user for provisioning), it also
+// scopes user.email to the allowed domains, user.sys_domain to the
+// configured domain and dot-walks the configured user filter onto user, so
 // group grants stay consistent with which users actually get synced.
-func prepareUserToGroupFilter(userId string, groupId string, domains []string) *FilterVars {
-	var conditions []string
-
+func userToGroupQuery(userId string, groupId string, domains []string, sysDomains []string, userFilter string) *Query {
+	q := NewQuery()
 	if userId != "" {
-		conditions = append(conditions, fmt.Sprintf("user=%s", userId))
+		q.Equals("user", userId)
 	}
-
 	if groupId != "" {
-		conditions = append(conditions, fmt.Sprintf("group=%s", groupId))
+		q.Equals("group", groupId)
 	}
-
 	if userId == "" {
-		if domainQuery := buildDomainQuery("user.email", domains); domainQuery != "" {
-			conditions = append(conditions, domainQuery)
-		}
+		q.And(buildDomainQuery("user.email", domains)).And(sysDomainQuery("user.sys_domain", sysDomains)).FilterVia("user", userFilter)
 	}
+	return q
+}
 
+// prepareUserToGroupFilter builds the sys_user_grmember filter (see
+// userToGroupQuery).
+func prepareUserToGroupFilter(userId string, groupId string, domains []string, sysDomains []string, userFilter string) (*FilterVars, error) {
+	query, err := userToGroupQuery(userId, groupId, domains, sysDomains, userFilter).Build()
+	if err != nil {
+		return nil, err
+	}
 	return &FilterVars{
 		Fields: []string{
 			"sys_id", "user", "group",
 		},
-		Query: strings.Join(conditions, "^"),
-	}
+		Query: query,
+	}, nil
 }
 
-// prepareUserToRoleFilter builds the sys_user_has_role filter. See
-// prepareUserToGroupFilter for why the domain filter is gated on userId=="".
-func prepareUserToRoleFilter(userId string, roleId string, domains []string) *FilterVars {
-	var conditions []string
+// prepareGroupMembersFilter builds an unscoped sys_user_grmember filter for
+// one group. Unlike prepareUserToGroupFilter it ignores the domain and user
+// filters: deleting a group has to remove every membership, not only the
+// synced ones.
+func prepareGroupMembersFilter(groupId string) (*FilterVars, error) {
+	query, err := NewQuery().Equals("group", groupId).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &FilterVars{
+		Fields: []string{
+			"sys_id", "user", "group",
+		},
+		Query: query,
+	}, nil
+}
 
+// userToRoleQuery is the sys_user_has_role condition. See userToGroupQuery
+// for why the domain and user filters are gated on userId=="".
+func userToRoleQuery(userId string, roleId string, domains []string, sysDomains []string, userFilter string) *Query {
+	q := NewQuery()
 	if userId != "" {
-		conditions = append(conditions, fmt.Sprintf("user=%s", userId))
+		q.Equals("user", userId)
 	}
-
 	if roleId != "" {
-		conditions = append(conditions, fmt.Sprintf("role=%s", roleId))
+		q.Equals("role", roleId)
 	}
-
 	if userId == "" {
-		if domainQuery := buildDomainQuery("user.email", domains); domainQuery != "" {
-			conditions = append(conditions, domainQuery)
-		}
+		q.And(buildDomainQuery("user.email", domains)).And(sysDomainQuery("user.sys_domain", sysDomains)).FilterVia("user", userFilter)
 	}
+	return q
+}
 
+// prepareUserToRoleFilter builds the sys_user_has_role filter (see
+// userToRoleQuery).
+func prepareUserToRoleFilter(userId string, roleId string, domains []string, sysDomains []string, userFilter string) (*FilterVars, error) {
+	query, err := userToRoleQuery(userId, roleId, domains, sysDomains, userFilter).Build()
+	if err != nil {
+		return nil, err
+	}
 	return &FilterVars{
 		Fields: []string{
 			"sys_id", "user", "role", "inherited",
 		},
-		Query: strings.Join(conditions, "^"),
-	}
+		Query: query,
+	}, nil
 }
 
-func prepareGroupToRoleFilter(groupId string, roleId string) *FilterVars {
-	var query string
+// groupToRoleQuery is the sys_group_has_role condition. When groupId is
+// empty (enumeration), the configured domain and group filter are
+// dot-walked onto group, the same way userToRoleQuery scopes users.
+func groupToRoleQuery(groupId string, roleId string, sysDomains []string, groupFilter string) *Query {
+	q := NewQuery()
 	if groupId != "" {
-		query = fmt.Sprintf("group=%s", groupId)
+		q.Equals("group", groupId)
 	}
-
 	if roleId != "" {
-		if query != "" {
-			query = fmt.Sprintf("%s^role=%s", query, roleId)
-		} else {
-			query = fmt.Sprintf("role=%s", roleId)
-		}
+		q.Equals("role", roleId)
+	}
+	if groupId == "" {
+		q.And(sysDomainQuery("group.sys_domain", sysDomains)).FilterVia("group", groupFilter)
 	}
+	return q
+}
 
+// prepareGroupToRoleFilter builds the sys_group_has_role filter (see
+// groupToRoleQuery).
+func prepareGroupToRoleFilter(groupId string, roleId string, sysDomains []string, groupFilter string) (*FilterVars, error) {
+	query, err := groupToRoleQuery(groupId, roleId, sysDomains, groupFilter).Build()
+	if err != nil {
+		return nil, err
+	}
 	return &FilterVars{
 		Fields: []string{
 			"sys_id", "role", "group", "inherits",
 		},
 		Query: query,
-	}
+	}, nil
 }
 
 func filterToReqOptions(vars *FilterVars) []ReqOpt {
@@ -21,6 +21,18 @@ func applyReqOpts(req *http.Request, opts ...ReqOpt) {
 	}
 }
 
+// filterQuery returns the Query of a prepare*Filter result, failing the test
+// if it returned an error.
+func filterQuery(t *testing.T) func(*FilterVars, error) string {
+	return func(vars *FilterVars, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("unexpected error preparing filter: %v", err)
+		}
+		return vars.Query
+	}
+}
+
 func TestBuildDomainQuery(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -62,7 +74,10 @@ func TestBuildDomainQuery(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := buildDomainQuery(tc.field, tc.domains)
+			got, err := buildDomainQuery(tc.field, tc.domains).Build()
+			if err != nil {
+				t.Fatalf("buildDomainQuery(%q, %v): %v", tc.field, tc.domains, err)
+			}
 			if got != tc.want {
 				t.Errorf("buildDomainQuery(%q, %v) = %q, want %q", tc.field, tc.domains, got, tc.want)
 			}
@@ -73,20 +88,22 @@ func TestBuildDomainQuery(t *testing.T) {
 // TestPrepareUserFilters_Regression pins the pre-refactor byte-for-byte
 // output of prepareUserFilters now that it's built on top of buildDomainQuery.
 func TestPrepareUserFilters_Regression(t *testing.T) {
-	got := prepareUserFilters([]string{"a.com"}, nil)
+	got := filterQuery(t)(prepareUserFilters([]string{"a.com"}, nil, nil, ""))
 	want := "emailENDSWITH@a.com"
-	if got.Query != want {
-		t.Errorf("prepareUserFilters(...).Query = %q, want %q", got.Query, want)
+	if got != want {
+		t.Errorf("prepareUserFilters(...).Query = %q, want %q", got, want)
 	}
 }
 
 func TestPrepareUserToRoleFilter(t *testing.T) {
 	tests := []struct {
-		name    string
-		userId  string
-		roleId  string
-		domains []string
-		want    string
+		name       string
+		userId     string
+		roleId     string
+		domains    []string
+		sysDomains []string
+		userFilter string
+		want       string
 	}{
 		{
 			name:    "enumeration (Grants) with allowed domains filters by domain",
@@ -116,13 +133,43 @@ func TestPrepareUserToRoleFilter(t *testing.T) {
 			domains: nil,
 			want:    "role=ROLE1",
 		},
+		{
+			name:       "enumeration dot-walks the user filter onto user, after the domain filter",
+			userId:     "",
+			roleId:     "ROLE1",
+			domains:    []string{"example.com"},
+			userFilter: "active=true^web_service_access_only=false",
+			want:       "role=ROLE1^user.emailENDSWITH@example.com^user.active=true^user.web_service_access_only=false",
+		},
+		{
+			name:       "provisioning check for a specific user does not apply the user filter",
+			userId:     "USER1",
+			roleId:     "ROLE1",
+			userFilter: "active=true",
+			want:       "user=USER1^role=ROLE1",
+		},
+		{
+			name:       "enumeration scopes user.sys_domain to the configured domain and its children",
+			userId:     "",
+			roleId:     "ROLE1",
+			domains:    []string{"example.com"},
+			sysDomains: []string{"D1", "D2"},
+			want:       "role=ROLE1^user.emailENDSWITH@example.com^user.sys_domainIND1,D2",
+		},
+		{
+			name:       "provisioning check for a specific user does not scope by sys_domain",
+			userId:     "USER1",
+			roleId:     "ROLE1",
+			sysDomains: []string{"D1"},
+			want:       "user=USER1^role=ROLE1",
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := prepareUserToRoleFilter(tc.userId, tc.roleId, tc.domains)
-			if got.Query != tc.want {
-				t.Errorf("prepareUserToRoleFilter(%q, %q, %v).Query = %q, want %q", tc.userId, tc.roleId, tc.domains, got.Query, tc.want)
+			got := filterQuery(t)(prepareUserToRoleFilter(tc.userId, tc.roleId, tc.domains, tc.sysDomains, tc.userFilter))
+			if got != tc.want {
+				t.Errorf("prepareUserToRoleFilter(%q, %q, %v).Query = %q, want %q", tc.userId, tc.roleId, tc.domains, got, tc.want)
 			}
 		})
 	}
@@ -130,11 +177,12 @@ func TestPrepareUserToRoleFilter(t *testing.T) {
 
 func TestPrepareUserToGroupFilter(t *testing.T) {
 	tests := []struct {
-		name    string
-		userId  string
-		groupId string
-		domains []string
-		want    string
+		name       string
+		userId     string
+		groupId    string
+		domains    []string
+		userFilter string
+		want       string
 	}{
 		{
 			name:    "enumeration (Grants) with allowed domains filters by domain",
@@ -164,18 +212,51 @@ func TestPrepareUserToGroupFilter(t *testing.T) {
 			domains: nil,
 			want:    "group=GROUP1",
 		},
+		{
+			name:       "enumeration dot-walks an OR'd user filter onto user",
+			userId:     "",
+			groupId:    "GROUP1",
+			userFilter: "active=true^ORlocked_out=false",
+			want:       "group=GROUP1^user.active=true^ORuser.locked_out=false",
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := prepareUserToGroupFilter(tc.userId, tc.groupId, tc.domains)
-			if got.Query != tc.want {
-				t.Errorf("prepareUserToGroupFilter(%q, %q, %v).Query = %q, want %q", tc.userId, tc.groupId, tc.domains, got.Query, tc.want)
+			got := filterQuery(t)(prepareUserToGroupFilter(tc.userId, tc.groupId, tc.domains, nil, tc.userFilter))
+			if got != tc.want {
+				t.Errorf("prepareUserToGroupFilter(%q, %q, %v).Query = %q, want %q", tc.userId, tc.groupId, tc.domains, got, tc.want)
 			}
 		})
 	}
 }
 
+// The configured filters are ANDed after the connector's own conditions on
+// the identity listings themselves.
+func TestPrepareListingFilters_AppendConfiguredFilter(t *testing.T) {
+	if got, want := filterQuery(t)(prepareUserFilters([]string{"a.com"}, nil, nil, "active=true")), "emailENDSWITH@a.com^active=true"; got != want {
+		t.Errorf("prepareUserFilters(...).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareGroupFilters(nil, nil, "type=itil")), "type=itil"; got != want {
+		t.Errorf("prepareGroupFilters(...).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareUserFilters(nil, []string{"D1", "D2"}, nil, "active=true")), "sys_domainIND1,D2^active=true"; got != want {
+		t.Errorf("prepareUserFilters(sys domains).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareGroupFilters([]string{"G1"}, []string{"D1"}, "")), "sys_id=G1^sys_domainIND1"; got != want {
+		t.Errorf("prepareGroupFilters(sys domains).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareRoleFilters("elevated_privilege=false")), "grantable=true^elevated_privilege=false"; got != want {
+		t.Errorf("prepareRoleFilters(...).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareGroupToRoleFilter("", "ROLE1", []string{"D1"}, "type=itil")), "role=ROLE1^group.sys_domainIND1^group.type=itil"; got != want {
+		t.Errorf("prepareGroupToRoleFilter(enumeration).Query = %q, want %q", got, want)
+	}
+	if got, want := filterQuery(t)(prepareGroupToRoleFilter("GROUP1", "ROLE1", []string{"D1"}, "type=itil")), "group=GROUP1^role=ROLE1"; got != want {
+		t.Errorf("prepareGroupToRoleFilter(point lookup).Query = %q, want %q", got, want)
+	}
+}
+
 func TestKeysetCursorFragment(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -196,7 +277,10 @@ func TestKeysetCursorFragment(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			got := keysetCursorFragment(tc.lastID)
+			got, err := keysetCursorFragment(tc.lastID)
+			if err != nil {
+				t.Fatalf("keysetCursorFragment(%q): %v", tc.lastID, err)
+			}
 			if got != tc.want {
 				t.Errorf("keysetCursorFragment(%q) = %q, want %q", tc.lastID, got, tc.want)
 			}
@@ -209,8 +293,15 @@ func TestKeysetCursorFragment(t *testing.T) {
 // options appended after in the same ReqOpt slice. The seek condition must
 // AND onto the existing filter query rather than clobbering it.
 func TestKeysetPaginationVarsToReqOptions_ComposesWithFilterQuery(t *testing.T) {
-	filterOpts := filterToReqOptions(prepareUserToRoleFilter("", "ROLE1", []string{"example.com"}))
-	paginationOpts := keysetPaginationVarsToReqOptions(&KeysetPaginationVars{Limit: 50, LastID: "abc123"})
+	filterVars, err := prepareUserToRoleFilter("", "ROLE1", []string{"example.com"}, nil, "")
+	if err != nil {
+		t.Fatalf("prepareUserToRoleFilter: %v", err)
+	}
+	filterOpts := filterToReqOptions(filterVars)
+	paginationOpts, err := keysetPaginationVarsToReqOptions(&KeysetPaginationVars{Limit: 50, LastID: "abc123"})
+	if err != nil {
+		t.Fatalf("keysetPaginationVarsToReqOptions: %v", err)
+	}
 
 	req := newTestRequest(t)
 	applyReqOpts(req, filterOpts...)
@@ -233,8 +324,15 @@ func TestKeysetPaginationVarsToReqOptions_ComposesWithFilterQuery(t *testing.T)
 // (sys_id greater than the max possible value) returned zero rows, proving
 // the seek constrains every branch rather than only the trailing one.
 func TestKeysetPaginationVarsToReqOptions_ComposesWithMultiDomainFilterQuery(t *testing.T) {
-	filterOpts := filterToReqOptions(prepareUserToRoleFilter("", "ROLE1", []string{"example.com", "dk.com"}))
-	paginationOpts := keysetPaginationVarsToReqOptions(&KeysetPaginationVars{Limit: 50, LastID: "abc123"})
+	filterVars, err := prepareUserToRoleFilter("", "ROLE1", []string{"example.com", "dk.com"}, nil, "")
+	if err != nil {
+		t.Fatalf("prepareUserToRoleFilter: %v", err)
+	}
+	filterOpts := filterToReqOptions(filterVars)
+	paginationOpts, err := keysetPaginationVarsToReqOptions(&KeysetPaginationVars{Limit: 50, LastID: "abc123"})
+	if err != nil {
+		t.Fatalf("keysetPaginationVarsToReqOptions: %v", err)
+	}
 
 	req := newTestRequest(t)
 	applyReqOpts(req, filterOpts...)
@@ -461,3 +559,12 @@ func TestCappedForDomainFilter(t *testing.T) {
 		})
 	}
 }
+
+// Deleting a group must clear every membership, including those of users the
+// domain or user filters keep out of the sync.
+func TestPrepareGroupMembersFilter_IsUnscoped(t *testing.T) {
+	got := filterQuery(t)(prepareGroupMembersFilter("GROUP1"))
+	if got != "group=GROUP1" {
+		t.Errorf("prepareGroupMembersFilter query = %q, want %q", got, "group=GROUP1")
+	}
+}
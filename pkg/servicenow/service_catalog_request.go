@@ -15,7 +15,9 @@ var ErrLabelNotFound = errors.New("label not found")
 // replaces by type), and annotations.Merge appends rather than replaces -- two
 // merged bags would leave Pick returning the stale entry. So methods that issue
 // several requests return the annotations from the *last* one, which reflects
-// the most recent state of the limit.
+// the most recent state of the limit. The exceptions are the Batch API paths
+// (see AddLabelsToRequest), which follow doHTTPRequestWithBackoff: every
+// call's annotations, newest first, so Pick still reads the current limit.
 
 type FieldOption func(catalogItemRequestPayload *OrderItemPayload)
 
@@ -57,9 +59,13 @@ func (c *Client) GetServiceCatalogRequestItem(ctx context.Context, requestItemId
 }
 
 func (c *Client) GetServiceCatalogRequestedItemForRequest(ctx context.Context, serviceCatalogRequestId string) (*RequestedItem, annotations.Annotations, error) {
+	query, err := NewQuery().Equals("request", serviceCatalogRequestId).Build()
+	if err != nil {
+		return nil, nil, err
+	}
 	requestItemsResponse, _, annos, err := c.GetServiceCatalogRequestItems(ctx,
 		WithPageLimit(1),
-		WithQuery(fmt.Sprintf("request=%s", serviceCatalogRequestId)),
+		WithQuery(query),
 		WithIncludeExternalRefLink(),
 	)
 	if err != nil {
@@ -178,18 +184,104 @@ func (c *Client) OrderItemNow(ctx context.Context, catalogItemId string, payload
 	return &orderCatalogItemResponse.Result, annos, nil
 }
 
+// AddLabelsToRequest attaches labels to a requested item in at most three
+// Batch API calls, however many labels there are: look every label up,
+// create the missing ones, then attach them all. The steps can't share a
+// batch because each needs the sys_ids the one before returns.
 func (c *Client) AddLabelsToRequest(ctx context.Context, requestedItemId string, labels []string) (annotations.Annotations, error) {
-	var annos annotations.Annotations
-	for _, label := range labels {
-		_, labelAnnos, err := c.AddLabelToRequest(ctx, requestedItemId, label)
-		annos = labelAnnos
+	labels = uniqueLabels(labels)
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	lookup := c.NewBatch()
+	lookups := make([]*BatchItem, len(labels))
+	for i, label := range labels {
+		query, err := labelQuery(label)
 		if err != nil {
-			return annos, err
+			return nil, err
+		}
+		lookups[i] = lookup.Get(c.apiURL(LabelBaseUrl, c.deployment), WithQuery(query))
+	}
+	annos, err := lookup.Execute(ctx)
+	if err != nil {
+		return annos, fmt.Errorf("error fetching labels: %w", err)
+	}
+
+	labelIDs := make(map[string]string, len(labels))
+	create := c.NewBatch()
+	creates := make(map[string]*BatchItem)
+	for i, label := range labels {
+		var labelsResponse LabelsResponse
+		if err := lookups[i].Decode(&labelsResponse); err != nil {
+			return annos, fmt.Errorf("error fetching label '%s': %w", label, err)
+		}
+		if len(labelsResponse.Result) > 0 {
+			labelIDs[label] = labelsResponse.Result[0].Id
+			continue
 		}
+		creates[label] = create.Post(
+			c.apiURL(LabelBaseUrl, c.deployment),
+			&Label{ViewableBy: "everyone", Name: label},
+			WithIncludeResponseBody(),
+		)
 	}
+
+	if create.Len() > 0 {
+		createAnnos, err := create.Execute(ctx)
+		annos = append(createAnnos, annos...)
+		if err != nil {
+			return annos, fmt.Errorf("error creating labels: %w", err)
+		}
+		for label, item := range creates {
+			var labelResponse LabelResponse
+			if err := item.Decode(&labelResponse); err != nil {
+				return annos, fmt.Errorf("error creating label '%s': %w", label, err)
+			}
+			labelIDs[label] = labelResponse.Result.Id
+		}
+	}
+
+	attach := c.NewBatch()
+	attaches := make([]*BatchItem, len(labels))
+	for i, label := range labels {
+		attaches[i] = attach.Post(
+			c.apiURL(LabelEntryBaseUrl, c.deployment),
+			&LabelEntryPayload{
+				Table:    "sc_req_item",
+				TableKey: requestedItemId,
+				Label:    labelIDs[label],
+			},
+			WithIncludeResponseBody(),
+		)
+	}
+	attachAnnos, err := attach.Execute(ctx)
+	annos = append(attachAnnos, annos...)
+	if err != nil {
+		return annos, fmt.Errorf("error adding labels to requested item %s: %w", requestedItemId, err)
+	}
+	for i, item := range attaches {
+		if err := item.Err(); err != nil {
+			return annos, fmt.Errorf("error adding label %s to requested item %s: %w", labelIDs[labels[i]], requestedItemId, err)
+		}
+	}
+
 	return annos, nil
 }
 
+func uniqueLabels(labels []string) []string {
+	seen := make(map[string]struct{}, len(labels))
+	rv := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if _, ok := seen[label]; ok {
+			continue
+		}
+		seen[label] = struct{}{}
+		rv = append(rv, label)
+	}
+	return rv
+}
+
 func (c *Client) AddLabelToRequest(ctx context.Context, requestedItemId string, label string) (*BaseResource, annotations.Annotations, error) {
 	labelResp, annos, err := c.CreateLabel(ctx, label)
 	if err != nil {
@@ -230,13 +322,28 @@ func (c *Client) CreateLabel(ctx context.Context, label string) (*Label, annotat
 	return nil, annos, err
 }
 
+// labelQuery looks a label up by name. A name that can't be put in a query
+// (one with a ^, say) fails here rather than matching some other label.
+func labelQuery(label string) (string, error) {
+	query, err := NewQuery().Equals("name", label).Build()
+	if err != nil {
+		return "", fmt.Errorf("invalid label '%s': %w", label, err)
+	}
+	return query, nil
+}
+
 func (c *Client) GetLabel(ctx context.Context, label string) (*Label, annotations.Annotations, error) {
+	query, err := labelQuery(label)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var labelsResponse LabelsResponse
 	_, annos, err := c.get(
 		ctx,
 		c.apiURL(LabelBaseUrl, c.deployment),
 		&labelsResponse,
-		WithQuery(fmt.Sprintf("name=%s", label)),
+		WithQuery(query),
 	)
 	if err != nil {
 		return nil, annos, fmt.Errorf("error fetching label '%s': %w", label, err)
@@ -266,12 +373,17 @@ func (c *Client) createLabel(ctx context.Context, label string) (*Label, annotat
 }
 
 func (c *Client) GetLabelsForRequestedItem(ctx context.Context, requestedItemId string) ([]string, annotations.Annotations, error) {
+	query, err := NewQuery().Equals("table", "sc_req_item").Equals("table_key", requestedItemId).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var labelResponse LabelEntriesLabelNameResponse
 	_, annos, err := c.get(
 		ctx,
 		c.apiURL(LabelEntryBaseUrl, c.deployment),
 		&labelResponse,
-		WithQuery(fmt.Sprintf("table=sc_req_item^table_key=%s", requestedItemId)),
+		WithQuery(query),
 		WithFields("label.name"),
 	)
 	if err != nil {
@@ -285,12 +397,22 @@ func (c *Client) GetLabelsForRequestedItem(ctx context.Context, requestedItemId
 }
 
 func (c *Client) GetServiceCatalogRequestedItemStates(ctx context.Context) ([]RequestItemState, annotations.Annotations, error) {
+	query, err := NewQuery().
+		Equals("name", "task").
+		Equals("element", "state").
+		Equals("language", "en").
+		Equals("inactive", "false").
+		Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var catalogsResponse RequestedItemStateResponse
 	_, annos, err := c.get(
 		ctx,
 		c.apiURL(ChoiceBaseUrl, c.deployment),
 		&catalogsResponse,
-		WithQuery("name=task^element=state^language=en^inactive=false"),
+		WithQuery(query),
 		WithFields("label,value"),
 	)
 	if err != nil {
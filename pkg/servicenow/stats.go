@@ -0,0 +1,205 @@
+package servicenow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// Aggregate API: counts without fetching rows.
+// https://www.servicenow.com/docs/bundle/yokohama-api-reference/page/integrate/inbound-rest/concept/c_AggregateAPI.html .
+const StatsBaseUrl = BaseURL + "/now/stats/%s"
+
+type tableStats struct {
+	Stats struct {
+		Count string `json:"count"`
+	} `json:"stats"`
+}
+
+// SyncCounts is how many rows each of the sync's listings covers, scoped the
+// way sync scopes them.
+type SyncCounts struct {
+	Users        int
+	Groups       int
+	Roles        int
+	GroupMembers int // sys_user_grmember
+	UserRoles    int // sys_user_has_role
+	GroupRoles   int // sys_group_has_role
+	Delegations  int // sys_user_delegate, expired ones included
+
+	// Only counted when applications are synced (see WithApplications).
+	Applications int // sys_scope, less the global scope
+
+	// Only counted when subscriptions are synced (see WithSubscriptions).
+	Subscriptions     int // license_details
+	SubscriptionUsers int // license_has_user
+
+	// Only counted when user criteria are synced (see WithUserCriteria).
+	UserCriteria int // user_criteria
+
+	// Only counted when the CMDB is synced (see WithCMDB).
+	BusinessApplications int // cmdb_ci_business_app
+	BusinessServices     int // cmdb_ci_service
+
+	// Only counted when HR Service Delivery is synced (see WithHRSD).
+	HRRoles      int // sys_user_role, sn_hr* roles only
+	HRGroupRoles int // sys_group_has_role, sn_hr* roles only
+
+	// Only counted when ACLs are synced (see WithACLs).
+	ACLs int // sys_security_acl, active ones only
+}
+
+func countReqOpts(query string) []ReqOpt {
+	return []ReqOpt{
+		WithQueryParam("sysparm_count", "true"),
+		WithQuery(query),
+	}
+}
+
+func decodeCount(table string, stats *tableStats) (int, error) {
+	count, err := strconv.Atoi(stats.Stats.Count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s row count %q: %w", table, stats.Stats.Count, err)
+	}
+	return count, nil
+}
+
+// CountRecords returns how many rows of table match query.
+func (c *Client) CountRecords(ctx context.Context, table string, q *Query) (int, annotations.Annotations, error) {
+	query, err := q.Build()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var response SingleResponse[tableStats]
+	_, annos, err := c.get(
+		ctx,
+		c.apiURL(StatsBaseUrl, c.deployment, table),
+		&response,
+		countReqOpts(query)...,
+	)
+	if err != nil {
+		return 0, annos, fmt.Errorf("failed to count %s records: %w", table, err)
+	}
+
+	count, err := decodeCount(table, &response.Result)
+	return count, annos, err
+}
+
+// GetSyncCounts counts the rows behind each sync listing in one batch, using
+// the same allowed-domains, configured domain and query filters as the
+// listings themselves.
+// Membership rows are also narrowed to the groups and roles sync lists, since
+// it only walks memberships under those.
+func (c *Client) GetSyncCounts(ctx context.Context) (*SyncCounts, annotations.Annotations, error) {
+	sysDomains, scopeAnnos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, scopeAnnos, err
+	}
+
+	// roleScope narrows a membership's role the way the role listing is
+	// narrowed: grantable, and matching the role filter.
+	roleScope := func(q *Query) *Query {
+		return q.Equals("role.grantable", "true").FilterVia("role", c.Filters.Role)
+	}
+
+	type countQuery struct {
+		table string
+		query *Query
+		count *int
+	}
+	counts := &SyncCounts{}
+	queries := []countQuery{
+		{"sys_user", userQuery(c.AllowedDomains, sysDomains, c.Filters.User), &counts.Users},
+		{"sys_user_group", groupQuery(sysDomains, c.Filters.Group), &counts.Groups},
+		{"sys_user_role", roleQuery(c.Filters.Role), &counts.Roles},
+		{
+			"sys_user_grmember",
+			userToGroupQuery("", "", c.AllowedDomains, sysDomains, c.Filters.User).
+				And(sysDomainQuery("group.sys_domain", sysDomains)).FilterVia("group", c.Filters.Group),
+			&counts.GroupMembers,
+		},
+		{
+			"sys_user_has_role",
+			roleScope(userToRoleQuery("", "", c.AllowedDomains, sysDomains, c.Filters.User)),
+			&counts.UserRoles,
+		},
+		{
+			"sys_group_has_role",
+			roleScope(groupToRoleQuery("", "", sysDomains, c.Filters.Group)),
+			&counts.GroupRoles,
+		},
+		{"sys_user_delegate", delegationQuery("", "", c.AllowedDomains, sysDomains, c.Filters.User), &counts.Delegations},
+	}
+	if c.SyncApplications {
+		queries = append(queries, countQuery{"sys_scope", applicationQuery(), &counts.Applications})
+	}
+	if c.SyncSubscriptions {
+		queries = append(queries,
+			countQuery{"license_details", NewQuery(), &counts.Subscriptions},
+			countQuery{"license_has_user", subscriptionUserQuery("", c.AllowedDomains, sysDomains, c.Filters.User), &counts.SubscriptionUsers},
+		)
+	}
+	if c.SyncUserCriteria {
+		queries = append(queries, countQuery{UserCriteriaTable, NewQuery(), &counts.UserCriteria})
+	}
+	if c.SyncCMDB {
+		queries = append(queries,
+			countQuery{BusinessApplicationsTable, NewQuery(), &counts.BusinessApplications},
+			countQuery{BusinessServicesTable, NewQuery(), &counts.BusinessServices},
+		)
+	}
+	if c.SyncHRSD {
+		// Both are core tables, so they count on an instance without HR
+		// Service Delivery too; its roles just aren't there.
+		queries = append(queries,
+			countQuery{"sys_user_role", NewQuery().Where("name", OpStartsWith, HRRolePrefix), &counts.HRRoles},
+			countQuery{
+				"sys_group_has_role",
+				NewQuery().Where("role.name", OpStartsWith, HRRolePrefix).And(groupToRoleQuery("", "", sysDomains, c.Filters.Group)),
+				&counts.HRGroupRoles,
+			},
+		)
+	}
+
+	if c.SyncACLs {
+		queries = append(queries, countQuery{ACLTable, NewQuery().Equals("active", "true"), &counts.ACLs})
+	}
+
+	batch := c.NewBatch()
+	items := make([]*BatchItem, len(queries))
+	for i, q := range queries {
+		query, err := q.query.Build()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to count %s records: %w", q.table, err)
+		}
+		items[i] = batch.Get(c.apiURL(StatsBaseUrl, c.deployment, q.table), countReqOpts(query)...)
+	}
+
+	annos, err := batch.Execute(ctx)
+	annos = append(annos, scopeAnnos...)
+	if err != nil {
+		return nil, annos, fmt.Errorf("failed to count sync records: %w", err)
+	}
+
+	for i, q := range queries {
+		var response SingleResponse[tableStats]
+		if err := items[i].Decode(&response); err != nil {
+			return nil, annos, fmt.Errorf("failed to count %s records: %w", q.table, err)
+		}
+		if *q.count, err = decodeCount(q.table, &response.Result); err != nil {
+			return nil, annos, err
+		}
+	}
+
+	return counts, annos, nil
+}
+
+// UserScopedPageSize is the page size GetUsers, GetUserToGroup and
+// GetUserToRole actually request when enumerating with the given limit:
+// limit itself, unless the allowed-domains cap applies.
+func (c *Client) UserScopedPageSize(limit int) int {
+	return cappedForDomainFilter("", c.AllowedDomains, KeysetPaginationVars{Limit: limit}).Limit
+}
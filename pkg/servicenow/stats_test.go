@@ -0,0 +1,73 @@
+package servicenow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// The counts must use the listings' own scoping, or the sizing report
+// describes a different sync than the one that would run.
+func TestGetSyncCountsScopesLikeSync(t *testing.T) {
+	queries := map[string]string{}
+	table := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tableName := strings.TrimPrefix(r.URL.Path, "/now/stats/")
+		if r.URL.Query().Get("sysparm_count") != "true" {
+			t.Errorf("%s: sysparm_count not set", tableName)
+		}
+		queries[tableName] = r.URL.Query().Get("sysparm_query")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"result":{"stats":{"count":"` + map[string]string{
+			"sys_user":           "1200",
+			"sys_user_group":     "40",
+			"sys_user_role":      "15",
+			"sys_user_grmember":  "3000",
+			"sys_user_has_role":  "900",
+			"sys_group_has_role": "60",
+			"sys_scope":          "8",
+			"sys_user_delegate":  "25",
+		}[tableName] + `"}}}`))
+	})
+	client := newBatchTestClient(t, &batchServer{t: t, table: table})
+	client.AllowedDomains = []string{"example.com"}
+	client.SyncApplications = true
+	client.Filters = QueryFilters{User: "active=true", Group: "type=itil", Role: "nameSTARTSWITHapp_"}
+
+	counts, _, err := client.GetSyncCounts(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := SyncCounts{Users: 1200, Groups: 40, Roles: 15, GroupMembers: 3000, UserRoles: 900, GroupRoles: 60, Applications: 8, Delegations: 25}
+	if *counts != want {
+		t.Errorf("counts = %+v, want %+v", *counts, want)
+	}
+
+	wantQueries := map[string]string{
+		"sys_user":           "emailENDSWITH@example.com^active=true",
+		"sys_user_group":     "type=itil",
+		"sys_user_role":      "grantable=true^nameSTARTSWITHapp_",
+		"sys_user_grmember":  "user.emailENDSWITH@example.com^user.active=true^group.type=itil",
+		"sys_user_has_role":  "user.emailENDSWITH@example.com^user.active=true^role.grantable=true^role.nameSTARTSWITHapp_",
+		"sys_group_has_role": "group.type=itil^role.grantable=true^role.nameSTARTSWITHapp_",
+		"sys_scope":          "sys_id!=global",
+		"sys_user_delegate":  "user.emailENDSWITH@example.com^user.active=true^delegate.emailENDSWITH@example.com^delegate.active=true",
+	}
+	for tableName, want := range wantQueries {
+		if got := queries[tableName]; got != want {
+			t.Errorf("%s query = %q, want %q", tableName, got, want)
+		}
+	}
+}
+
+func TestCountRecordsRejectsNonNumericCount(t *testing.T) {
+	client := newBatchTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"stats": map[string]any{"count": ""}}})
+	}))
+
+	if _, _, err := client.CountRecords(context.Background(), "sys_user", NewQuery()); err == nil {
+		t.Fatal("expected an error for an empty count")
+	}
+}
@@ -0,0 +1,66 @@
+package servicenow
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+)
+
+// Subscription Management: license_details holds a subscription and its
+// purchased and allocated counts, license_has_user a user's allocation of
+// one. Reading either takes the license_admin role (or admin).
+const (
+	SubscriptionsBaseUrl     = TableAPIBaseURL + "/license_details"
+	SubscriptionUsersBaseUrl = TableAPIBaseURL + "/license_has_user"
+)
+
+var (
+	SubscriptionFields     = []string{"sys_id", "name", "count", "allocated", "start_date", "end_date"}
+	SubscriptionUserFields = []string{"sys_id", "license", "user"}
+)
+
+// WithSubscriptions turns on syncing subscriptions and their user
+// allocations. It's off by default: the sync account of an existing
+// deployment may not be able to read the Subscription Management tables.
+func WithSubscriptions(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.SyncSubscriptions = enabled
+	}
+}
+
+// subscriptionUserQuery is the license_has_user condition. Like
+// userToGroupQuery for enumeration, users are scoped to the allowed
+// domains, the configured domain and the user filter, so allocations stay
+// consistent with which users get synced.
+func subscriptionUserQuery(subscriptionId string, domains []string, sysDomains []string, userFilter string) *Query {
+	q := NewQuery()
+	if subscriptionId != "" {
+		q.Equals("license", subscriptionId)
+	}
+	return q.And(buildDomainQuery("user.email", domains)).And(sysDomainQuery("user.sys_domain", sysDomains)).FilterVia("user", userFilter)
+}
+
+// GetSubscriptions lists license_details.
+func (c *Client) GetSubscriptions(ctx context.Context, paginationVars KeysetPaginationVars) ([]Subscription, string, annotations.Annotations, error) {
+	return getKeysetPage(ctx, c, c.apiURL(SubscriptionsBaseUrl, c.deployment),
+		&FilterVars{Fields: SubscriptionFields}, &paginationVars,
+		func(s Subscription) string { return s.Id })
+}
+
+// GetSubscriptionUsers lists the user allocations of one subscription (see
+// subscriptionUserQuery). The page size is capped like GetUserToGroup's.
+func (c *Client) GetSubscriptionUsers(ctx context.Context, subscriptionId string, paginationVars KeysetPaginationVars) ([]SubscriptionUser, string, annotations.Annotations, error) {
+	sysDomains, annos, err := c.SysDomainScope(ctx)
+	if err != nil {
+		return nil, "", annos, err
+	}
+	paginationVars = cappedForDomainFilter("", c.AllowedDomains, paginationVars)
+	query, err := subscriptionUserQuery(subscriptionId, c.AllowedDomains, sysDomains, c.Filters.User).Build()
+	if err != nil {
+		return nil, "", annos, err
+	}
+	rows, next, pageAnnos, err := getKeysetPage(ctx, c, c.apiURL(SubscriptionUsersBaseUrl, c.deployment),
+		&FilterVars{Fields: SubscriptionUserFields, Query: query}, &paginationVars,
+		func(u SubscriptionUser) string { return u.Id })
+	return rows, next, append(pageAnnos, annos...), err
+}